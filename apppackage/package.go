@@ -3,13 +3,13 @@ package apppackage
 import (
 	"bytes"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"github.com/byzk-org/common-utils/compress"
 	"github.com/byzk-org/common-utils/gmsm"
 	"github.com/byzk-org/common-utils/hash"
 	"github.com/byzk-org/common-utils/random"
-	"github.com/tjfoc/gmsm/sm2"
 	"io"
 	"io/ioutil"
 	"os"
@@ -55,15 +55,21 @@ type tmpAppInfo struct {
 }
 
 type ZipInfo struct {
-	Cmd             PackType
-	JarFile         string
-	RootCertPem     string
+	Cmd         PackType
+	JarFile     string
+	RootCertPem string
+	// RootKey 根密钥加密句柄(如密码卡中的密钥), 不为空时优先于RootCertPem用于加密数据密钥
+	RootKey         gmsm.Encrypter
 	UserCertPem     string
 	UserKeyPem      string
 	EncryptJarUrl   string
 	Exclude         []string
 	Include         []string
 	LocalServerPort string
+	// DataKeyStore 不为空时将数据包的sm4数据密钥保存到密钥库中, 名称为DataKeyName, 此时DataKeyName不能为空
+	// 保存的名称与版本写入数据包的证书信息(dk、dkv), 同时可以在End后通过DataKeyEntry获取
+	DataKeyStore *gmsm.KeyStore
+	DataKeyName  string
 	// app扩展信息，展示的时候进行显示
 	AppInfo        AppInfoInterface
 	AppVersionInfo AppInfoInterface
@@ -75,11 +81,15 @@ func NewZipOperation(info *ZipInfo) *zipOperation {
 		return &zipOperation{Err: err}
 	}
 
-	pubKey, err := gmsm.ParsePubKeyByCertPem(info.RootCertPem)
-	if err != nil {
-		return &zipOperation{
-			Err: errors.New("转换公钥失败"),
+	encrypter := info.RootKey
+	if encrypter == nil {
+		pubKey, err := gmsm.ParsePubKeyByCertPem(info.RootCertPem)
+		if err != nil {
+			return &zipOperation{
+				Err: errors.New("转换公钥失败"),
+			}
 		}
+		encrypter = gmsm.NewSm2Encrypter(pubKey)
 	}
 
 	return &zipOperation{
@@ -87,7 +97,7 @@ func NewZipOperation(info *ZipInfo) *zipOperation {
 		pluginsContentPath: make([]string, 0, 8),
 		Err:                err,
 		operationDir:       dir,
-		pubKey:             pubKey,
+		encrypter:          encrypter,
 	}
 }
 
@@ -106,10 +116,12 @@ type zipOperation struct {
 	operationDir   string
 	Err            error
 
-	pubKey *sm2.PublicKey
+	encrypter gmsm.Encrypter
 
 	JdkPath    string
 	EncJarPath string
+	// DataKeyEntry End时保存到DataKeyStore中的数据密钥
+	DataKeyEntry *gmsm.KeyStoreEntry
 }
 
 func (z *zipOperation) SetJdkPath(jdkPath string) *zipOperation {
@@ -249,6 +261,10 @@ func (z *zipOperation) End(goos, goarch string) ([]byte, error) {
 		return nil, errors.New("服务端口不能为空")
 	}
 
+	if z.zipInfo.DataKeyStore != nil && z.zipInfo.DataKeyName == "" {
+		return nil, errors.New("保存数据密钥的名称不能为空")
+	}
+
 	distContentFilePath := filepath.Join(z.operationDir, "ct")
 	_ = os.RemoveAll(distContentFilePath)
 	distContentFile, err := os.Create(distContentFilePath)
@@ -265,7 +281,7 @@ func (z *zipOperation) End(goos, goarch string) ([]byte, error) {
 	distContentFile.WriteString(base64.StdEncoding.EncodeToString(appVersionBytes))
 	distContentFile.WriteString(";")
 	if z.jdkContentPath != "" {
-		err = encryptFrameFile2File("jdk", z.jdkContentPath, distContentFile, z.pubKey)
+		err = encryptFrameFile2File("jdk", z.jdkContentPath, distContentFile, z.encrypter)
 		if err != nil {
 			z.Err = err
 			return nil, err
@@ -281,7 +297,7 @@ func (z *zipOperation) End(goos, goarch string) ([]byte, error) {
 		}
 
 		if z.encJarContentPath != "" {
-			err = encryptFrameFile2File("jar", z.encJarContentPath, distContentFile, z.pubKey)
+			err = encryptFrameFile2File("jar", z.encJarContentPath, distContentFile, z.encrypter)
 			if err != nil {
 				z.Err = err
 				return nil, err
@@ -290,7 +306,7 @@ func (z *zipOperation) End(goos, goarch string) ([]byte, error) {
 
 		if len(z.pluginsContentPath) > 0 {
 			for _, content := range z.pluginsContentPath {
-				err = encryptFrameFile2File("plugin", content, distContentFile, z.pubKey)
+				err = encryptFrameFile2File("plugin", content, distContentFile, z.encrypter)
 				if err != nil {
 					z.Err = err
 					return nil, err
@@ -318,7 +334,19 @@ func (z *zipOperation) End(goos, goarch string) ([]byte, error) {
 		return nil, z.Err
 	}
 
-	dataKey := gmsm.Sm4RandomKey()
+	dataKey := gmsm.Sm4RandomSecret()
+	defer dataKey.Close()
+	if z.zipInfo.DataKeyStore != nil {
+		z.DataKeyEntry, err = z.zipInfo.DataKeyStore.ImportSm4Key(z.zipInfo.DataKeyName, dataKey.Bytes(), map[string]string{
+			"cmd":  z.zipInfo.Cmd.String(),
+			"app":  z.zipInfo.AppInfo.GetName(),
+			"md5":  hex.EncodeToString(contentDataMd5Sum[:]),
+			"sha1": hex.EncodeToString(contentDataSha1Sum[:]),
+		})
+		if err != nil {
+			return nil, errors.New("保存数据密钥失败 => " + err.Error())
+		}
+	}
 	distContentFile.Seek(0, 0)
 
 	distContentEncFilePath := filepath.Join(z.operationDir, "ct_e")
@@ -330,12 +358,12 @@ func (z *zipOperation) End(goos, goarch string) ([]byte, error) {
 	}
 	defer distContentEncFile.Close()
 
-	if err = gmsm.Sm4Encrypt2File(dataKey, distContentFile, distContentEncFile); err != nil {
+	if err = gmsm.Sm4Encrypt2FileSecret(dataKey, distContentFile, distContentEncFile); err != nil {
 		z.Err = errors.New("加密数据失败")
 		return nil, z.Err
 	}
 
-	sm2EncryptKeyData, err := gmsm.Sm2Encrypt(z.pubKey, dataKey)
+	sm2EncryptKeyData, err := z.encrypter.Encrypt(dataKey.Bytes())
 	if err != nil {
 		return nil, errors.New("加密密钥失败")
 	}
@@ -356,7 +384,7 @@ func (z *zipOperation) End(goos, goarch string) ([]byte, error) {
 
 	appDataFilePath := filepath.Join(tmpDir, "app.content")
 
-	err = compress.Gzip(distFilePath, appDataFilePath)
+	err = compress.GzipWithOptions(distFilePath, appDataFilePath, &compress.GzipOptions{})
 	if err != nil {
 		return nil, errors.New("压缩程序数据失败")
 	}
@@ -366,6 +394,10 @@ func (z *zipOperation) End(goos, goarch string) ([]byte, error) {
 		"uk": z.zipInfo.UserKeyPem,
 		"r":  z.zipInfo.RootCertPem,
 	}
+	if z.DataKeyEntry != nil {
+		certInfo["dk"] = z.DataKeyEntry.Name
+		certInfo["dkv"] = strconv.Itoa(z.DataKeyEntry.Version)
+	}
 
 	certInfoJsonStr, _ := json.Marshal(certInfo)
 	certInfoTmpFile := filepath.Join(tmpDir, "cert.info")
@@ -423,7 +455,7 @@ func (z *zipOperation) End(goos, goarch string) ([]byte, error) {
 	return file, nil
 }
 
-func encryptFrameFile2File(cmd string, srcFilePath string, distFile *os.File, encPublicKeyPem *sm2.PublicKey) error {
+func encryptFrameFile2File(cmd string, srcFilePath string, distFile *os.File, encrypter gmsm.Encrypter) error {
 	srcFile, err := os.OpenFile(srcFilePath, os.O_RDONLY, 0666)
 	if err != nil {
 		return errors.New("获取源文件失败")
@@ -442,9 +474,10 @@ func encryptFrameFile2File(cmd string, srcFilePath string, distFile *os.File, en
 	}
 	defer tmpDist.Close()
 
-	sm4RandomKey := gmsm.Sm4RandomKey()
+	sm4RandomKey := gmsm.Sm4RandomSecret()
+	defer sm4RandomKey.Close()
 
-	if err = gmsm.Sm4Encrypt2File(sm4RandomKey, srcFile, tmpDist); err != nil {
+	if err = gmsm.Sm4Encrypt2FileSecret(sm4RandomKey, srcFile, tmpDist); err != nil {
 		return errors.New("生成数据加密文件失败")
 	}
 
@@ -454,7 +487,7 @@ func encryptFrameFile2File(cmd string, srcFilePath string, distFile *os.File, en
 	}
 	encryptLenStr := strconv.FormatInt(stat.Size(), 10)
 
-	sm2EncryptKeyData, err := gmsm.Sm2Encrypt(encPublicKeyPem, sm4RandomKey)
+	sm2EncryptKeyData, err := encrypter.Encrypt(sm4RandomKey.Bytes())
 	if err != nil {
 		return errors.New("加密密钥失败")
 	}
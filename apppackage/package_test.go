@@ -3,6 +3,7 @@ package apppackage
 import (
 	"encoding/pem"
 	"fmt"
+	"github.com/byzk-org/common-utils/gmsm"
 	"github.com/byzk-org/common-utils/plugintemplate"
 	"github.com/tjfoc/gmsm/x509"
 	"io/ioutil"
@@ -77,6 +78,38 @@ func (a *appAndVersionInfo) GetJdkStartArgs() []string {
 	return a.JdkStartArgs
 }
 
+func TestDataKeyNameRequired(t *testing.T) {
+	dir, err := ioutil.TempDir("", "apppackage-test")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+	store, err := gmsm.CreateKeyStore(filepath.Join(dir, "keystore"), make([]byte, 16))
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer store.Close()
+
+	// 未指定名称时不能静默使用共享的默认名称保存数据密钥
+	info := &appAndVersionInfo{Name: "app", Desc: "app"}
+	operation := NewZipOperation(&ZipInfo{
+		Cmd:             PackTypeInstallApp,
+		RootCertPem:     rootCert,
+		LocalServerPort: "8080",
+		DataKeyStore:    store,
+		AppInfo:         info,
+		AppVersionInfo:  info,
+	})
+	if _, err = operation.End(runtime.GOOS, runtime.GOARCH); err == nil {
+		t.Error("指定密钥库时数据密钥名称不能为空")
+	}
+	if operation.DataKeyEntry != nil {
+		t.Error("不应当保存数据密钥")
+	}
+}
+
 func TestAppPackageZip(t *testing.T) {
 
 	type pluginListener struct {
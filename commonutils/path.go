@@ -1,16 +1,358 @@
 package commonutils
 
 import (
+	"errors"
+	"os"
 	"path"
 	"runtime"
 	"strings"
 )
 
-func PathJoin(ele ...string) string {
-	str := path.Join(ele...)
-	if runtime.GOOS == "windows" {
-		str = strings.ReplaceAll(str, "/", "\\")
-		str = strings.ReplaceAll(str, "\\\\", "\\")
+// UnsafePathError 路径超出了根目录或包含盘符等无法安全拼接的内容
+type UnsafePathError struct {
+	Path   string
+	Reason string
+}
+
+func (e *UnsafePathError) Error() string {
+	return "不安全的路径 " + e.Path + " => " + e.Reason
+}
+
+// longPathLimit Windows下超过该长度的绝对路径需要使用\\?\前缀, 与标准库一致
+const longPathLimit = 248
+
+// Paths 按指定操作系统的规则处理路径, 规则只与GOOS有关, 不依赖当前运行的系统, 便于在Linux上测试Windows的路径
+type Paths struct {
+	// GOOS 目标操作系统, 为空时使用runtime.GOOS
+	GOOS string
+	// Getenv 读取环境变量, 为空时使用os.Getenv
+	Getenv func(key string) string
+	// Home 用户目录, 为空时从环境变量读取
+	Home string
+}
+
+var defaultPaths = &Paths{}
+
+func (p *Paths) goos() string {
+	if p.GOOS == "" {
+		return runtime.GOOS
+	}
+	return p.GOOS
+}
+
+func (p *Paths) windows() bool {
+	return p.goos() == "windows"
+}
+
+func (p *Paths) getenv(key string) string {
+	if p.Getenv == nil {
+		return os.Getenv(key)
+	}
+	return p.Getenv(key)
+}
+
+// Separator 路径分隔符
+func (p *Paths) Separator() string {
+	if p.windows() {
+		return `\`
+	}
+	return "/"
+}
+
+func isSlash(c byte) bool {
+	return c == '/' || c == '\\'
+}
+
+// VolumeName 返回Windows路径的卷名, 如C:、\\server\share、\\?\C:、\\?\UNC\server\share, 其它系统返回空字符串
+func (p *Paths) VolumeName(name string) string {
+	if !p.windows() {
+		return ""
+	}
+	return name[:windowsVolumeLen(name)]
+}
+
+func windowsVolumeLen(name string) int {
+	if len(name) >= 2 && name[1] == ':' && isLetter(name[0]) {
+		return 2
+	}
+	if len(name) < 3 || !isSlash(name[0]) || !isSlash(name[1]) {
+		return 0
+	}
+	// \\?\与\\.\
+	if len(name) >= 4 && (name[2] == '?' || name[2] == '.') && isSlash(name[3]) {
+		rest := name[4:]
+		if len(rest) >= 4 && strings.EqualFold(rest[:3], "UNC") && isSlash(rest[3]) {
+			return 8 + uncLen(name[8:])
+		}
+		return 4 + nextSlash(rest)
+	}
+	if isSlash(name[2]) {
+		return 0
+	}
+	return 2 + uncLen(name[2:])
+}
+
+// uncLen 计算server\share部分的长度
+func uncLen(name string) int {
+	server := nextSlash(name)
+	if server == len(name) {
+		return server
+	}
+	return server + 1 + nextSlash(name[server+1:])
+}
+
+func nextSlash(name string) int {
+	for i := 0; i < len(name); i++ {
+		if isSlash(name[i]) {
+			return i
+		}
+	}
+	return len(name)
+}
+
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// IsAbs 是否为绝对路径, Windows下C:foo这样只有盘符的路径不是绝对路径
+func (p *Paths) IsAbs(name string) bool {
+	if !p.windows() {
+		return strings.HasPrefix(name, "/")
+	}
+	volLen := windowsVolumeLen(name)
+	if volLen > 2 {
+		return true
+	}
+	return volLen == 2 && len(name) > 2 && isSlash(name[2])
+}
+
+// ToSlash 将路径转换为以/分隔的形式, Windows的卷名保留, 如C:\a\b转换为C:/a/b
+func (p *Paths) ToSlash(name string) string {
+	if !p.windows() {
+		return name
+	}
+	return strings.ReplaceAll(name, `\`, "/")
+}
+
+// FromSlash 将以/分隔的路径转换为目标系统的形式
+func (p *Paths) FromSlash(name string) string {
+	if !p.windows() {
+		return name
+	}
+	return strings.ReplaceAll(name, "/", `\`)
+}
+
+// Clean 按目标系统的规则规范化路径, Windows下/与\均视为分隔符, 卷名原样保留
+func (p *Paths) Clean(name string) string {
+	if !p.windows() {
+		return path.Clean(name)
+	}
+	volLen := windowsVolumeLen(name)
+	vol, rest := p.FromSlash(name[:volLen]), name[volLen:]
+	if rest == "" {
+		if volLen > 2 {
+			return vol + `\`
+		}
+		return vol + "."
+	}
+	cleaned := path.Clean(strings.ReplaceAll(rest, `\`, "/"))
+	return vol + p.FromSlash(cleaned)
+}
+
+// Join 按目标系统的规则拼接路径, 空元素被忽略, 与filepath.Join一致但不依赖当前运行的系统
+func (p *Paths) Join(elem ...string) string {
+	for i, e := range elem {
+		if e == "" {
+			continue
+		}
+		if p.windows() && len(e) == 2 && windowsVolumeLen(e) == 2 && i+1 < len(elem) {
+			// C:与a拼接为C:a, 不变为绝对路径
+			rest := p.Join(elem[i+1:]...)
+			if rest == "." || rest == "" {
+				return p.Clean(e)
+			}
+			return p.Clean(e + rest)
+		}
+		return p.Clean(strings.Join(nonEmpty(elem[i:]), p.Separator()))
+	}
+	return ""
+}
+
+func nonEmpty(elem []string) []string {
+	result := make([]string, 0, len(elem))
+	for _, e := range elem {
+		if e != "" {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// SecureJoin 将不可信的相对路径拼接到root下, 路径通过..超出root、包含盘符或网络路径时返回*UnsafePathError
+// 开头的分隔符视为root本身, 只做字符串层面的检查, 不解析符号链接
+func (p *Paths) SecureJoin(root, unsafe string) (string, error) {
+	slashed := unsafe
+	if p.windows() {
+		if windowsVolumeLen(unsafe) != 0 {
+			return "", &UnsafePathError{Path: unsafe, Reason: "包含盘符或网络路径"}
+		}
+		slashed = strings.ReplaceAll(unsafe, `\`, "/")
+	}
+	parts := []string{root}
+	for _, part := range strings.Split(slashed, "/") {
+		switch {
+		case part == "" || part == ".":
+		case part == "..":
+			if len(parts) == 1 {
+				return "", &UnsafePathError{Path: unsafe, Reason: "超出根目录"}
+			}
+			parts = parts[:len(parts)-1]
+		case p.windows() && strings.Contains(part, ":"):
+			return "", &UnsafePathError{Path: unsafe, Reason: "包含冒号"}
+		default:
+			parts = append(parts, part)
+		}
+	}
+	return p.Join(parts...), nil
+}
+
+// HomeDir 用户目录, Windows下读取USERPROFILE, 其它系统读取HOME
+func (p *Paths) HomeDir() (string, error) {
+	if p.Home != "" {
+		return p.Home, nil
+	}
+	key := "HOME"
+	if p.windows() {
+		key = "USERPROFILE"
+	} else if p.goos() == "plan9" {
+		key = "home"
+	}
+	if home := p.getenv(key); home != "" {
+		return home, nil
+	}
+	return "", errors.New("无法获取用户目录, 环境变量" + key + "未设置")
+}
+
+// ExpandHome 将开头的~展开为用户目录, 不支持~user的形式
+func (p *Paths) ExpandHome(name string) (string, error) {
+	if name == "" || name[0] != '~' {
+		return name, nil
+	}
+	if len(name) > 1 && name[1] != '/' && !(p.windows() && name[1] == '\\') {
+		return "", errors.New("不支持展开其它用户的目录: " + name)
+	}
+	home, err := p.HomeDir()
+	if err != nil {
+		return "", err
+	}
+	return p.Join(home, name[1:]), nil
+}
+
+// LongPath Windows下将超长的绝对路径转换为\\?\形式以突破MAX_PATH的限制, 其它系统及短路径原样返回
+func (p *Paths) LongPath(name string) string {
+	if !p.windows() || len(name) < longPathLimit || !p.IsAbs(name) {
+		return name
+	}
+	if strings.HasPrefix(name, `\\?\`) || strings.HasPrefix(name, `\\.\`) {
+		return name
+	}
+	// \\?\前缀会关闭系统对路径的规范化, 需要先处理/、.与..
+	name = p.Clean(name)
+	if windowsVolumeLen(name) == 2 {
+		return `\\?\` + name
+	}
+	return `\\?\UNC\` + name[2:]
+}
+
+// envDir 读取保存绝对路径的环境变量, 相对路径被忽略
+func (p *Paths) envDir(key string) string {
+	dir := p.getenv(key)
+	if dir == "" || !p.IsAbs(dir) {
+		return ""
 	}
-	return str
+	return dir
+}
+
+// userDir 计算各系统下的用户目录, windowsKey为Windows下的环境变量, xdgKey与xdgDefault为Linux等系统下XDG规范的环境变量与默认目录
+func (p *Paths) userDir(app, windowsKey, windowsSuffix, darwinDir, xdgKey, xdgDefault string) (string, error) {
+	var base string
+	switch p.goos() {
+	case "windows":
+		base = p.envDir(windowsKey)
+		if base == "" {
+			return "", errors.New("无法获取应用目录, 环境变量" + windowsKey + "未设置")
+		}
+		return p.Join(base, app, windowsSuffix), nil
+	case "darwin", "ios":
+		home, err := p.HomeDir()
+		if err != nil {
+			return "", err
+		}
+		return p.Join(home, darwinDir, app), nil
+	default:
+		base = p.envDir(xdgKey)
+		if base == "" {
+			home, err := p.HomeDir()
+			if err != nil {
+				return "", err
+			}
+			base = p.Join(home, xdgDefault)
+		}
+		return p.Join(base, app), nil
+	}
+}
+
+// AppDataDir 应用数据目录, Windows为%LOCALAPPDATA%\app, macOS为~/Library/Application Support/app, 其它系统为$XDG_DATA_HOME/app或~/.local/share/app
+func (p *Paths) AppDataDir(app string) (string, error) {
+	return p.userDir(app, "LOCALAPPDATA", "", "Library/Application Support", "XDG_DATA_HOME", ".local/share")
+}
+
+// ConfigDir 应用配置目录, Windows为%APPDATA%\app, macOS为~/Library/Application Support/app, 其它系统为$XDG_CONFIG_HOME/app或~/.config/app
+func (p *Paths) ConfigDir(app string) (string, error) {
+	return p.userDir(app, "APPDATA", "", "Library/Application Support", "XDG_CONFIG_HOME", ".config")
+}
+
+// CacheDir 应用缓存目录, Windows为%LOCALAPPDATA%\app\Cache, macOS为~/Library/Caches/app, 其它系统为$XDG_CACHE_HOME/app或~/.cache/app
+func (p *Paths) CacheDir(app string) (string, error) {
+	return p.userDir(app, "LOCALAPPDATA", "Cache", "Library/Caches", "XDG_CACHE_HOME", ".cache")
+}
+
+// PathJoin 按当前系统的规则拼接路径, Windows下保留盘符与网络路径
+func PathJoin(ele ...string) string {
+	return defaultPaths.Join(ele...)
+}
+
+// PathClean 按当前系统的规则规范化路径
+func PathClean(name string) string {
+	return defaultPaths.Clean(name)
+}
+
+// SecureJoin 将不可信的相对路径拼接到root下, 超出root时返回*UnsafePathError
+func SecureJoin(root, unsafe string) (string, error) {
+	return defaultPaths.SecureJoin(root, unsafe)
+}
+
+// ExpandHome 将开头的~展开为当前用户的目录
+func ExpandHome(name string) (string, error) {
+	return defaultPaths.ExpandHome(name)
+}
+
+// LongPath Windows下将超长的绝对路径转换为\\?\形式
+func LongPath(name string) string {
+	return defaultPaths.LongPath(name)
+}
+
+// AppDataDir 当前系统下的应用数据目录
+func AppDataDir(app string) (string, error) {
+	return defaultPaths.AppDataDir(app)
+}
+
+// ConfigDir 当前系统下的应用配置目录
+func ConfigDir(app string) (string, error) {
+	return defaultPaths.ConfigDir(app)
+}
+
+// CacheDir 当前系统下的应用缓存目录
+func CacheDir(app string) (string, error) {
+	return defaultPaths.CacheDir(app)
 }
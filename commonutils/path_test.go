@@ -0,0 +1,157 @@
+package commonutils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPathsWindows(t *testing.T) {
+	p := &Paths{GOOS: "windows"}
+	joins := []struct {
+		elem []string
+		want string
+	}{
+		{[]string{`C:\app`, "conf", "app.yml"}, `C:\app\conf\app.yml`},
+		{[]string{"C:/app/", "../lib"}, `C:\lib`},
+		{[]string{`\\server\share`, "app", "run.exe"}, `\\server\share\app\run.exe`},
+		{[]string{`\\?\UNC\server\share\app`, "..", "x"}, `\\?\UNC\server\share\x`},
+		{[]string{"C:", "app"}, `C:app`},
+		{[]string{"", "a", "", "b"}, `a\b`},
+		{[]string{`\\server\share\..\..\x`}, `\\server\share\x`},
+	}
+	for _, c := range joins {
+		if got := p.Join(c.elem...); got != c.want {
+			t.Errorf("Join(%q) = %q, 期望 %q", c.elem, got, c.want)
+		}
+	}
+
+	volumes := map[string]string{
+		`C:\a`:                   "C:",
+		`\\server\share\a`:       `\\server\share`,
+		`//server/share/a`:       `//server/share`,
+		`\\?\C:\a`:               `\\?\C:`,
+		`\\?\UNC\server\share\a`: `\\?\UNC\server\share`,
+		`\a`:                     "",
+		`a\b`:                    "",
+	}
+	for name, want := range volumes {
+		if got := p.VolumeName(name); got != want {
+			t.Errorf("VolumeName(%q) = %q, 期望 %q", name, got, want)
+		}
+	}
+	for name, want := range map[string]bool{`C:\a`: true, `C:a`: false, `\\server\share`: true, `\a`: false, `a`: false} {
+		if p.IsAbs(name) != want {
+			t.Errorf("IsAbs(%q)错误", name)
+		}
+	}
+	if p.ToSlash(`C:\a\b`) != "C:/a/b" || p.FromSlash("C:/a/b") != `C:\a\b` {
+		t.Error("分隔符转换错误")
+	}
+
+	long := `C:\` + strings.Repeat(`dir\`, 70) + "file"
+	if got := p.LongPath(long); got != `\\?\`+long {
+		t.Errorf("长路径转换错误: %s", got)
+	}
+	longUNC := `\\server\share\` + strings.Repeat("dir/", 70) + "file"
+	if got := p.LongPath(longUNC); !strings.HasPrefix(got, `\\?\UNC\server\share\dir\`) || strings.Contains(got, "/") {
+		t.Errorf("长网络路径转换错误: %s", got)
+	}
+	if p.LongPath(`C:\short`) != `C:\short` {
+		t.Error("短路径不应转换")
+	}
+}
+
+func TestPathsPosix(t *testing.T) {
+	p := &Paths{GOOS: "linux"}
+	if got := p.Join("/opt/app/", "../lib", "a.jar"); got != "/opt/lib/a.jar" {
+		t.Errorf("Join结果错误: %s", got)
+	}
+	if p.VolumeName("/a") != "" || !p.IsAbs("/a") || p.IsAbs(`C:\a`) {
+		t.Error("路径判断错误")
+	}
+	if got := p.LongPath("/" + strings.Repeat("a/", 200)); got != "/"+strings.Repeat("a/", 200) {
+		t.Error("非Windows系统不应转换长路径")
+	}
+}
+
+func TestSecureJoin(t *testing.T) {
+	posix := &Paths{GOOS: "linux"}
+	windows := &Paths{GOOS: "windows"}
+	cases := []struct {
+		p    *Paths
+		root string
+		name string
+		want string
+	}{
+		{posix, "/data", "conf/app.yml", "/data/conf/app.yml"},
+		{posix, "/data", "/etc/passwd", "/data/etc/passwd"},
+		{posix, "/data", "a/../b", "/data/b"},
+		{posix, "/data", "..", ""},
+		{posix, "/data", "a/../../b", ""},
+		{windows, `C:\data`, `conf\app.yml`, `C:\data\conf\app.yml`},
+		{windows, `C:\data`, `a/..\b`, `C:\data\b`},
+		{windows, `C:\data`, `..\x`, ""},
+		{windows, `C:\data`, `D:\x`, ""},
+		{windows, `C:\data`, `\\server\share\x`, ""},
+		{windows, `C:\data`, `a\b:stream`, ""},
+	}
+	for _, c := range cases {
+		got, err := c.p.SecureJoin(c.root, c.name)
+		if c.want == "" {
+			if _, ok := err.(*UnsafePathError); !ok {
+				t.Errorf("SecureJoin(%q, %q)应当返回UnsafePathError: %q %v", c.root, c.name, got, err)
+			}
+			continue
+		}
+		if err != nil || got != c.want {
+			t.Errorf("SecureJoin(%q, %q) = %q %v, 期望 %q", c.root, c.name, got, err, c.want)
+		}
+	}
+}
+
+func TestUserDirs(t *testing.T) {
+	env := map[string]string{
+		"HOME":           "/home/byzk",
+		"XDG_CACHE_HOME": "/var/cache/byzk",
+		"XDG_DATA_HOME":  "relative",
+		"USERPROFILE":    `C:\Users\byzk`,
+		"APPDATA":        `C:\Users\byzk\AppData\Roaming`,
+		"LOCALAPPDATA":   `C:\Users\byzk\AppData\Local`,
+	}
+	getenv := func(key string) string {
+		return env[key]
+	}
+	cases := []struct {
+		goos string
+		fn   func(p *Paths) (string, error)
+		want string
+	}{
+		{"linux", func(p *Paths) (string, error) { return p.ConfigDir("app") }, "/home/byzk/.config/app"},
+		{"linux", func(p *Paths) (string, error) { return p.CacheDir("app") }, "/var/cache/byzk/app"},
+		{"linux", func(p *Paths) (string, error) { return p.AppDataDir("app") }, "/home/byzk/.local/share/app"},
+		{"darwin", func(p *Paths) (string, error) { return p.ConfigDir("app") }, "/home/byzk/Library/Application Support/app"},
+		{"darwin", func(p *Paths) (string, error) { return p.CacheDir("app") }, "/home/byzk/Library/Caches/app"},
+		{"windows", func(p *Paths) (string, error) { return p.ConfigDir("app") }, `C:\Users\byzk\AppData\Roaming\app`},
+		{"windows", func(p *Paths) (string, error) { return p.AppDataDir("app") }, `C:\Users\byzk\AppData\Local\app`},
+		{"windows", func(p *Paths) (string, error) { return p.CacheDir("app") }, `C:\Users\byzk\AppData\Local\app\Cache`},
+		{"windows", func(p *Paths) (string, error) { return p.ExpandHome(`~\.app\conf`) }, `C:\Users\byzk\.app\conf`},
+		{"linux", func(p *Paths) (string, error) { return p.ExpandHome("~/.app/conf") }, "/home/byzk/.app/conf"},
+		{"linux", func(p *Paths) (string, error) { return p.ExpandHome("~") }, "/home/byzk"},
+		{"linux", func(p *Paths) (string, error) { return p.ExpandHome("conf/~") }, "conf/~"},
+	}
+	for _, c := range cases {
+		got, err := c.fn(&Paths{GOOS: c.goos, Getenv: getenv})
+		if err != nil || got != c.want {
+			t.Errorf("%s: 结果为%q %v, 期望 %q", c.goos, got, err, c.want)
+		}
+	}
+
+	p := &Paths{GOOS: "linux", Getenv: getenv}
+	if _, err := p.ExpandHome("~root/x"); err == nil {
+		t.Error("~user形式应当返回错误")
+	}
+	empty := &Paths{GOOS: "windows", Getenv: func(string) string { return "" }}
+	if _, err := empty.ConfigDir("app"); err == nil {
+		t.Error("环境变量未设置时应当返回错误")
+	}
+}
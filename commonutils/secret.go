@@ -0,0 +1,121 @@
+package commonutils
+
+import (
+	"crypto/subtle"
+	"runtime"
+	"sync"
+)
+
+// Secret 保存密钥、口令等敏感数据的缓冲区
+// 数据以[]byte保存, Close后内容被清零; 使用完毕后必须调用Close, 不会在被回收时自动清零
+type Secret struct {
+	lock   sync.RWMutex
+	data   []byte
+	closed bool
+}
+
+// NewSecret 创建敏感数据缓冲区, 复制data的内容, 调用方可以随后清零data
+func NewSecret(data []byte) *Secret {
+	return newSecret(append(make([]byte, 0, len(data)), data...))
+}
+
+// NewSecretAndZero 创建敏感数据缓冲区, 复制data的内容后将data清零
+func NewSecretAndZero(data []byte) *Secret {
+	s := NewSecret(data)
+	Zero(data)
+	return s
+}
+
+// NewSecretFromString 由字符串创建敏感数据缓冲区, 字符串本身不可变, 无法被清零
+func NewSecretFromString(str string) *Secret {
+	return newSecret([]byte(str))
+}
+
+func newSecret(data []byte) *Secret {
+	return &Secret{data: data}
+}
+
+// Bytes 获取数据, 返回的切片与缓冲区共享内存, 在Close后被清零, 不能在Close之后继续使用; 已关闭时返回nil
+func (s *Secret) Bytes() []byte {
+	if s == nil {
+		return nil
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.closed {
+		return nil
+	}
+	return s.data
+}
+
+// Len 数据长度
+func (s *Secret) Len() int {
+	return len(s.Bytes())
+}
+
+// Closed 是否已关闭
+func (s *Secret) Closed() bool {
+	if s == nil {
+		return true
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.closed
+}
+
+// Equal 以常量时间比较两个缓冲区的内容, 任意一方已关闭时返回false
+func (s *Secret) Equal(other *Secret) bool {
+	a, b := s.Bytes(), other.Bytes()
+	if a == nil || b == nil {
+		return false
+	}
+	return ConstantTimeEqual(a, b)
+}
+
+// EqualBytes 以常量时间比较缓冲区与data的内容, 已关闭时返回false
+func (s *Secret) EqualBytes(data []byte) bool {
+	a := s.Bytes()
+	if a == nil {
+		return false
+	}
+	return ConstantTimeEqual(a, data)
+}
+
+// String 避免敏感数据被打印到日志中
+func (s *Secret) String() string {
+	return "******"
+}
+
+// Close 清零并释放数据, 可以重复调用
+func (s *Secret) Close() error {
+	if s == nil {
+		return nil
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return nil
+	}
+	Zero(s.data)
+	s.data = nil
+	s.closed = true
+	return nil
+}
+
+// Zero 将切片内容清零
+func Zero(data []byte) {
+	for i := range data {
+		data[i] = 0
+	}
+	runtime.KeepAlive(data)
+}
+
+// ConstantTimeEqual 以常量时间比较两个切片的内容, 长度不同时直接返回false
+func ConstantTimeEqual(a, b []byte) bool {
+	return subtle.ConstantTimeCompare(a, b) == 1
+}
+
+// ConstantTimeEqualString 以常量时间比较两个字符串的内容
+func ConstantTimeEqualString(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
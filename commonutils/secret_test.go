@@ -0,0 +1,43 @@
+package commonutils
+
+import (
+	"testing"
+)
+
+func TestSecret(t *testing.T) {
+	data := []byte("sm4-data-key-123")
+	s := NewSecretAndZero(data)
+	for _, v := range data {
+		if v != 0 {
+			t.Error("源数据未被清零")
+			return
+		}
+	}
+	if !s.EqualBytes([]byte("sm4-data-key-123")) {
+		t.Error("缓冲区内容不一致")
+	}
+	if !s.Equal(NewSecretFromString("sm4-data-key-123")) || s.Equal(NewSecretFromString("sm4-data-key-124")) {
+		t.Error("缓冲区比较结果错误")
+	}
+	if s.String() != "******" {
+		t.Error("缓冲区不应输出内容")
+	}
+
+	buf := s.Bytes()
+	if err := s.Close(); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	for _, v := range buf {
+		if v != 0 {
+			t.Error("关闭后缓冲区未被清零")
+			return
+		}
+	}
+	if s.Bytes() != nil || !s.Closed() || s.EqualBytes(nil) {
+		t.Error("关闭后缓冲区状态错误")
+	}
+	if err := s.Close(); err != nil {
+		t.Error("重复关闭不应返回错误")
+	}
+}
@@ -0,0 +1,684 @@
+package compress
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"golang.org/x/crypto/pbkdf2"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// AesStrength WinZip AES加密强度
+type AesStrength int
+
+const (
+	// Aes128 AES-128
+	Aes128 AesStrength = 1
+	// Aes192 AES-192
+	Aes192 AesStrength = 2
+	// Aes256 AES-256
+	Aes256 AesStrength = 3
+)
+
+const (
+	// zipMethodAes WinZip AES加密的压缩方式
+	zipMethodAes = 99
+	// zipExtraAes WinZip AES扩展字段
+	zipExtraAes = 0x9901
+	// zipExtraTime 扩展时间戳字段
+	zipExtraTime = 0x5455
+	// zipExtraZip64 zip64扩展字段
+	zipExtraZip64 = 0x0001
+	// aesPbkdf2Iter WinZip AES规定的PBKDF2迭代次数
+	aesPbkdf2Iter = 1000
+	// aesMacSize 认证码长度
+	aesMacSize = 10
+	uint32max  = 1<<32 - 1
+	uint16max  = 1<<16 - 1
+)
+
+var (
+	// ErrPasswordRequired 压缩包已加密但未提供密码
+	ErrPasswordRequired = errors.New("压缩包已加密, 需要提供密码")
+	// ErrWrongPassword 密码错误
+	ErrWrongPassword = errors.New("压缩包密码错误")
+)
+
+func (s AesStrength) valid() bool {
+	return s >= Aes128 && s <= Aes256
+}
+
+func (s AesStrength) keySize() int {
+	return 8 + 8*int(s)
+}
+
+func (s AesStrength) saltSize() int {
+	return 4 + 4*int(s)
+}
+
+// aesZipKeys 派生加密密钥、认证密钥与密码校验值
+func aesZipKeys(password, salt []byte, strength AesStrength) (encKey, macKey, verifier []byte) {
+	n := strength.keySize()
+	key := pbkdf2.Key(password, salt, aesPbkdf2Iter, 2*n+2, sha1.New)
+	return key[:n], key[n : 2*n], key[2*n:]
+}
+
+// aesCtr WinZip AES使用的CTR模式, 计数器为从1开始的小端序整数
+type aesCtr struct {
+	block   cipher.Block
+	counter [aes.BlockSize]byte
+	stream  [aes.BlockSize]byte
+	pos     int
+}
+
+func newAesCtr(key []byte) (*aesCtr, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.New("创建aes加密器失败 => " + err.Error())
+	}
+	return &aesCtr{block: block, pos: aes.BlockSize}, nil
+}
+
+func (c *aesCtr) XORKeyStream(dst, src []byte) {
+	for i := range src {
+		if c.pos == aes.BlockSize {
+			for j := range c.counter {
+				c.counter[j]++
+				if c.counter[j] != 0 {
+					break
+				}
+			}
+			c.block.Encrypt(c.stream[:], c.counter[:])
+			c.pos = 0
+		}
+		dst[i] = src[i] ^ c.stream[c.pos]
+		c.pos++
+	}
+}
+
+// aesZipEncrypter 加密并计算认证码, Close时写入认证码
+type aesZipEncrypter struct {
+	w   io.Writer
+	ctr *aesCtr
+	mac hash.Hash
+	buf []byte
+}
+
+func (e *aesZipEncrypter) Write(p []byte) (int, error) {
+	if cap(e.buf) < len(p) {
+		e.buf = make([]byte, len(p))
+	}
+	buf := e.buf[:len(p)]
+	e.ctr.XORKeyStream(buf, p)
+	e.mac.Write(buf)
+	if _, err := e.w.Write(buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (e *aesZipEncrypter) Close() error {
+	_, err := e.w.Write(e.mac.Sum(nil)[:aesMacSize])
+	return err
+}
+
+// aesZipDecrypter 解密并在数据结束时校验认证码
+type aesZipDecrypter struct {
+	r   io.Reader
+	tag io.Reader
+	ctr *aesCtr
+	mac hash.Hash
+	err error
+}
+
+func (d *aesZipDecrypter) Read(p []byte) (int, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	n, err := d.r.Read(p)
+	d.mac.Write(p[:n])
+	d.ctr.XORKeyStream(p[:n], p[:n])
+	if err == io.EOF {
+		tag := make([]byte, aesMacSize)
+		if _, e := io.ReadFull(d.tag, tag); e != nil {
+			err = errors.New("读取zip文件认证码失败 => " + e.Error())
+		} else if !hmac.Equal(tag, d.mac.Sum(nil)[:aesMacSize]) {
+			err = errors.New("zip文件认证码校验失败, 数据已损坏或被篡改")
+		}
+	}
+	d.err = err
+	return n, err
+}
+
+// aesZipReader 解密并解压WinZip AES加密的文件, 首次读取时校验密码
+type aesZipReader struct {
+	r        io.Reader
+	password []byte
+	strength AesStrength
+	method   uint16
+	size     uint64
+	dec      *aesZipDecrypter
+	out      io.Reader
+	closer   io.Closer
+	err      error
+}
+
+func (a *aesZipReader) init() error {
+	salt := make([]byte, a.strength.saltSize())
+	verifier := make([]byte, 2)
+	if _, err := io.ReadFull(a.r, salt); err != nil {
+		return errors.New("读取zip加密盐值失败 => " + err.Error())
+	}
+	if _, err := io.ReadFull(a.r, verifier); err != nil {
+		return errors.New("读取zip密码校验值失败 => " + err.Error())
+	}
+	encKey, macKey, expected := aesZipKeys(a.password, salt, a.strength)
+	if !hmac.Equal(verifier, expected) {
+		return ErrWrongPassword
+	}
+	overhead := uint64(len(salt) + len(verifier) + aesMacSize)
+	if a.size < overhead {
+		return errors.New("zip加密数据长度错误")
+	}
+	ctr, err := newAesCtr(encKey)
+	if err != nil {
+		return err
+	}
+	a.dec = &aesZipDecrypter{
+		r:   io.LimitReader(a.r, int64(a.size-overhead)),
+		tag: a.r,
+		ctr: ctr,
+		mac: hmac.New(sha1.New, macKey),
+	}
+	switch a.method {
+	case zip.Store:
+		a.out = a.dec
+	case zip.Deflate:
+		fr := flate.NewReader(a.dec)
+		a.out, a.closer = fr, fr
+	default:
+		return errors.New("不支持的zip压缩方式")
+	}
+	return nil
+}
+
+func (a *aesZipReader) Read(p []byte) (int, error) {
+	if a.err != nil {
+		return 0, a.err
+	}
+	if a.out == nil {
+		if a.err = a.init(); a.err != nil {
+			return 0, a.err
+		}
+	}
+	n, err := a.out.Read(p)
+	if err == io.EOF {
+		// 解压流可能在读完密文之前结束, 读完剩余的数据以校验认证码
+		if _, e := io.Copy(ioutil.Discard, a.dec); e != nil {
+			err = e
+		}
+	}
+	if err != nil {
+		a.err = err
+	}
+	return n, err
+}
+
+func (a *aesZipReader) Close() error {
+	if a.closer != nil {
+		return a.closer.Close()
+	}
+	return nil
+}
+
+// parseAesExtra 从扩展字段中读取AE版本、加密强度与实际的压缩方式
+func parseAesExtra(extra []byte) (uint16, AesStrength, uint16, error) {
+	for len(extra) >= 4 {
+		tag := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		extra = extra[4:]
+		if size > len(extra) {
+			break
+		}
+		if tag == zipExtraAes && size >= 7 {
+			strength := AesStrength(extra[4])
+			if !strength.valid() {
+				return 0, 0, 0, errors.New("不支持的zip加密强度")
+			}
+			return binary.LittleEndian.Uint16(extra), strength, binary.LittleEndian.Uint16(extra[5:]), nil
+		}
+		extra = extra[size:]
+	}
+	return 0, 0, 0, errors.New("zip文件缺少WinZip AES加密信息")
+}
+
+// zipArchive 打开的zip文件, 保留底层文件以便直接读取加密条目的原始数据
+type zipArchive struct {
+	*zip.Reader
+	file *os.File
+}
+
+func openZipArchive(zipFile string) (*zipArchive, error) {
+	file, err := os.Open(zipFile)
+	if err != nil {
+		return nil, errors.New("打开压缩文件失败 => " + err.Error())
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, errors.New("读取压缩文件信息失败 => " + err.Error())
+	}
+	reader, err := zip.NewReader(file, stat.Size())
+	if err != nil {
+		file.Close()
+		return nil, errors.New("创建zip解压流失败 => " + err.Error())
+	}
+	return &zipArchive{Reader: reader, file: file}, nil
+}
+
+func (z *zipArchive) Close() error {
+	return z.file.Close()
+}
+
+// openZipFile 打开zip中的文件, WinZip AES加密的文件需要提供密码
+// 加密的文件直接从ra读取原始数据解密, 不在共享的zip.Reader上注册解压器, 可以并发打开
+func openZipFile(ra io.ReaderAt, f *zip.File, password string) (io.ReadCloser, error) {
+	if f.Flags&0x1 == 0 {
+		return f.Open()
+	}
+	if f.Method != zipMethodAes {
+		return nil, errors.New("不支持的zip加密方式, 仅支持WinZip AES")
+	}
+	version, strength, method, err := parseAesExtra(f.Extra)
+	if err != nil {
+		return nil, err
+	}
+	if password == "" {
+		return nil, ErrPasswordRequired
+	}
+	if f.CompressedSize64 > maxZipSize {
+		return nil, errors.New("zip加密数据长度错误")
+	}
+	offset, err := f.DataOffset()
+	if err != nil {
+		return nil, errors.New("读取zip文件数据位置失败 => " + err.Error())
+	}
+	size := f.CompressedSize64
+	reader := &aesZipReader{r: io.NewSectionReader(ra, offset, int64(size)), password: []byte(password), strength: strength, method: method, size: size}
+	if version == 1 {
+		// AE-1同时保存CRC, AE-2的CRC为0, 内容仅由认证码校验
+		return &zipCrcReader{ReadCloser: reader, crc: crc32.NewIEEE(), expect: f.CRC32}, nil
+	}
+	return reader, nil
+}
+
+// zipCrcReader 读取结束时校验CRC
+type zipCrcReader struct {
+	io.ReadCloser
+	crc    hash.Hash32
+	expect uint32
+}
+
+func (z *zipCrcReader) Read(p []byte) (int, error) {
+	n, err := z.ReadCloser.Read(p)
+	z.crc.Write(p[:n])
+	if err == io.EOF && z.crc.Sum32() != z.expect {
+		return n, errors.New("zip文件CRC校验失败")
+	}
+	return n, err
+}
+
+// zipArchiveWriter 写入zip条目, 由zip.Writer与aesZipWriter实现
+type zipArchiveWriter interface {
+	CreateHeader(fh *zip.FileHeader) (io.Writer, error)
+	Close() error
+}
+
+// countWriter 统计已写出的字节数
+type countWriter struct {
+	w io.Writer
+	n uint64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += uint64(n)
+	return n, err
+}
+
+// leBuf 按小端序写入zip结构
+type leBuf []byte
+
+func (b *leBuf) uint16(v uint16) {
+	*b = append(*b, byte(v), byte(v>>8))
+}
+
+func (b *leBuf) uint32(v uint32) {
+	*b = append(*b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func (b *leBuf) uint64(v uint64) {
+	b.uint32(uint32(v))
+	b.uint32(uint32(v >> 32))
+}
+
+// msDosTime 转换为zip中的MS-DOS日期与时间
+func msDosTime(t time.Time) (uint16, uint16) {
+	if t.Year() < 1980 {
+		t = time.Date(1980, 1, 1, 0, 0, 0, 0, t.Location())
+	}
+	date := uint16(t.Day() + int(t.Month())<<5 + (t.Year()-1980)<<9)
+	clock := uint16(t.Second()/2 + t.Minute()<<5 + t.Hour()<<11)
+	return date, clock
+}
+
+// aesZipWriter 写入WinZip AES(AE-2)加密的zip, 目录项不加密
+// AE-2要求CRC为0以避免泄露明文信息, 标准库写入时总会填写CRC, 因此自行写入zip结构
+type aesZipWriter struct {
+	cw       *countWriter
+	password []byte
+	strength AesStrength
+	level    int
+	dir      []*aesZipHeader
+	last     *aesZipFileWriter
+	closed   bool
+}
+
+type aesZipHeader struct {
+	*zip.FileHeader
+	offset uint64
+}
+
+func newAesZipWriter(w io.Writer, password []byte, strength AesStrength, level int) *aesZipWriter {
+	if !strength.valid() {
+		strength = Aes256
+	}
+	if level == 0 {
+		level = flate.DefaultCompression
+	}
+	return &aesZipWriter{cw: &countWriter{w: w}, password: password, strength: strength, level: level}
+}
+
+func (a *aesZipWriter) closeLast() error {
+	if a.last == nil {
+		return nil
+	}
+	err := a.last.close()
+	a.last = nil
+	return err
+}
+
+// CreateHeader 写入条目头信息, 返回写入文件内容的io.Writer, 在下一次CreateHeader或Close之前有效
+func (a *aesZipWriter) CreateHeader(fh *zip.FileHeader) (io.Writer, error) {
+	if a.closed {
+		return nil, errors.New("zip已关闭")
+	}
+	if err := a.closeLast(); err != nil {
+		return nil, err
+	}
+	h := &aesZipHeader{FileHeader: fh, offset: a.cw.n}
+	fh.CRC32 = 0
+	fh.CompressedSize64, fh.UncompressedSize64 = 0, 0
+	fh.CompressedSize, fh.UncompressedSize = 0, 0
+	fh.Flags &^= 0x1 | 0x8
+	if !isASCII(fh.Name) && utf8.ValidString(fh.Name) {
+		fh.Flags |= 0x800
+	}
+	var extra leBuf
+	if !fh.Modified.IsZero() {
+		fh.ModifiedDate, fh.ModifiedTime = msDosTime(fh.Modified)
+		extra.uint16(zipExtraTime)
+		extra.uint16(5)
+		extra = append(extra, 1)
+		extra.uint32(uint32(fh.Modified.Unix()))
+	}
+
+	isDir := strings.HasSuffix(fh.Name, "/")
+	if isDir {
+		fh.Method = zip.Store
+		fh.ReaderVersion = 20
+	} else {
+		extra.uint16(zipExtraAes)
+		extra.uint16(7)
+		extra.uint16(2)
+		extra = append(extra, 'A', 'E', byte(a.strength))
+		extra.uint16(fh.Method)
+		fh.Flags |= 0x1 | 0x8
+		fh.Method = zipMethodAes
+		fh.ReaderVersion = 51
+	}
+	fh.CreatorVersion = fh.CreatorVersion&0xff00 | fh.ReaderVersion
+	fh.Extra = append(fh.Extra, extra...)
+
+	var buf leBuf
+	buf.uint32(0x04034b50)
+	buf.uint16(fh.ReaderVersion)
+	buf.uint16(fh.Flags)
+	buf.uint16(fh.Method)
+	buf.uint16(fh.ModifiedTime)
+	buf.uint16(fh.ModifiedDate)
+	buf.uint32(0)
+	buf.uint32(0)
+	buf.uint32(0)
+	buf.uint16(uint16(len(fh.Name)))
+	buf.uint16(uint16(len(fh.Extra)))
+	buf = append(buf, fh.Name...)
+	buf = append(buf, fh.Extra...)
+	if _, err := a.cw.Write(buf); err != nil {
+		return nil, err
+	}
+	a.dir = append(a.dir, h)
+	if isDir {
+		return dirWriter{}, nil
+	}
+
+	fw, err := a.newFileWriter(h)
+	if err != nil {
+		return nil, err
+	}
+	a.last = fw
+	return fw, nil
+}
+
+func (a *aesZipWriter) newFileWriter(h *aesZipHeader) (*aesZipFileWriter, error) {
+	salt := make([]byte, a.strength.saltSize())
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, errors.New("生成zip加密盐值失败 => " + err.Error())
+	}
+	encKey, macKey, verifier := aesZipKeys(a.password, salt, a.strength)
+	ctr, err := newAesCtr(encKey)
+	if err != nil {
+		return nil, err
+	}
+	raw := &countWriter{w: a.cw}
+	if _, err = raw.Write(append(salt, verifier...)); err != nil {
+		return nil, err
+	}
+	fw := &aesZipFileWriter{
+		h:   h,
+		raw: raw,
+		enc: &aesZipEncrypter{w: raw, ctr: ctr, mac: hmac.New(sha1.New, macKey)},
+	}
+	_, _, method, _ := parseAesExtra(h.Extra)
+	if method == zip.Deflate {
+		if fw.comp, err = flate.NewWriter(fw.enc, a.level); err != nil {
+			return nil, errors.New("创建deflate压缩流失败 => " + err.Error())
+		}
+	} else if method != zip.Store {
+		return nil, errors.New("不支持的zip压缩方式")
+	}
+	return fw, nil
+}
+
+// Close 写入zip目录, 不会关闭底层的io.Writer
+func (a *aesZipWriter) Close() error {
+	if a.closed {
+		return errors.New("zip已关闭")
+	}
+	if err := a.closeLast(); err != nil {
+		return err
+	}
+	a.closed = true
+
+	start := a.cw.n
+	for _, h := range a.dir {
+		if err := a.writeCentral(h); err != nil {
+			return err
+		}
+	}
+	end := a.cw.n
+
+	records, size, offset := uint64(len(a.dir)), end-start, start
+	var buf leBuf
+	if records >= uint16max || size >= uint32max || offset >= uint32max {
+		buf.uint32(0x06064b50)
+		buf.uint64(44)
+		buf.uint16(45)
+		buf.uint16(45)
+		buf.uint32(0)
+		buf.uint32(0)
+		buf.uint64(records)
+		buf.uint64(records)
+		buf.uint64(size)
+		buf.uint64(offset)
+		buf.uint32(0x07064b50)
+		buf.uint32(0)
+		buf.uint64(end)
+		buf.uint32(1)
+		records, size, offset = uint16max, uint32max, uint32max
+	}
+	buf.uint32(0x06054b50)
+	buf.uint16(0)
+	buf.uint16(0)
+	buf.uint16(uint16(records))
+	buf.uint16(uint16(records))
+	buf.uint32(uint32(size))
+	buf.uint32(uint32(offset))
+	buf.uint16(0)
+	_, err := a.cw.Write(buf)
+	return err
+}
+
+func (a *aesZipWriter) writeCentral(h *aesZipHeader) error {
+	fh := h.FileHeader
+	extra := fh.Extra
+	compressed, uncompressed, offset := uint32(fh.CompressedSize64), uint32(fh.UncompressedSize64), uint32(h.offset)
+	if fh.CompressedSize64 >= uint32max || fh.UncompressedSize64 >= uint32max || h.offset >= uint32max {
+		var zip64 leBuf
+		zip64.uint16(zipExtraZip64)
+		zip64.uint16(24)
+		zip64.uint64(fh.UncompressedSize64)
+		zip64.uint64(fh.CompressedSize64)
+		zip64.uint64(h.offset)
+		extra = append(zip64, extra...)
+		compressed, uncompressed, offset = uint32max, uint32max, uint32max
+		if fh.ReaderVersion < 45 {
+			fh.ReaderVersion = 45
+		}
+	}
+	var buf leBuf
+	buf.uint32(0x02014b50)
+	buf.uint16(fh.CreatorVersion)
+	buf.uint16(fh.ReaderVersion)
+	buf.uint16(fh.Flags)
+	buf.uint16(fh.Method)
+	buf.uint16(fh.ModifiedTime)
+	buf.uint16(fh.ModifiedDate)
+	buf.uint32(0)
+	buf.uint32(compressed)
+	buf.uint32(uncompressed)
+	buf.uint16(uint16(len(fh.Name)))
+	buf.uint16(uint16(len(extra)))
+	buf.uint16(uint16(len(fh.Comment)))
+	buf.uint16(0)
+	buf.uint16(0)
+	buf.uint32(fh.ExternalAttrs)
+	buf.uint32(offset)
+	buf = append(buf, fh.Name...)
+	buf = append(buf, extra...)
+	buf = append(buf, fh.Comment...)
+	_, err := a.cw.Write(buf)
+	return err
+}
+
+// aesZipFileWriter 写入加密文件的内容, 关闭时写入认证码与数据描述符
+type aesZipFileWriter struct {
+	h      *aesZipHeader
+	raw    *countWriter
+	enc    *aesZipEncrypter
+	comp   io.WriteCloser
+	size   uint64
+	closed bool
+}
+
+func (f *aesZipFileWriter) Write(p []byte) (int, error) {
+	if f.closed {
+		return 0, errors.New("zip条目已关闭")
+	}
+	f.size += uint64(len(p))
+	if f.comp != nil {
+		return f.comp.Write(p)
+	}
+	return f.enc.Write(p)
+}
+
+func (f *aesZipFileWriter) close() error {
+	f.closed = true
+	if f.comp != nil {
+		if err := f.comp.Close(); err != nil {
+			return err
+		}
+	}
+	if err := f.enc.Close(); err != nil {
+		return err
+	}
+	fh := f.h.FileHeader
+	fh.CompressedSize64, fh.UncompressedSize64 = f.raw.n, f.size
+	fh.CompressedSize, fh.UncompressedSize = uint32(f.raw.n), uint32(f.size)
+
+	var buf leBuf
+	buf.uint32(0x08074b50)
+	buf.uint32(0)
+	if fh.CompressedSize64 >= uint32max || fh.UncompressedSize64 >= uint32max {
+		fh.CompressedSize, fh.UncompressedSize = uint32max, uint32max
+		buf.uint64(fh.CompressedSize64)
+		buf.uint64(fh.UncompressedSize64)
+	} else {
+		buf.uint32(fh.CompressedSize)
+		buf.uint32(fh.UncompressedSize)
+	}
+	_, err := f.raw.w.Write(buf)
+	return err
+}
+
+// dirWriter 目录项没有内容
+type dirWriter struct{}
+
+func (dirWriter) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		return 0, errors.New("zip目录项不能写入内容")
+	}
+	return 0, nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,174 @@
+package compress
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// aesZipData 由libarchive生成的AES-256加密zip, 密码为secret, small.txt为AE-2, nums.txt为AE-1
+const aesZipData = "UEsDBBQACQBjANRCU10AAAAAAAAAAAAAAAAJACsAc21hbGwudHh0dXgLAAEEAAAAAAQAAAAAAZkHAAIAQUUDCABVVA0AB1DT1WpQ09VqUNPVahwvqG/Pw8l9v7KlRoYyaD/taTSnU5ay9IRAD25+HHzAGFBLBwgAAAAAIQAAAAMAAABQSwMEFAAJAGMA1EJTXQAAAAAAAAAAAAAAAAgAKwBudW1zLnR4dHV4CwABBAAAAAAEAAAAAAGZBwABAEFFAwgAVVQNAAdQ09VqUNPValDT1WqgLkEieiS0MAYsPmyp/C68CdA2npzsPPvgB/yK+HPcoc8AewYadC5DihyAd0b6X8X+ysXoC8ji/TuuY91lpzorJWBC2hiEaKIobS/ZSGf7NVcBVhfzYGFGEBSYLKcasyUsWCWFXuoo+v28Q1Vppq4MGlJ39kwiQ/WPbNczKBPvuEzl6AR8BQ+8CeXIitzDjY36umkF6muysorJlOrr1OLKFT49givDVb5t1lBLBwjc8YtnqgAAACQBAABQSwECFAMUAAkAYwDUQlNdAAAAACEAAAADAAAACQAjAAAAAAAAAAAApIEAAAAAc21hbGwudHh0dXgLAAEEAAAAAAQAAAAAAZkHAAIAQUUDCABVVAUAAVDT1WpQSwECFAMUAAkAYwDUQlNd3PGLZ6oAAAAkAQAACAAjAAAAAAAAAAAApIGDAAAAbnVtcy50eHR1eAsAAQQAAAAABAAAAAABmQcAAQBBRQMIAFVUBQABUNPValBLBQYAAAAAAgACALMAAACOAQAAAAA="
+
+func TestAesZip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aeszip-test")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src")
+	writeTestTree(t, src)
+	big := bytes.Repeat([]byte("0123456789abcdef"), 64*1024)
+	if err = ioutil.WriteFile(filepath.Join(src, "lib/big.bin"), big, 0644); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	for _, strength := range []AesStrength{Aes128, Aes192, Aes256} {
+		zipFile := filepath.Join(dir, "app.zip")
+		err = Zip(src, zipFile, &ZipOptions{Password: "secret", Strength: strength, Store: []string{"*.jar"}})
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		data, err := ioutil.ReadFile(zipFile)
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		if bytes.Contains(data, []byte("name=app")) {
+			t.Error("加密后的压缩包中不应当包含明文")
+		}
+
+		if err = Extract(zipFile, filepath.Join(dir, "nopass"), nil); err != ErrPasswordRequired {
+			t.Errorf("未提供密码时应当返回ErrPasswordRequired: %v", err)
+		}
+		if err = Extract(zipFile, filepath.Join(dir, "wrong"), &ExtractOptions{Password: "wrong"}); err != ErrWrongPassword {
+			t.Errorf("密码错误时应当返回ErrWrongPassword: %v", err)
+		}
+		dest := filepath.Join(dir, "out")
+		if err = Extract(zipFile, dest, &ExtractOptions{Password: "secret"}); err != nil {
+			t.Error(err.Error())
+			return
+		}
+		content, err := ioutil.ReadFile(filepath.Join(dest, "lib/big.bin"))
+		if err != nil || !bytes.Equal(content, big) {
+			t.Error("解压后的文件内容不一致")
+		}
+		stat, err := os.Stat(filepath.Join(dest, "bin/run.sh"))
+		if err != nil || stat.Mode().Perm() != 0755 {
+			t.Error("文件权限未保留")
+		}
+		if _, err = os.Stat(filepath.Join(dest, "empty")); err != nil {
+			t.Error("空目录未解压")
+		}
+		_ = os.RemoveAll(dest)
+	}
+}
+
+func TestAesZipTampered(t *testing.T) {
+	var buf bytes.Buffer
+	writer := NewZipWriter(&buf, &ZipOptions{Password: "secret"})
+	if err := writer.AddReader("a.txt", bytes.NewReader(bytes.Repeat([]byte("a"), 1000)), 0644, defaultDeterministicTime, 0); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if err := writer.Close(); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	data := buf.Bytes()
+	// 修改密文的最后一个字节, 位于认证码与数据描述符之前
+	end := bytes.Index(data, []byte("PK\x07\x08"))
+	data[end-aesMacSize-1] ^= 0xff
+
+	dir, err := ioutil.TempDir("", "aeszip-test")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+	if err = ExtractReader(bytes.NewReader(data), dir, &ExtractOptions{Password: "secret"}); err == nil {
+		t.Error("被篡改的数据应当解压失败")
+	}
+}
+
+func TestAesZipInterop(t *testing.T) {
+	data, _ := base64.StdEncoding.DecodeString(aesZipData)
+	dir, err := ioutil.TempDir("", "aeszip-test")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+	if err = ExtractReader(bytes.NewReader(data), dir, &ExtractOptions{Password: "secret"}); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	content, err := ioutil.ReadFile(filepath.Join(dir, "small.txt"))
+	if err != nil || string(content) != "hi\n" {
+		t.Error("解压后的文件内容不一致")
+	}
+	content, err = ioutil.ReadFile(filepath.Join(dir, "nums.txt"))
+	if err != nil || len(content) != 292 || !bytes.HasSuffix(content, []byte("99\n100\n")) {
+		t.Error("解压后的文件内容不一致")
+	}
+}
+
+func TestAesZipConcurrentOpen(t *testing.T) {
+	data, _ := base64.StdEncoding.DecodeString(aesZipData)
+	dir, err := ioutil.TempDir("", "aeszip-test")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+	zipFile := filepath.Join(dir, "interop.zip")
+	if err = ioutil.WriteFile(zipFile, data, 0644); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	zipReader, err := openZipArchive(zipFile)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer zipReader.Close()
+
+	// 同一个zip.Reader上并发打开加密条目, 使用不同的密码互不影响
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		for _, f := range zipReader.File {
+			password := "secret"
+			if i%2 == 1 {
+				password = "wrong"
+			}
+			wg.Add(1)
+			go func(f *zip.File, password string) {
+				defer wg.Done()
+				reader, err := openZipFile(zipReader.file, f, password)
+				if err != nil {
+					t.Error(err.Error())
+					return
+				}
+				defer reader.Close()
+				content, err := ioutil.ReadAll(reader)
+				if password == "wrong" {
+					if err != ErrWrongPassword {
+						t.Errorf("%s: 密码错误时应当返回ErrWrongPassword: %v", f.Name, err)
+					}
+					return
+				}
+				if err != nil || int64(len(content)) != int64(f.UncompressedSize64) {
+					t.Errorf("%s: 读取的内容不一致 %v", f.Name, err)
+				}
+			}(f, password)
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,131 @@
+package compress
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Archive 压缩文件或目录, 格式由destFile的扩展名决定, 如.tar.zst、.tar.xz、.zip
+func Archive(srcPath, destFile string) error {
+	format := FormatByName(destFile)
+	if format == FormatUnknown {
+		return errors.New("无法根据文件名识别压缩格式: " + destFile)
+	}
+	_ = os.RemoveAll(destFile)
+	file, err := os.Create(destFile)
+	if err != nil {
+		return errors.New("创建压缩文件失败 => " + err.Error())
+	}
+	defer file.Close()
+	if err = ArchiveTo(file, srcPath, format); err != nil {
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return errors.New("关闭压缩文件失败 => " + err.Error())
+	}
+	return nil
+}
+
+// ArchiveTo 压缩文件或目录并写入w, zip格式时srcPath必须为目录
+func ArchiveTo(w io.Writer, srcPath string, format Format) error {
+	if format != FormatZip {
+		compressWriter, err := NewWriter(format, w)
+		if err != nil {
+			return err
+		}
+		return writeTar(compressWriter, newProgressTracker(nil, nil), func(a *tarArchiver) error {
+			return a.addRoot(srcPath)
+		})
+	}
+	writer := NewZipWriter(w, nil)
+	if err := writer.AddTree(srcPath, ""); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+// Extract 解压压缩包, 格式由文件内容识别, opts为nil时使用安全模式
+// 加密的zip与SM4-GCM压缩包使用opts中的Password或Sm4Key解密
+func Extract(archiveFile, destDir string, opts *ExtractOptions) error {
+	return ExtractContext(context.Background(), archiveFile, destDir, opts)
+}
+
+// ExtractContext 解压压缩包, ctx取消时停止解压并返回ctx.Err()
+func ExtractContext(ctx context.Context, archiveFile, destDir string, opts *ExtractOptions) error {
+	format, err := DetectFile(archiveFile)
+	if err != nil {
+		return err
+	}
+	if format == FormatZip {
+		return UnzipContext(ctx, archiveFile, destDir, opts)
+	}
+	file, err := os.Open(archiveFile)
+	if err != nil {
+		return errors.New("打开压缩文件失败 => " + err.Error())
+	}
+	defer file.Close()
+	return extractTar(newProgressTracker(ctx, opts.progress()), format, file, destDir, opts)
+}
+
+// ExtractReader 从流中解压压缩包, 格式由内容识别, zip格式需要先缓存到临时文件
+func ExtractReader(r io.Reader, destDir string, opts *ExtractOptions) error {
+	return ExtractReaderContext(context.Background(), r, destDir, opts)
+}
+
+// ExtractReaderContext 从流中解压压缩包, ctx取消时停止解压并返回ctx.Err()
+func ExtractReaderContext(ctx context.Context, r io.Reader, destDir string, opts *ExtractOptions) error {
+	format, r, err := Detect(r)
+	if err != nil {
+		return err
+	}
+	if format != FormatZip {
+		return extractTar(newProgressTracker(ctx, opts.progress()), format, r, destDir, opts)
+	}
+
+	tmpFile, err := ioutil.TempFile("", "unzip*")
+	if err != nil {
+		return errors.New("创建临时文件失败 => " + err.Error())
+	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+	if _, err = io.Copy(tmpFile, newProgressTracker(ctx, nil).reader(r)); err != nil {
+		return wrapError("缓存压缩数据失败", err)
+	}
+	if err = tmpFile.Close(); err != nil {
+		return errors.New("缓存压缩数据失败 => " + err.Error())
+	}
+	return UnzipContext(ctx, tmpFile.Name(), destDir, opts)
+}
+
+func extractTar(tracker *progressTracker, format Format, r io.Reader, destDir string, opts *ExtractOptions) error {
+	if format == FormatUnknown {
+		return errors.New("无法识别的压缩格式")
+	}
+	if format == FormatSm4Gcm {
+		return extractSm4(tracker, r, destDir, opts)
+	}
+	if err := tracker.check(); err != nil {
+		return err
+	}
+	reader, err := NewReader(format, tracker.reader(r))
+	if err != nil {
+		return wrapError("创建解压流失败", err)
+	}
+	defer reader.Close()
+	return untar(tracker, reader, destDir, opts)
+}
+
+// OpenArchiveFS 打开压缩包作为只读文件系统, 格式由文件内容识别
+func OpenArchiveFS(archiveFile string) (ArchiveFS, error) {
+	format, err := DetectFile(archiveFile)
+	if err != nil {
+		return nil, err
+	}
+	if format == FormatZip {
+		return OpenZipFS(archiveFile)
+	}
+	return openTarFS(archiveFile, format)
+}
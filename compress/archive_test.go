@@ -0,0 +1,105 @@
+package compress
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// bzip2TarData 包含hello.txt的tar.bz2
+const bzip2TarData = "QlpoOTFBWSZTWT9NfZYAAHV7gMoQAQBAAX+AAIByZN5QCAggAHUNU2UNNGIHpA002oJKaIAaAAAfdUDIQSwSEPcIRHm2cg0jIEOUWOCyAnsFgz3MA2lGaJhewzQmk9xjZ/YWSzFAKe1VfqxW5JB+LuSKcKEgfpr7LA=="
+
+func TestArchiveExtract(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive-test")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src")
+	writeTestTree(t, src)
+
+	for name, format := range map[string]Format{
+		"app.tar":     FormatTar,
+		"app.tar.gz":  FormatGzip,
+		"app.tar.zst": FormatZstd,
+		"app.txz":     FormatXz,
+		"app.tar.lz4": FormatLz4,
+		"app.zip":     FormatZip,
+	} {
+		archiveFile := filepath.Join(dir, name)
+		if err = Archive(src, archiveFile); err != nil {
+			t.Errorf("%s: %s", name, err.Error())
+			continue
+		}
+		detected, err := DetectFile(archiveFile)
+		if err != nil || detected != format {
+			t.Errorf("%s: 识别的格式为 %s", name, detected)
+			continue
+		}
+
+		dest := filepath.Join(dir, "dest-"+name)
+		if err = Extract(archiveFile, dest, nil); err != nil {
+			t.Errorf("%s: %s", name, err.Error())
+			continue
+		}
+		content, err := ioutil.ReadFile(filepath.Join(dest, "conf/app.properties"))
+		if err != nil || string(content) != "name=app\n" {
+			t.Errorf("%s: 解压后的文件内容不一致", name)
+		}
+
+		data, _ := ioutil.ReadFile(archiveFile)
+		dest = filepath.Join(dir, "reader-"+name)
+		if err = ExtractReader(bytes.NewReader(data), dest, nil); err != nil {
+			t.Errorf("%s: %s", name, err.Error())
+			continue
+		}
+		if _, err = os.Stat(filepath.Join(dest, "bin/run.sh")); err != nil {
+			t.Errorf("%s: 从流中解压失败", name)
+		}
+
+		archiveFS, err := OpenArchiveFS(archiveFile)
+		if err != nil {
+			t.Errorf("%s: %s", name, err.Error())
+			continue
+		}
+		content, err = fs.ReadFile(archiveFS, "lib/app.jar")
+		archiveFS.Close()
+		if err != nil || string(content) != "jar content" {
+			t.Errorf("%s: 读取压缩包内文件失败", name)
+		}
+	}
+
+	if err = Archive(src, filepath.Join(dir, "app.tar.bz2")); err == nil {
+		t.Error("bzip2不支持压缩, 应当返回错误")
+	}
+	if err = Archive(src, filepath.Join(dir, "app.rar")); err == nil {
+		t.Error("无法识别的格式应当返回错误")
+	}
+}
+
+func TestExtractBzip2(t *testing.T) {
+	data, _ := base64.StdEncoding.DecodeString(bzip2TarData)
+	if format := DetectBytes(data); format != FormatBzip2 {
+		t.Errorf("识别的格式为 %s", format)
+		return
+	}
+	dir, err := ioutil.TempDir("", "archive-test")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+	if err = ExtractReader(bytes.NewReader(data), dir, nil); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	content, err := ioutil.ReadFile(filepath.Join(dir, "hello.txt"))
+	if err != nil || string(content) != "hello bzip2\n" {
+		t.Error("解压后的文件内容不一致")
+	}
+}
@@ -0,0 +1,212 @@
+package compress
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/ulikunitz/xz"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Format 压缩格式
+type Format int
+
+const (
+	// FormatUnknown 无法识别的格式
+	FormatUnknown Format = iota
+	// FormatTar 未压缩的tar
+	FormatTar
+	// FormatGzip gzip, 用于tar.gz
+	FormatGzip
+	// FormatZstd zstd, 用于tar.zst
+	FormatZstd
+	// FormatXz xz, 用于tar.xz
+	FormatXz
+	// FormatBzip2 bzip2, 用于tar.bz2, 仅支持解压
+	FormatBzip2
+	// FormatLz4 lz4 frame, 用于tar.lz4
+	FormatLz4
+	// FormatZip zip
+	FormatZip
+	// FormatSm4Gcm SM4-GCM加密的压缩包, 需要通过NewSm4GcmReader解密
+	FormatSm4Gcm
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatTar:
+		return "tar"
+	case FormatGzip:
+		return "gzip"
+	case FormatZstd:
+		return "zstd"
+	case FormatXz:
+		return "xz"
+	case FormatBzip2:
+		return "bzip2"
+	case FormatLz4:
+		return "lz4"
+	case FormatZip:
+		return "zip"
+	case FormatSm4Gcm:
+		return "sm4-gcm"
+	default:
+		return "unknown"
+	}
+}
+
+var formatMagics = []struct {
+	format Format
+	magic  []byte
+}{
+	{FormatGzip, []byte{0x1f, 0x8b}},
+	{FormatZstd, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{FormatXz, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+	{FormatBzip2, []byte("BZh")},
+	{FormatLz4, []byte{0x04, 0x22, 0x4d, 0x18}},
+	{FormatZip, []byte("PK\x03\x04")},
+	{FormatZip, []byte("PK\x05\x06")},
+	{FormatSm4Gcm, sm4GcmMagic},
+}
+
+// detectSize 识别格式需要的数据长度, tar的ustar标识位于257字节处
+const detectSize = 262
+
+// DetectBytes 根据数据头识别压缩格式
+func DetectBytes(header []byte) Format {
+	for _, m := range formatMagics {
+		if bytes.HasPrefix(header, m.magic) {
+			return m.format
+		}
+	}
+	if len(header) >= detectSize && bytes.Equal(header[257:262], []byte("ustar")) {
+		return FormatTar
+	}
+	return FormatUnknown
+}
+
+// Detect 识别流的压缩格式, 返回的io.Reader包含已经读取的数据头, 需要代替r继续使用
+func Detect(r io.Reader) (Format, io.Reader, error) {
+	br := bufio.NewReaderSize(r, 1024)
+	header, err := br.Peek(detectSize)
+	if err != nil && err != io.EOF {
+		return FormatUnknown, nil, errors.New("读取数据头失败 => " + err.Error())
+	}
+	return DetectBytes(header), br, nil
+}
+
+// DetectFile 识别文件的压缩格式
+func DetectFile(fileName string) (Format, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return FormatUnknown, errors.New("打开文件失败 => " + err.Error())
+	}
+	defer file.Close()
+	header := make([]byte, detectSize)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return FormatUnknown, errors.New("读取数据头失败 => " + err.Error())
+	}
+	return DetectBytes(header[:n]), nil
+}
+
+// FormatByName 根据文件名识别压缩格式, 如app.tar.zst为FormatZstd, app.jar为FormatZip
+func FormatByName(fileName string) Format {
+	name := strings.ToLower(fileName)
+	switch {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return FormatGzip
+	case strings.HasSuffix(name, ".tar.zst"), strings.HasSuffix(name, ".tzst"):
+		return FormatZstd
+	case strings.HasSuffix(name, ".tar.xz"), strings.HasSuffix(name, ".txz"):
+		return FormatXz
+	case strings.HasSuffix(name, ".tar.bz2"), strings.HasSuffix(name, ".tbz2"):
+		return FormatBzip2
+	case strings.HasSuffix(name, ".tar.lz4"):
+		return FormatLz4
+	case strings.HasSuffix(name, ".tar"):
+		return FormatTar
+	case strings.HasSuffix(name, ".zip"), strings.HasSuffix(name, ".jar"):
+		return FormatZip
+	default:
+		return FormatUnknown
+	}
+}
+
+// NewReader 创建解压流, FormatTar原样返回, zip不是流式格式, 不支持
+func NewReader(format Format, r io.Reader) (io.ReadCloser, error) {
+	switch format {
+	case FormatTar:
+		return ioutil.NopCloser(r), nil
+	case FormatGzip:
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, errors.New("创建gzip解压流失败 => " + err.Error())
+		}
+		return gr, nil
+	case FormatZstd:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, errors.New("创建zstd解压流失败 => " + err.Error())
+		}
+		return zr.IOReadCloser(), nil
+	case FormatXz:
+		xr, err := xz.NewReader(r)
+		if err != nil {
+			return nil, errors.New("创建xz解压流失败 => " + err.Error())
+		}
+		return ioutil.NopCloser(xr), nil
+	case FormatBzip2:
+		return ioutil.NopCloser(bzip2.NewReader(r)), nil
+	case FormatLz4:
+		return ioutil.NopCloser(lz4.NewReader(r)), nil
+	default:
+		return nil, errors.New("不支持的解压格式: " + format.String())
+	}
+}
+
+// nopWriteCloser Close时不关闭底层的io.Writer
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// NewWriter 创建压缩流, Close时写入结尾但不会关闭w, FormatTar原样写入, bzip2仅支持解压
+func NewWriter(format Format, w io.Writer) (io.WriteCloser, error) {
+	switch format {
+	case FormatTar:
+		return nopWriteCloser{w}, nil
+	case FormatGzip:
+		gw, err := gzip.NewWriterLevel(w, 9)
+		if err != nil {
+			return nil, errors.New("创建gzip压缩流失败 => " + err.Error())
+		}
+		return gw, nil
+	case FormatZstd:
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return nil, errors.New("创建zstd压缩流失败 => " + err.Error())
+		}
+		return zw, nil
+	case FormatXz:
+		xw, err := xz.NewWriter(w)
+		if err != nil {
+			return nil, errors.New("创建xz压缩流失败 => " + err.Error())
+		}
+		return xw, nil
+	case FormatLz4:
+		return lz4.NewWriter(w), nil
+	default:
+		return nil, errors.New("不支持的压缩格式: " + format.String())
+	}
+}
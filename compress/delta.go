@@ -0,0 +1,644 @@
+package compress
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// TreeEntry 目录或压缩包中的条目
+type TreeEntry struct {
+	// Name 相对路径, 以/分隔
+	Name string `json:"name"`
+	// Type 条目类型, 仅包含EntryFile、EntryDir与EntrySymlink, 硬链接视为普通文件
+	Type EntryType `json:"type"`
+	// Size 文件大小
+	Size int64 `json:"size,omitempty"`
+	// Mode 权限
+	Mode os.FileMode `json:"mode"`
+	// Digest 文件内容的sha256摘要, 十六进制
+	Digest string `json:"digest,omitempty"`
+	// Link 符号链接的目标
+	Link string `json:"link,omitempty"`
+
+	// hardlink tar中的硬链接, 没有自己的内容
+	hardlink bool
+}
+
+// treeOpener 打开条目的内容
+type treeOpener func() (io.ReadCloser, error)
+
+// walkTree 依次访问目录或压缩包中的条目, 目录按名称顺序访问, 压缩包按条目顺序访问
+// 硬链接条目的Link为链接目标, open为nil
+func walkTree(root string, fn func(entry *TreeEntry, open treeOpener) error) error {
+	stat, err := os.Stat(root)
+	if err != nil {
+		return errors.New("读取文件信息失败 => " + err.Error())
+	}
+	if stat.IsDir() {
+		return walkDirTree(root, fn)
+	}
+	format, err := DetectFile(root)
+	if err != nil {
+		return err
+	}
+	if format == FormatZip {
+		return walkZipTree(root, fn)
+	}
+	return walkTarTree(root, format, fn)
+}
+
+func walkDirTree(root string, fn func(entry *TreeEntry, open treeOpener) error) error {
+	return filepath.Walk(root, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return errors.New("读取目录结构失败 => " + err.Error())
+		}
+		rel, err := filepath.Rel(root, filePath)
+		if err != nil {
+			return errors.New("计算相对路径失败 => " + err.Error())
+		}
+		if rel == "." {
+			return nil
+		}
+		entry := &TreeEntry{Name: filepath.ToSlash(rel), Mode: info.Mode().Perm()}
+		switch {
+		case info.IsDir():
+			entry.Type = EntryDir
+			return fn(entry, nil)
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(filePath)
+			if err != nil {
+				return errors.New("读取符号链接失败 => " + err.Error())
+			}
+			entry.Type, entry.Link = EntrySymlink, filepath.ToSlash(target)
+			return fn(entry, nil)
+		case info.Mode().IsRegular():
+			entry.Type, entry.Size = EntryFile, info.Size()
+			return fn(entry, func() (io.ReadCloser, error) {
+				return os.Open(filePath)
+			})
+		default:
+			return nil
+		}
+	})
+}
+
+func walkZipTree(zipFile string, fn func(entry *TreeEntry, open treeOpener) error) error {
+	zipReader, err := openZipArchive(zipFile)
+	if err != nil {
+		return err
+	}
+	defer zipReader.Close()
+	for _, f := range zipReader.File {
+		info := zipEntryInfo(f)
+		if info.Name == "" {
+			continue
+		}
+		entry := &TreeEntry{Name: info.Name, Type: info.Type, Mode: info.Mode.Perm()}
+		f := f
+		open := func() (io.ReadCloser, error) {
+			return openZipFile(zipReader.file, f, "")
+		}
+		switch info.Type {
+		case EntryDir:
+			open = nil
+		case EntrySymlink:
+			reader, err := open()
+			if err != nil {
+				return wrapError("读取符号链接失败", err)
+			}
+			target, err := ioutil.ReadAll(io.LimitReader(reader, 4096))
+			reader.Close()
+			if err != nil {
+				return wrapError("读取符号链接失败", err)
+			}
+			entry.Link, open = string(target), nil
+		case EntryFile:
+			entry.Size = info.Size
+		default:
+			continue
+		}
+		if err = fn(entry, open); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func walkTarTree(tarFile string, format Format, fn func(entry *TreeEntry, open treeOpener) error) error {
+	tr, closer, err := openTarReader(tarFile, format)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.New("读取压缩包内文件失败 => " + err.Error())
+		}
+		info := tarEntryInfo(hdr)
+		if info.Name == "" {
+			continue
+		}
+		entry := &TreeEntry{Name: info.Name, Type: info.Type, Mode: info.Mode.Perm()}
+		var open treeOpener
+		switch info.Type {
+		case EntryFile:
+			entry.Size = info.Size
+			open = func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(tr), nil
+			}
+		case EntrySymlink:
+			entry.Link = info.Linkname
+		case EntryHardlink:
+			entry.Type, entry.Link, entry.hardlink = EntryFile, info.Linkname, true
+		case EntryDir:
+		default:
+			continue
+		}
+		if err = fn(entry, open); err != nil {
+			return err
+		}
+	}
+}
+
+// digestReader 计算r中内容的sha256摘要
+func digestReader(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ScanTree 读取目录或压缩包中的全部条目并计算文件摘要, 结果按名称排序
+func ScanTree(root string) ([]*TreeEntry, error) {
+	var entries []*TreeEntry
+	files := make(map[string]*TreeEntry)
+	err := walkTree(root, func(entry *TreeEntry, open treeOpener) error {
+		if entry.hardlink {
+			target, ok := files[entry.Link]
+			if !ok {
+				return errors.New("硬链接的目标不存在: " + entry.Name)
+			}
+			entry.Size, entry.Digest, entry.Link = target.Size, target.Digest, ""
+		} else if open != nil {
+			reader, err := open()
+			if err != nil {
+				return wrapError("打开文件失败", err)
+			}
+			entry.Digest, err = digestReader(reader)
+			reader.Close()
+			if err != nil {
+				return wrapError("计算文件摘要失败", err)
+			}
+			files[entry.Name] = entry
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+	return entries, nil
+}
+
+// ChangeType 条目的变化类型
+type ChangeType int
+
+const (
+	// ChangeAdded 新增
+	ChangeAdded ChangeType = iota + 1
+	// ChangeRemoved 删除
+	ChangeRemoved
+	// ChangeModified 内容、类型、权限或链接目标发生变化
+	ChangeModified
+)
+
+func (c ChangeType) String() string {
+	switch c {
+	case ChangeAdded:
+		return "added"
+	case ChangeRemoved:
+		return "removed"
+	case ChangeModified:
+		return "modified"
+	default:
+		return "unknown"
+	}
+}
+
+// Change 两个版本之间一个条目的变化
+type Change struct {
+	// Name 条目名称
+	Name string `json:"name"`
+	// Type 变化类型
+	Type ChangeType `json:"type"`
+	// Old 旧版本中的条目, 新增时为nil
+	Old *TreeEntry `json:"old,omitempty"`
+	// New 新版本中的条目, 删除时为nil
+	New *TreeEntry `json:"new,omitempty"`
+}
+
+// DiffTrees 比较两个版本的条目, 结果按名称排序
+func DiffTrees(oldEntries, newEntries []*TreeEntry) []*Change {
+	oldByName := make(map[string]*TreeEntry, len(oldEntries))
+	for _, entry := range oldEntries {
+		oldByName[entry.Name] = entry
+	}
+	newByName := make(map[string]*TreeEntry, len(newEntries))
+	var changes []*Change
+	for _, entry := range newEntries {
+		newByName[entry.Name] = entry
+		old, ok := oldByName[entry.Name]
+		switch {
+		case !ok:
+			changes = append(changes, &Change{Name: entry.Name, Type: ChangeAdded, New: entry})
+		case old.Type != entry.Type || old.Digest != entry.Digest || old.Link != entry.Link ||
+			(entry.Type != EntrySymlink && old.Mode != entry.Mode):
+			changes = append(changes, &Change{Name: entry.Name, Type: ChangeModified, Old: old, New: entry})
+		}
+	}
+	for _, entry := range oldEntries {
+		if _, ok := newByName[entry.Name]; !ok {
+			changes = append(changes, &Change{Name: entry.Name, Type: ChangeRemoved, Old: entry})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+	return changes
+}
+
+// Diff 比较两个目录或压缩包, 按内容摘要判断文件是否变化
+func Diff(oldPath, newPath string) ([]*Change, error) {
+	oldEntries, err := ScanTree(oldPath)
+	if err != nil {
+		return nil, err
+	}
+	newEntries, err := ScanTree(newPath)
+	if err != nil {
+		return nil, err
+	}
+	return DiffTrees(oldEntries, newEntries), nil
+}
+
+const (
+	deltaVersion      = 1
+	deltaManifestName = "delta.json"
+	deltaObjectPrefix = "objects/"
+	// deltaManifestMax 差异包清单的大小上限
+	deltaManifestMax = 256 * 1024 * 1024
+)
+
+// deltaManifest 差异包清单, 记录新版本的完整目录树, 文件内容来自旧版本或差异包中的对象
+type deltaManifest struct {
+	Version int          `json:"version"`
+	Entries []*TreeEntry `json:"entries"`
+	// Sources 旧版本中内容相同的文件, key为摘要
+	Sources map[string]string `json:"sources"`
+	Changes []*Change         `json:"changes"`
+}
+
+// WriteDelta 生成从oldPath到newPath的差异包并写入w, 格式为tar.gz
+// 差异包按内容摘要保存旧版本中不存在的文件, 旧版本中已有的内容(包括移动、重命名的文件)不会重复写入
+func WriteDelta(w io.Writer, oldPath, newPath string) ([]*Change, error) {
+	oldEntries, err := ScanTree(oldPath)
+	if err != nil {
+		return nil, err
+	}
+	newEntries, err := ScanTree(newPath)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &deltaManifest{
+		Version: deltaVersion,
+		Entries: newEntries,
+		Sources: make(map[string]string),
+		Changes: DiffTrees(oldEntries, newEntries),
+	}
+	oldByDigest := make(map[string]string)
+	for _, entry := range oldEntries {
+		if entry.Type == EntryFile && !entry.hardlink {
+			if _, ok := oldByDigest[entry.Digest]; !ok {
+				oldByDigest[entry.Digest] = entry.Name
+			}
+		}
+	}
+	needed := make(map[string]bool)
+	newByName := make(map[string]*TreeEntry, len(newEntries))
+	for _, entry := range newEntries {
+		newByName[entry.Name] = entry
+		if entry.Type != EntryFile {
+			continue
+		}
+		if name, ok := oldByDigest[entry.Digest]; ok {
+			manifest.Sources[entry.Digest] = name
+		} else {
+			needed[entry.Digest] = true
+		}
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, errors.New("转换差异包清单失败 => " + err.Error())
+	}
+	compressWriter, err := NewWriter(FormatGzip, w)
+	if err != nil {
+		return nil, err
+	}
+	tw := tar.NewWriter(compressWriter)
+	err = func() error {
+		header := &tar.Header{Name: deltaManifestName, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg, ModTime: defaultDeterministicTime}
+		if err := tw.WriteHeader(header); err != nil {
+			return errors.New("写入差异包清单失败 => " + err.Error())
+		}
+		if _, err := tw.Write(data); err != nil {
+			return errors.New("写入差异包清单失败 => " + err.Error())
+		}
+		err := walkTree(newPath, func(entry *TreeEntry, open treeOpener) error {
+			scanned := newByName[entry.Name]
+			if open == nil || scanned == nil || !needed[scanned.Digest] {
+				return nil
+			}
+			reader, err := open()
+			if err != nil {
+				return wrapError("打开文件失败", err)
+			}
+			defer reader.Close()
+			header := &tar.Header{Name: deltaObjectPrefix + scanned.Digest, Mode: 0644, Size: scanned.Size, Typeflag: tar.TypeReg, ModTime: defaultDeterministicTime}
+			if err = tw.WriteHeader(header); err != nil {
+				return errors.New("写入差异包文件失败 => " + err.Error())
+			}
+			h := sha256.New()
+			if _, err = io.CopyN(tw, io.TeeReader(reader, h), scanned.Size); err != nil {
+				return errors.New("写入差异包文件失败 => " + err.Error())
+			}
+			if hex.EncodeToString(h.Sum(nil)) != scanned.Digest {
+				return errors.New("文件在生成差异包时被修改: " + entry.Name)
+			}
+			delete(needed, scanned.Digest)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if len(needed) > 0 {
+			return errors.New("生成差异包时缺少文件内容")
+		}
+		return tw.Close()
+	}()
+	if err != nil {
+		_ = compressWriter.Close()
+		return nil, err
+	}
+	if err = compressWriter.Close(); err != nil {
+		return nil, errors.New("关闭压缩流失败 => " + err.Error())
+	}
+	return manifest.Changes, nil
+}
+
+// CreateDelta 生成从oldPath到newPath的差异包文件, oldPath与newPath可以是目录或压缩包
+func CreateDelta(oldPath, newPath, deltaFile string) ([]*Change, error) {
+	_ = os.RemoveAll(deltaFile)
+	file, err := os.Create(deltaFile)
+	if err != nil {
+		return nil, errors.New("创建差异包文件失败 => " + err.Error())
+	}
+	changes, err := WriteDelta(file, oldPath, newPath)
+	if err != nil {
+		file.Close()
+		_ = os.Remove(deltaFile)
+		return nil, err
+	}
+	if err = file.Close(); err != nil {
+		return nil, errors.New("关闭差异包文件失败 => " + err.Error())
+	}
+	return changes, nil
+}
+
+// ApplyDelta 使用旧版本oldPath与差异包重建新版本到destDir, 每个文件都会校验摘要
+// oldPath可以是目录或压缩包, destDir必须不存在或为空目录, 失败时清理destDir中已写入的内容
+// opts中的Unsafe与MaxTotalSize、MaxFileSize、MaxEntries生效, 文件内容可能来自旧版本, 因此不检查MaxRatio, opts为nil时使用安全模式
+func ApplyDelta(oldPath, deltaFile, destDir string, opts *ExtractOptions) error {
+	file, err := os.Open(deltaFile)
+	if err != nil {
+		return errors.New("打开差异包文件失败 => " + err.Error())
+	}
+	defer file.Close()
+	return ApplyDeltaReader(oldPath, file, destDir, opts)
+}
+
+// ApplyDeltaReader 从流中读取差异包并重建新版本, 同ApplyDelta
+func ApplyDeltaReader(oldPath string, delta io.Reader, destDir string, opts *ExtractOptions) error {
+	_, statErr := os.Stat(destDir)
+	if statErr == nil {
+		children, err := ioutil.ReadDir(destDir)
+		if err != nil {
+			return errors.New("读取目标目录失败 => " + err.Error())
+		}
+		if len(children) > 0 {
+			return errors.New("目标目录不为空: " + destDir)
+		}
+	}
+	err := applyDelta(oldPath, delta, destDir, opts)
+	if err != nil {
+		if os.IsNotExist(statErr) {
+			_ = os.RemoveAll(destDir)
+		} else {
+			children, _ := ioutil.ReadDir(destDir)
+			for _, child := range children {
+				_ = os.RemoveAll(filepath.Join(destDir, child.Name()))
+			}
+		}
+	}
+	return err
+}
+
+// deltaApplier 将内容写入新版本中所有摘要相同的文件
+type deltaApplier struct {
+	e       *extractor
+	targets map[string][]*TreeEntry
+	done    map[string]bool
+}
+
+func (a *deltaApplier) write(digest string, r io.Reader) error {
+	targets := a.targets[digest]
+	if len(targets) == 0 || a.done[digest] {
+		return nil
+	}
+	h := sha256.New()
+	first := targets[0]
+	p, err := a.e.writeFile(first.Name, io.TeeReader(r, h), first.Mode)
+	if err != nil {
+		return wrapError("写入文件失败", err)
+	}
+	if hex.EncodeToString(h.Sum(nil)) != digest {
+		return errors.New("文件摘要校验失败, 旧版本与差异包不匹配: " + first.Name)
+	}
+	if err = a.e.setMeta(&entryMeta{path: p, mode: first.Mode}); err != nil {
+		return errors.New("还原文件属性失败 => " + err.Error())
+	}
+	for _, target := range targets[1:] {
+		src, err := os.Open(p)
+		if err != nil {
+			return errors.New("打开文件失败 => " + err.Error())
+		}
+		dest, err := a.e.writeFile(target.Name, src, target.Mode)
+		src.Close()
+		if err != nil {
+			return wrapError("写入文件失败", err)
+		}
+		if err = a.e.setMeta(&entryMeta{path: dest, mode: target.Mode}); err != nil {
+			return errors.New("还原文件属性失败 => " + err.Error())
+		}
+	}
+	a.done[digest] = true
+	return nil
+}
+
+func applyDelta(oldPath string, delta io.Reader, destDir string, opts *ExtractOptions) error {
+	format, delta, err := Detect(delta)
+	if err != nil {
+		return err
+	}
+	if format == FormatUnknown || format == FormatZip || format == FormatSm4Gcm {
+		return errors.New("差异包格式错误")
+	}
+	reader, err := NewReader(format, delta)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	tr := tar.NewReader(reader)
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != deltaManifestName {
+		return errors.New("差异包中缺少清单")
+	}
+	manifest := &deltaManifest{}
+	if err = json.NewDecoder(io.LimitReader(tr, deltaManifestMax)).Decode(manifest); err != nil {
+		return errors.New("解析差异包清单失败 => " + err.Error())
+	}
+	if manifest.Version != deltaVersion {
+		return errors.New("不支持的差异包版本")
+	}
+
+	limits := &ExtractOptions{}
+	if opts != nil {
+		limits = &ExtractOptions{Unsafe: opts.Unsafe, MaxTotalSize: opts.MaxTotalSize, MaxFileSize: opts.MaxFileSize, MaxEntries: opts.MaxEntries}
+	}
+	e, err := newExtractor(destDir, limits, newProgressTracker(nil, nil))
+	if err != nil {
+		return errors.New("创建目标目录失败 => " + err.Error())
+	}
+	// 清单不可信, 写入前按其中记录的条目数量与大小检查限制, 写入时再按实际大小检查
+	var total int64
+	for _, entry := range manifest.Entries {
+		size := int64(0)
+		if entry.Type == EntryFile && entry.Size > 0 {
+			size = entry.Size
+		}
+		if err = e.begin(entry.Name, size); err != nil {
+			return err
+		}
+		if total > math.MaxInt64-size {
+			total = math.MaxInt64
+		} else {
+			total += size
+		}
+	}
+	if err = limits.checkArchive(len(manifest.Entries), total); err != nil {
+		return err
+	}
+	if _, err = e.mkdir(""); err != nil {
+		return wrapError("创建目标目录失败", err)
+	}
+	a := &deltaApplier{e: e, targets: make(map[string][]*TreeEntry), done: make(map[string]bool)}
+	for _, entry := range manifest.Entries {
+		switch entry.Type {
+		case EntryDir:
+			p, err := e.mkdir(entry.Name)
+			if err != nil {
+				return wrapError("创建目录失败", err)
+			}
+			if err = e.setMeta(&entryMeta{path: p, mode: entry.Mode.Perm() | os.ModeDir}); err != nil {
+				return errors.New("还原目录属性失败 => " + err.Error())
+			}
+		case EntryFile:
+			a.targets[entry.Digest] = append(a.targets[entry.Digest], entry)
+		}
+	}
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.New("读取差异包失败 => " + err.Error())
+		}
+		if !strings.HasPrefix(hdr.Name, deltaObjectPrefix) {
+			continue
+		}
+		if err = a.write(strings.TrimPrefix(hdr.Name, deltaObjectPrefix), tr); err != nil {
+			return err
+		}
+	}
+
+	sources := make(map[string]string, len(manifest.Sources))
+	for digest, name := range manifest.Sources {
+		if !a.done[digest] {
+			sources[name] = digest
+		}
+	}
+	if len(sources) > 0 {
+		err = walkTree(oldPath, func(entry *TreeEntry, open treeOpener) error {
+			digest, ok := sources[entry.Name]
+			if !ok || open == nil {
+				return nil
+			}
+			reader, err := open()
+			if err != nil {
+				return wrapError("打开旧版本文件失败", err)
+			}
+			defer reader.Close()
+			return a.write(digest, reader)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for digest, targets := range a.targets {
+		if !a.done[digest] {
+			return errors.New("旧版本与差异包中均缺少文件内容: " + targets[0].Name)
+		}
+	}
+
+	for _, entry := range manifest.Entries {
+		if entry.Type != EntrySymlink {
+			continue
+		}
+		if _, err = e.symlink(entry.Name, entry.Link); err != nil {
+			return wrapError("创建符号链接失败", err)
+		}
+	}
+	if err = e.finish(); err != nil {
+		return errors.New("还原目录属性失败 => " + err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package compress
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDelta(t *testing.T) {
+	dir, err := ioutil.TempDir("", "delta-test")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+	oldDir := filepath.Join(dir, "old")
+	writeTestTree(t, oldDir)
+	newDir := filepath.Join(dir, "new")
+	writeTestTree(t, newDir)
+	if err = ioutil.WriteFile(filepath.Join(newDir, "conf/app.properties"), []byte("name=app2\n"), 0644); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if err = os.Remove(filepath.Join(newDir, "logs/app.log")); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if err = os.Rename(filepath.Join(newDir, "lib/app.jar"), filepath.Join(newDir, "lib/app-1.0.jar")); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if err = ioutil.WriteFile(filepath.Join(newDir, "lib/new.jar"), []byte("new jar"), 0600); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if err = os.Symlink("app.properties", filepath.Join(newDir, "conf/current")); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	changes, err := Diff(oldDir, newDir)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	got := map[string]ChangeType{}
+	for _, change := range changes {
+		got[change.Name] = change.Type
+	}
+	want := map[string]ChangeType{
+		"conf/app.properties": ChangeModified,
+		"conf/current":        ChangeAdded,
+		"lib/app-1.0.jar":     ChangeAdded,
+		"lib/app.jar":         ChangeRemoved,
+		"lib/new.jar":         ChangeAdded,
+		"logs/app.log":        ChangeRemoved,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("差异结果错误 %v", got)
+	}
+
+	newEntries, err := ScanTree(newDir)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	oldArchive := filepath.Join(dir, "old.tar.gz")
+	if err = Archive(oldDir, oldArchive); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	deltaFile := filepath.Join(dir, "app.delta")
+	if _, err = CreateDelta(oldArchive, newDir, deltaFile); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	entries, err := List(deltaFile)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	// 清单与两个新内容, 重命名的文件从旧版本复制
+	if len(entries) != 3 {
+		t.Errorf("差异包中的条目数量错误 %d", len(entries))
+	}
+
+	for i, base := range []string{oldDir, oldArchive} {
+		destDir := filepath.Join(dir, "dest", string(rune('a'+i)))
+		if err = ApplyDelta(base, deltaFile, destDir, nil); err != nil {
+			t.Error(err.Error())
+			return
+		}
+		destEntries, err := ScanTree(destDir)
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		if !reflect.DeepEqual(destEntries, newEntries) {
+			t.Errorf("%s: 还原的目录与新版本不一致", base)
+		}
+	}
+
+	if err = ApplyDelta(oldDir, deltaFile, filepath.Join(dir, "dest", "a"), nil); err == nil {
+		t.Error("目标目录不为空时应当返回错误")
+	}
+	if err = ioutil.WriteFile(filepath.Join(oldDir, "lib/app.jar"), []byte("modified"), 0644); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	destDir := filepath.Join(dir, "dest", "tampered")
+	if err = ApplyDelta(oldDir, deltaFile, destDir, nil); err == nil {
+		t.Error("旧版本与差异包不匹配时应当返回错误")
+	}
+	if _, err = os.Stat(destDir); !os.IsNotExist(err) {
+		t.Error("失败时应当清理目标目录")
+	}
+}
+
+func TestApplyDeltaLimits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "delta-test")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// 清单中记录的大小不可信, 写入时仍按实际大小检查
+	content := string(bytes.Repeat([]byte("a"), 64*1024))
+	sum := sha256.Sum256([]byte(content))
+	digest := hex.EncodeToString(sum[:])
+	manifest, _ := json.Marshal(&deltaManifest{Version: deltaVersion, Entries: []*TreeEntry{
+		{Name: "d1", Type: EntryDir, Mode: 0755},
+		{Name: "d2", Type: EntryDir, Mode: 0755},
+		{Name: "d1/big", Type: EntryFile, Size: 10, Mode: 0644, Digest: digest},
+	}})
+	data := buildTarGz(t, []*tar.Header{
+		{Name: deltaManifestName, Typeflag: tar.TypeReg},
+		{Name: deltaObjectPrefix + digest, Typeflag: tar.TypeReg},
+	}, []string{string(manifest), content})
+
+	cases := map[string]*ExtractOptions{
+		"MaxFileSize":  {MaxFileSize: 1024},
+		"MaxTotalSize": {MaxTotalSize: 1024},
+		"MaxEntries":   {MaxEntries: 2},
+	}
+	for limit, opts := range cases {
+		destDir := filepath.Join(dir, limit)
+		err = ApplyDeltaReader(dir, bytes.NewReader(data), destDir, opts)
+		if limitErr, ok := err.(*LimitError); !ok || limitErr.Limit != limit {
+			t.Errorf("%s: 应当返回LimitError, 实际为 %v", limit, err)
+		}
+		if _, err = os.Stat(destDir); !os.IsNotExist(err) {
+			t.Errorf("%s: 失败时应当清理目标目录", limit)
+		}
+	}
+	if err = ApplyDeltaReader(dir, bytes.NewReader(data), filepath.Join(dir, "ok"), &ExtractOptions{MaxRatio: 2}); err != nil {
+		t.Error(err.Error())
+	}
+}
@@ -0,0 +1,330 @@
+package compress
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// EntryType 压缩包内条目的类型
+type EntryType int
+
+const (
+	// EntryFile 普通文件
+	EntryFile EntryType = iota
+	// EntryDir 目录
+	EntryDir
+	// EntrySymlink 符号链接
+	EntrySymlink
+	// EntryHardlink 硬链接, 仅tar
+	EntryHardlink
+	// EntryOther 设备文件等其它类型
+	EntryOther
+)
+
+func (t EntryType) String() string {
+	switch t {
+	case EntryFile:
+		return "file"
+	case EntryDir:
+		return "dir"
+	case EntrySymlink:
+		return "symlink"
+	case EntryHardlink:
+		return "hardlink"
+	default:
+		return "other"
+	}
+}
+
+// Entry 压缩包内的条目信息
+type Entry struct {
+	// Name 条目名称, 去掉了开头的/与./
+	Name string
+	// Size 解压后的大小
+	Size int64
+	// CompressedSize 压缩后的大小, tar中的条目不单独压缩, 为-1
+	CompressedSize int64
+	// Mode 权限与类型
+	Mode os.FileMode
+	// ModTime 修改时间
+	ModTime time.Time
+	// Type 条目类型
+	Type EntryType
+	// Linkname 链接的目标
+	Linkname string
+}
+
+// entryName 统一条目名称, 去掉开头的/与./以及目录结尾的/
+func entryName(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	for strings.HasPrefix(name, "./") {
+		name = name[2:]
+	}
+	name = strings.Trim(name, "/")
+	if name == "" {
+		return ""
+	}
+	return path.Clean(name)
+}
+
+func tarEntryInfo(hdr *tar.Header) *Entry {
+	entry := &Entry{
+		Name:           entryName(hdr.Name),
+		Size:           hdr.Size,
+		CompressedSize: -1,
+		Mode:           hdr.FileInfo().Mode(),
+		ModTime:        hdr.ModTime,
+		Linkname:       hdr.Linkname,
+	}
+	switch hdr.Typeflag {
+	case tar.TypeReg, tar.TypeRegA:
+		entry.Type = EntryFile
+	case tar.TypeDir:
+		entry.Type = EntryDir
+	case tar.TypeSymlink:
+		entry.Type = EntrySymlink
+	case tar.TypeLink:
+		entry.Type = EntryHardlink
+		entry.Linkname = entryName(hdr.Linkname)
+	default:
+		entry.Type = EntryOther
+	}
+	return entry
+}
+
+func zipEntryInfo(f *zip.File) *Entry {
+	entry := &Entry{
+		Name:           entryName(f.Name),
+		Size:           int64(f.UncompressedSize64),
+		CompressedSize: int64(f.CompressedSize64),
+		Mode:           f.Mode(),
+		ModTime:        f.Modified,
+	}
+	switch {
+	case entry.Mode.IsDir():
+		entry.Type = EntryDir
+	case entry.Mode&os.ModeSymlink != 0:
+		entry.Type = EntrySymlink
+	case entry.Mode.IsRegular():
+		entry.Type = EntryFile
+	default:
+		entry.Type = EntryOther
+	}
+	return entry
+}
+
+// List 列出压缩包内的条目, 格式由文件内容识别
+func List(archiveFile string) ([]*Entry, error) {
+	format, err := DetectFile(archiveFile)
+	if err != nil {
+		return nil, err
+	}
+	if format == FormatZip {
+		zipReader, err := zip.OpenReader(archiveFile)
+		if err != nil {
+			return nil, errors.New("创建zip解压流失败 => " + err.Error())
+		}
+		defer zipReader.Close()
+		entries := make([]*Entry, 0, len(zipReader.File))
+		for _, f := range zipReader.File {
+			entries = append(entries, zipEntryInfo(f))
+		}
+		return entries, nil
+	}
+
+	tr, closer, err := openTarReader(archiveFile, format)
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+	var entries []*Entry
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, errors.New("读取压缩包内文件失败 => " + err.Error())
+		}
+		entries = append(entries, tarEntryInfo(hdr))
+	}
+}
+
+// multiCloser 依次关闭多个io.Closer
+type multiCloser []io.Closer
+
+func (m multiCloser) Close() error {
+	var result error
+	for i := len(m) - 1; i >= 0; i-- {
+		if err := m[i].Close(); err != nil && result == nil {
+			result = err
+		}
+	}
+	return result
+}
+
+// openTarReader 打开压缩的tar文件
+func openTarReader(archiveFile string, format Format) (*tar.Reader, io.Closer, error) {
+	if format == FormatUnknown {
+		return nil, nil, errors.New("无法识别的压缩格式")
+	}
+	file, err := os.Open(archiveFile)
+	if err != nil {
+		return nil, nil, errors.New("打开压缩文件失败 => " + err.Error())
+	}
+	reader, err := NewReader(format, file)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return tar.NewReader(reader), multiCloser{file, reader}, nil
+}
+
+// entryReader 读取条目内容, Close时关闭压缩包
+type entryReader struct {
+	io.Reader
+	io.Closer
+}
+
+// maxEntryLinks 打开条目时最多跟随的链接数
+const maxEntryLinks = 40
+
+// OpenEntry 打开压缩包内的单个文件, 符号链接与硬链接会被跟随, 使用完毕后需要Close
+// tar格式只需要顺序读取到对应的条目, 不会解压整个压缩包
+func OpenEntry(archiveFile, name string) (io.ReadCloser, error) {
+	_, reader, err := openEntry(archiveFile, name)
+	return reader, err
+}
+
+func openEntry(archiveFile, name string) (*Entry, io.ReadCloser, error) {
+	format, err := DetectFile(archiveFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	name = entryName(name)
+	for i := 0; i < maxEntryLinks; i++ {
+		var (
+			entry  *Entry
+			reader io.ReadCloser
+		)
+		if format == FormatZip {
+			entry, reader, err = openZipEntry(archiveFile, name)
+		} else {
+			entry, reader, err = openTarEntry(archiveFile, format, name)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		switch entry.Type {
+		case EntryFile:
+			return entry, reader, nil
+		case EntrySymlink:
+			target := entry.Linkname
+			if reader != nil {
+				// zip中符号链接的目标保存在内容中
+				data, err := io.ReadAll(io.LimitReader(reader, 4096))
+				reader.Close()
+				if err != nil {
+					return nil, nil, errors.New("读取符号链接失败 => " + err.Error())
+				}
+				target = string(data)
+			}
+			if !strings.HasPrefix(target, "/") {
+				target = path.Join(path.Dir(name), target)
+			}
+			name = entryName(target)
+		case EntryHardlink:
+			name = entry.Linkname
+		default:
+			if reader != nil {
+				reader.Close()
+			}
+			return nil, nil, errors.New("压缩包内的条目不是文件: " + name)
+		}
+	}
+	return nil, nil, errors.New("符号链接层级过多: " + name)
+}
+
+func openZipEntry(archiveFile, name string) (*Entry, io.ReadCloser, error) {
+	zipReader, err := openZipArchive(archiveFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, f := range zipReader.File {
+		if entryName(f.Name) != name {
+			continue
+		}
+		entry := zipEntryInfo(f)
+		if entry.Type != EntryFile && entry.Type != EntrySymlink {
+			zipReader.Close()
+			return entry, nil, nil
+		}
+		reader, err := openZipFile(zipReader.file, f, "")
+		if err != nil {
+			zipReader.Close()
+			return nil, nil, wrapError("打开压缩包内文件失败", err)
+		}
+		return entry, &entryReader{Reader: reader, Closer: multiCloser{zipReader, reader}}, nil
+	}
+	zipReader.Close()
+	return nil, nil, errors.New("压缩包内不存在文件: " + name)
+}
+
+func openTarEntry(archiveFile string, format Format, name string) (*Entry, io.ReadCloser, error) {
+	tr, closer, err := openTarReader(archiveFile, format)
+	if err != nil {
+		return nil, nil, err
+	}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			closer.Close()
+			return nil, nil, errors.New("读取压缩包内文件失败 => " + err.Error())
+		}
+		if entryName(hdr.Name) != name {
+			continue
+		}
+		entry := tarEntryInfo(hdr)
+		if entry.Type != EntryFile {
+			closer.Close()
+			return entry, nil, nil
+		}
+		return entry, &entryReader{Reader: tr, Closer: closer}, nil
+	}
+	closer.Close()
+	return nil, nil, errors.New("压缩包内不存在文件: " + name)
+}
+
+// ExtractEntry 解压压缩包内的单个文件到destFile, 保留权限与修改时间
+func ExtractEntry(archiveFile, name, destFile string) error {
+	entry, reader, err := openEntry(archiveFile, name)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	file, err := os.OpenFile(destFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, entry.Mode.Perm())
+	if err != nil {
+		return errors.New("创建文件失败 => " + err.Error())
+	}
+	if _, err = io.Copy(file, reader); err != nil {
+		file.Close()
+		_ = os.Remove(destFile)
+		return errors.New("从压缩包内解压文件失败 => " + err.Error())
+	}
+	if err = file.Close(); err != nil {
+		return errors.New("关闭文件失败 => " + err.Error())
+	}
+	if !entry.ModTime.IsZero() {
+		_ = os.Chtimes(destFile, entry.ModTime, entry.ModTime)
+	}
+	return nil
+}
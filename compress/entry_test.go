@@ -0,0 +1,86 @@
+package compress
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestListAndExtractEntry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "entry-test")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src")
+	writeTestTree(t, src)
+	if err = os.Symlink("app.properties", filepath.Join(src, "conf/current")); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	modTime := time.Date(2020, 1, 2, 3, 4, 6, 0, time.UTC)
+	for _, name := range []string{"app.tar.gz", "app.zip", "app.tar.xz"} {
+		archiveFile := filepath.Join(dir, name)
+		if err = Archive(src, archiveFile); err != nil {
+			t.Error(err.Error())
+			return
+		}
+
+		entries, err := List(archiveFile)
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		byName := map[string]*Entry{}
+		for _, entry := range entries {
+			byName[entry.Name] = entry
+		}
+		if entry := byName["conf/app.properties"]; entry == nil || entry.Type != EntryFile || entry.Size != 9 || !entry.ModTime.Equal(modTime) {
+			t.Errorf("%s: 文件信息错误 %+v", name, entry)
+		}
+		if entry := byName["bin/run.sh"]; entry == nil || entry.Mode.Perm() != 0755 {
+			t.Errorf("%s: 文件权限错误 %+v", name, entry)
+		}
+		if entry := byName["empty"]; entry == nil || entry.Type != EntryDir {
+			t.Errorf("%s: 目录信息错误 %+v", name, entry)
+		}
+		if entry := byName["conf/current"]; entry == nil || entry.Type != EntrySymlink {
+			t.Errorf("%s: 符号链接信息错误 %+v", name, entry)
+		}
+		if entry := byName["lib/app.jar"]; entry != nil && name != "app.zip" && entry.CompressedSize != -1 {
+			t.Errorf("%s: tar条目的压缩大小应当为-1", name)
+		}
+
+		reader, err := OpenEntry(archiveFile, "/conf/current")
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		data, err := ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil || string(data) != "name=app\n" {
+			t.Errorf("%s: 读取符号链接指向的文件失败 %q %v", name, data, err)
+		}
+
+		destFile := filepath.Join(dir, name+".properties")
+		if err = ExtractEntry(archiveFile, "conf/app.properties", destFile); err != nil {
+			t.Error(err.Error())
+			return
+		}
+		stat, err := os.Stat(destFile)
+		if err != nil || !stat.ModTime().Equal(modTime) {
+			t.Errorf("%s: 解压的文件修改时间错误", name)
+		}
+
+		if _, err = OpenEntry(archiveFile, "empty"); err == nil {
+			t.Errorf("%s: 目录不能作为文件打开", name)
+		}
+		if _, err = OpenEntry(archiveFile, "missing"); err == nil {
+			t.Errorf("%s: 不存在的文件应当返回错误", name)
+		}
+	}
+}
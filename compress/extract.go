@@ -0,0 +1,495 @@
+package compress
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExtractOptions 解压选项
+type ExtractOptions struct {
+	// Unsafe 关闭安全检查, 按压缩包内的路径原样解压, 仅用于完全可信的压缩包
+	Unsafe bool
+	// Owner 是否还原文件的所有者(uid/gid), 通常需要root权限
+	Owner bool
+	// Progress 进度回调
+	Progress ProgressFunc
+	// Password 解压WinZip AES加密的zip或SM4-GCM加密的压缩包时使用的密码
+	Password string
+	// Sm4Key 解压使用密钥加密的SM4-GCM压缩包时使用的密钥
+	Sm4Key []byte
+	// MaxTotalSize 解压出的文件总大小上限, 为0时不限制
+	MaxTotalSize int64
+	// MaxFileSize 单个文件大小上限, 为0时不限制
+	MaxFileSize int64
+	// MaxEntries 条目数量上限, 为0时不限制
+	MaxEntries int
+	// MaxRatio 解压出的数据与读取的压缩数据的大小之比的上限, 解压出的数据超过1MB后才检查, 为0时不限制
+	MaxRatio float64
+}
+
+func (o *ExtractOptions) progress() ProgressFunc {
+	if o == nil {
+		return nil
+	}
+	return o.Progress
+}
+
+// ratioGrace 解压出的数据超过该大小后才检查压缩比, 避免小文件因压缩比高被误判
+const ratioGrace = 1024 * 1024
+
+// LimitError 解压超出ExtractOptions中的资源限制, 已解压的内容会被清理
+type LimitError struct {
+	// Name 超出限制时的条目名称, 解压前检查整个压缩包时为空
+	Name string
+	// Limit 超出的限制, 如MaxTotalSize
+	Limit string
+	// Reason 详细原因
+	Reason string
+}
+
+func (e *LimitError) Error() string {
+	if e.Name == "" {
+		return "压缩包超出解压限制 " + e.Limit + " => " + e.Reason
+	}
+	return "解压 " + e.Name + " 时超出限制 " + e.Limit + " => " + e.Reason
+}
+
+// checkRatio 检查压缩比, compressed为对应的压缩数据大小
+func (o *ExtractOptions) checkRatio(name string, size, compressed int64) error {
+	if o.MaxRatio <= 0 || size <= ratioGrace {
+		return nil
+	}
+	if compressed <= 0 {
+		compressed = 1
+	}
+	if ratio := float64(size) / float64(compressed); ratio > o.MaxRatio {
+		return &LimitError{Name: name, Limit: "MaxRatio", Reason: "压缩比 " + strconv.FormatFloat(ratio, 'f', 1, 64) + " 超过 " + strconv.FormatFloat(o.MaxRatio, 'f', 1, 64)}
+	}
+	return nil
+}
+
+// checkArchive 解压前根据压缩包中记录的条目数量与大小检查限制, 用于zip等可以预先读取目录的格式
+func (o *ExtractOptions) checkArchive(entries int, total int64) error {
+	if o.MaxEntries > 0 && entries > o.MaxEntries {
+		return &LimitError{Limit: "MaxEntries", Reason: "条目数量 " + strconv.Itoa(entries) + " 超过 " + strconv.Itoa(o.MaxEntries)}
+	}
+	if o.MaxTotalSize > 0 && total > o.MaxTotalSize {
+		return &LimitError{Limit: "MaxTotalSize", Reason: "总大小 " + strconv.FormatInt(total, 10) + " 超过 " + strconv.FormatInt(o.MaxTotalSize, 10)}
+	}
+	return nil
+}
+
+// UnsafeEntryError 压缩包内存在不安全的条目
+type UnsafeEntryError struct {
+	// Name 压缩包内的条目名称
+	Name string
+	// Reason 不安全的原因
+	Reason string
+}
+
+func (e *UnsafeEntryError) Error() string {
+	return "压缩包内存在不安全的文件 " + e.Name + " => " + e.Reason
+}
+
+// entryMeta 需要还原的条目属性
+type entryMeta struct {
+	path    string
+	mode    os.FileMode
+	modTime time.Time
+	uid     int
+	gid     int
+}
+
+// extractor 将压缩包内的条目写入root目录, 安全模式下所有写入都被限制在root内
+type extractor struct {
+	root    string
+	opts    *ExtractOptions
+	tracker *progressTracker
+	// dirs 目录的属性在全部解压完成后还原, 避免只读目录无法写入以及修改时间被覆盖
+	dirs []*entryMeta
+	// entries 已开始解压的条目数
+	entries int
+	// total 已解压出的文件总大小
+	total int64
+	// pendingIn 当前条目尚未计入进度的压缩数据大小
+	pendingIn int64
+	// created 本次解压新建的最上层路径, 超出限制时删除
+	created []string
+}
+
+func newExtractor(root string, opts *ExtractOptions, tracker *progressTracker) (*extractor, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if opts == nil {
+		opts = &ExtractOptions{}
+	}
+	return &extractor{root: root, opts: opts, tracker: tracker}, nil
+}
+
+func (e *extractor) safe() bool {
+	return !e.opts.Unsafe
+}
+
+// entryPath 计算条目在本地的路径
+// 开头的/被视为压缩包的根目录, 旧版Gzip生成的压缩包中的条目均以/开头, 压缩单个文件时条目名称为空, 对应root本身
+func (e *extractor) entryPath(name string) (string, error) {
+	if !e.safe() {
+		return filepath.Join(e.root, filepath.FromSlash(name)), nil
+	}
+	clean := strings.ReplaceAll(name, "\\", "/")
+	if len(clean) >= 2 && clean[1] == ':' {
+		return "", &UnsafeEntryError{Name: name, Reason: "包含盘符"}
+	}
+	if strings.HasPrefix(clean, "//") {
+		return "", &UnsafeEntryError{Name: name, Reason: "为网络路径"}
+	}
+	for _, part := range strings.Split(clean, "/") {
+		if part == ".." {
+			return "", &UnsafeEntryError{Name: name, Reason: "包含上级目录"}
+		}
+	}
+	clean = strings.Trim(clean, "/")
+	if clean == "" || clean == "." {
+		return e.root, nil
+	}
+	p := filepath.Join(e.root, filepath.FromSlash(clean))
+	if err := e.checkParent(name, p); err != nil {
+		return "", err
+	}
+	return p, nil
+}
+
+// begin 开始解压条目, size为条目头中记录的大小, 检查条目数量与大小的限制
+func (e *extractor) begin(name string, size int64) error {
+	e.entries++
+	if e.opts.MaxEntries > 0 && e.entries > e.opts.MaxEntries {
+		return &LimitError{Name: name, Limit: "MaxEntries", Reason: "条目数量超过 " + strconv.Itoa(e.opts.MaxEntries)}
+	}
+	if e.opts.MaxFileSize > 0 && size > e.opts.MaxFileSize {
+		return &LimitError{Name: name, Limit: "MaxFileSize", Reason: "文件大小 " + strconv.FormatInt(size, 10) + " 超过 " + strconv.FormatInt(e.opts.MaxFileSize, 10)}
+	}
+	if e.opts.MaxTotalSize > 0 && size > e.opts.MaxTotalSize-e.total {
+		return &LimitError{Name: name, Limit: "MaxTotalSize", Reason: "总大小超过 " + strconv.FormatInt(e.opts.MaxTotalSize, 10)}
+	}
+	return nil
+}
+
+// limitReader 统计解压出的数据大小, 在超出限制时返回LimitError, 不依赖条目头中记录的大小
+type limitReader struct {
+	r    io.Reader
+	e    *extractor
+	name string
+	n    int64
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	l.e.total += int64(n)
+	opts := l.e.opts
+	if opts.MaxFileSize > 0 && l.n > opts.MaxFileSize {
+		return n, &LimitError{Name: l.name, Limit: "MaxFileSize", Reason: "文件大小超过 " + strconv.FormatInt(opts.MaxFileSize, 10)}
+	}
+	if opts.MaxTotalSize > 0 && l.e.total > opts.MaxTotalSize {
+		return n, &LimitError{Name: l.name, Limit: "MaxTotalSize", Reason: "总大小超过 " + strconv.FormatInt(opts.MaxTotalSize, 10)}
+	}
+	if err := opts.checkRatio(l.name, l.e.total, l.e.tracker.p.BytesIn+l.e.pendingIn); err != nil {
+		return n, err
+	}
+	return n, err
+}
+
+// track 记录p及其上级目录中即将新建的最上层路径
+func (e *extractor) track(p string) {
+	top := ""
+	for q := p; within(e.root, q) || q == e.root; q = filepath.Dir(q) {
+		if _, err := os.Lstat(q); err == nil {
+			break
+		}
+		top = q
+		if q == e.root {
+			break
+		}
+	}
+	if top != "" {
+		e.created = append(e.created, top)
+	}
+}
+
+// abort 解压失败时调用, 超出限制时删除本次解压新建的文件与目录
+func (e *extractor) abort(err error) {
+	if _, ok := err.(*LimitError); !ok {
+		return
+	}
+	for i := len(e.created) - 1; i >= 0; i-- {
+		_ = os.RemoveAll(e.created[i])
+	}
+	e.created = nil
+	e.dirs = nil
+}
+
+// within 判断p是否位于root内
+func within(root, p string) bool {
+	rel, err := filepath.Rel(root, p)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
+
+// resolve 解析路径中已存在部分的符号链接
+func resolve(p string) (string, error) {
+	dir, rest := p, ""
+	for {
+		if _, err := os.Lstat(dir); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		rest = filepath.Join(filepath.Base(dir), rest)
+		dir = parent
+	}
+	real, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(real, rest), nil
+}
+
+// checkParent 检查p的上级目录在解析符号链接后仍位于root内, 防止借助之前解压的符号链接写到root之外
+func (e *extractor) checkParent(name, p string) error {
+	root, err := resolve(e.root)
+	if err != nil {
+		return err
+	}
+	parent, err := resolve(filepath.Dir(p))
+	if err != nil {
+		return &UnsafeEntryError{Name: name, Reason: "上级目录无法解析 => " + err.Error()}
+	}
+	if !within(root, parent) {
+		return &UnsafeEntryError{Name: name, Reason: "上级目录指向解压目录之外"}
+	}
+	return nil
+}
+
+// checkMode 检查条目类型, 安全模式下拒绝设备文件等特殊文件
+func (e *extractor) checkMode(name string, mode os.FileMode) error {
+	if e.safe() && mode&(os.ModeDevice|os.ModeCharDevice|os.ModeNamedPipe|os.ModeSocket|os.ModeIrregular) != 0 {
+		return &UnsafeEntryError{Name: name, Reason: "不支持的特殊文件类型"}
+	}
+	return nil
+}
+
+func (e *extractor) mkdir(name string) (string, error) {
+	p, err := e.entryPath(name)
+	if err != nil {
+		return "", err
+	}
+	if e.safe() {
+		// 不跟随已存在的符号链接创建目录
+		if stat, err := os.Lstat(p); err == nil && stat.Mode()&os.ModeSymlink != 0 {
+			return "", &UnsafeEntryError{Name: name, Reason: "目录条目与已存在的符号链接同名"}
+		}
+	}
+	e.track(p)
+	return p, os.MkdirAll(p, os.ModePerm)
+}
+
+func (e *extractor) writeFile(name string, r io.Reader, mode os.FileMode) (string, error) {
+	p, err := e.entryPath(name)
+	if err != nil {
+		return "", err
+	}
+	e.track(p)
+	if err = os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+		return "", err
+	}
+	if e.safe() {
+		// 不跟随已存在的符号链接写入
+		if stat, err := os.Lstat(p); err == nil && stat.Mode()&os.ModeSymlink != 0 {
+			if err = os.Remove(p); err != nil {
+				return "", err
+			}
+		}
+	}
+	file, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return "", err
+	}
+	if _, err = io.Copy(e.tracker.writer(file), &limitReader{r: r, e: e, name: name}); err != nil {
+		file.Close()
+		return "", err
+	}
+	return p, file.Close()
+}
+
+// linkTarget 检查链接目标在解压目录内, 返回链接目标的本地路径
+func (e *extractor) linkTarget(name, p, target string) (string, error) {
+	if !e.safe() {
+		return filepath.Join(filepath.Dir(p), target), nil
+	}
+	slash := strings.ReplaceAll(target, "\\", "/")
+	if filepath.IsAbs(target) || strings.HasPrefix(slash, "/") || (len(slash) >= 2 && slash[1] == ':') {
+		return "", &UnsafeEntryError{Name: name, Reason: "链接目标为绝对路径: " + target}
+	}
+	dest := filepath.Join(filepath.Dir(p), filepath.FromSlash(slash))
+	if !within(e.root, dest) {
+		return "", &UnsafeEntryError{Name: name, Reason: "链接目标位于解压目录之外: " + target}
+	}
+	root, err := resolve(e.root)
+	if err != nil {
+		return "", err
+	}
+	real, err := resolveTarget(filepath.Dir(p), slash)
+	if err != nil {
+		return "", &UnsafeEntryError{Name: name, Reason: "链接目标无法解析 => " + err.Error()}
+	}
+	if !within(root, real) {
+		return "", &UnsafeEntryError{Name: name, Reason: "链接目标解析符号链接后位于解压目录之外: " + target}
+	}
+	return dest, nil
+}
+
+// resolveTarget 从dir开始逐级解析链接目标, 已存在的符号链接会被跟随, 不能先按字符串化简..
+// 不存在的部分之后出现..时无法确认最终位置, 以后解压的条目可能把它变为符号链接, 按不安全处理
+func resolveTarget(dir, target string) (string, error) {
+	cur, err := resolve(dir)
+	if err != nil {
+		return "", err
+	}
+	dangling := false
+	for _, part := range strings.Split(target, "/") {
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			if dangling {
+				return "", errors.New("..之前的路径不存在")
+			}
+			cur = filepath.Dir(cur)
+			continue
+		}
+		cur = filepath.Join(cur, part)
+		if dangling {
+			continue
+		}
+		if _, err = os.Lstat(cur); err != nil {
+			dangling = true
+			continue
+		}
+		if cur, err = filepath.EvalSymlinks(cur); err != nil {
+			return "", err
+		}
+	}
+	return cur, nil
+}
+
+func (e *extractor) symlink(name, target string) (string, error) {
+	p, err := e.entryPath(name)
+	if err != nil {
+		return "", err
+	}
+	if _, err = e.linkTarget(name, p, target); err != nil {
+		return "", err
+	}
+	e.track(p)
+	if err = os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+		return "", err
+	}
+	_ = os.Remove(p)
+	return p, os.Symlink(filepath.FromSlash(target), p)
+}
+
+// hardlink 创建硬链接, target为压缩包内的条目名称
+func (e *extractor) hardlink(name, target string) (string, error) {
+	p, err := e.entryPath(name)
+	if err != nil {
+		return "", err
+	}
+	dest, err := e.entryPath(target)
+	if err != nil {
+		return "", &UnsafeEntryError{Name: name, Reason: "链接目标不安全: " + target}
+	}
+	if e.safe() {
+		// Linux下对符号链接创建硬链接得到的是同样内容的符号链接, 位置改变后需要重新检查它的目标
+		if stat, err := os.Lstat(dest); err == nil && stat.Mode()&os.ModeSymlink != 0 {
+			link, err := os.Readlink(dest)
+			if err != nil {
+				return "", err
+			}
+			if _, err = e.linkTarget(name, p, link); err != nil {
+				return "", err
+			}
+		}
+	}
+	e.track(p)
+	if err = os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+		return "", err
+	}
+	_ = os.Remove(p)
+	return p, os.Link(dest, p)
+}
+
+// setMeta 还原文件属性, 目录的属性延迟到finish时还原
+func (e *extractor) setMeta(meta *entryMeta) error {
+	if meta.mode.IsDir() {
+		e.dirs = append(e.dirs, meta)
+		return nil
+	}
+	return e.applyMeta(meta)
+}
+
+// applyMeta 还原属性, Chmod与Chtimes会跟随符号链接, 因此只处理当前确实是普通文件或目录的路径
+func (e *extractor) applyMeta(meta *entryMeta) error {
+	stat, err := os.Lstat(meta.path)
+	if err != nil {
+		return err
+	}
+	if e.safe() && meta.path != e.root {
+		// 目录的属性延迟还原, 期间上级目录可能已被替换为符号链接
+		root, err := resolve(e.root)
+		if err != nil {
+			return err
+		}
+		parent, err := resolve(filepath.Dir(meta.path))
+		if err != nil || !within(root, parent) {
+			return nil
+		}
+	}
+	if e.opts.Owner {
+		if err = os.Lchown(meta.path, meta.uid, meta.gid); err != nil {
+			return err
+		}
+	}
+	// 符号链接的权限与修改时间无法通过标准库设置, 条目路径已被替换为其它类型时同样跳过
+	if meta.mode&os.ModeSymlink != 0 || (!stat.Mode().IsRegular() && !stat.IsDir()) {
+		return nil
+	}
+	if err := os.Chmod(meta.path, meta.mode.Perm()|meta.mode&(os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+		return err
+	}
+	if !meta.modTime.IsZero() {
+		return os.Chtimes(meta.path, meta.modTime, meta.modTime)
+	}
+	return nil
+}
+
+// finish 由内向外还原目录的属性
+func (e *extractor) finish() error {
+	for i := len(e.dirs) - 1; i >= 0; i-- {
+		if err := e.applyMeta(e.dirs[i]); err != nil {
+			return err
+		}
+	}
+	e.dirs = nil
+	return nil
+}
@@ -0,0 +1,300 @@
+package compress
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func buildTarGz(t *testing.T, headers []*tar.Header, contents []string) []byte {
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	for i, hdr := range headers {
+		hdr.Size = int64(len(contents[i]))
+		if hdr.Mode == 0 {
+			hdr.Mode = 0644
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(contents[i])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+	gw.Close()
+	return buf.Bytes()
+}
+
+func TestDeCompressGzipUnsafe(t *testing.T) {
+	cases := map[string][]*tar.Header{
+		"parent":       {{Name: "../evil.txt", Typeflag: tar.TypeReg}},
+		"nested":       {{Name: "a/../../evil.txt", Typeflag: tar.TypeReg}},
+		"volume":       {{Name: "C:\\evil.txt", Typeflag: tar.TypeReg}},
+		"symlink":      {{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "../.."}},
+		"abs symlink":  {{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc"}},
+		"hardlink":     {{Name: "link", Typeflag: tar.TypeLink, Linkname: "../evil.txt"}},
+		"device":       {{Name: "dev", Typeflag: tar.TypeChar}},
+		"through link": {{Name: "dir", Typeflag: tar.TypeSymlink, Linkname: "."}, {Name: "dir/../../evil.txt", Typeflag: tar.TypeReg}},
+	}
+	for name, headers := range cases {
+		dir, err := ioutil.TempDir("", "extract-test")
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		contents := make([]string, len(headers))
+		data := buildTarGz(t, headers, contents)
+		err = DeCompressGzipByReader(bytes.NewReader(data), filepath.Join(dir, "dest"))
+		if _, ok := err.(*UnsafeEntryError); !ok {
+			t.Errorf("%s: 应当返回UnsafeEntryError, 实际为 %v", name, err)
+		}
+		if _, err = os.Lstat(filepath.Join(dir, "evil.txt")); err == nil {
+			t.Errorf("%s: 文件被写到了解压目录之外", name)
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestDeCompressGzipLinkChain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "extract-test")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+	// l1的目标按字符串计算位于解压目录内, 但l2已经是指向解压目录的链接, 实际指向解压目录的上级
+	data := buildTarGz(t, []*tar.Header{
+		{Name: "l2", Typeflag: tar.TypeSymlink, Linkname: "."},
+		{Name: "l1", Typeflag: tar.TypeSymlink, Linkname: "l2/.."},
+		{Name: "l1/", Typeflag: tar.TypeDir, Mode: 0777},
+	}, []string{"", "", ""})
+	err = DeCompressGzipByReader(bytes.NewReader(data), filepath.Join(dir, "dest"))
+	if _, ok := err.(*UnsafeEntryError); !ok {
+		t.Errorf("应当返回UnsafeEntryError, 实际为 %v", err)
+	}
+	stat, err := os.Stat(dir)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if stat.Mode().Perm() != 0700 {
+		t.Errorf("解压目录之外的目录权限被修改为 %v", stat.Mode().Perm())
+	}
+}
+
+func TestExtractHardlinkToSymlink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "extract-test")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+	// Linux下对符号链接创建的硬链接仍是符号链接, esc位于根目录时../../x指向解压目录之外
+	data := buildTarGz(t, []*tar.Header{
+		{Name: "a/b/l", Typeflag: tar.TypeSymlink, Linkname: "../../x"},
+		{Name: "esc", Typeflag: tar.TypeLink, Linkname: "a/b/l"},
+	}, []string{"", ""})
+	dest := filepath.Join(dir, "dest")
+	err = ExtractReader(bytes.NewReader(data), dest, nil)
+	if _, ok := err.(*UnsafeEntryError); !ok {
+		t.Errorf("应当返回UnsafeEntryError, 实际为 %v", err)
+	}
+	if _, err = os.Lstat(filepath.Join(dest, "esc")); err == nil {
+		t.Error("不应当创建指向解压目录之外的链接")
+	}
+
+	// 位置改变后目标仍在解压目录内的可以正常创建
+	data = buildTarGz(t, []*tar.Header{
+		{Name: "a/b/l", Typeflag: tar.TypeSymlink, Linkname: "../c"},
+		{Name: "a/d/l", Typeflag: tar.TypeLink, Linkname: "a/b/l"},
+	}, []string{"", ""})
+	if err = ExtractReader(bytes.NewReader(data), filepath.Join(dir, "ok"), nil); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func TestDeCompressGzipSafe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "extract-test")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+	data := buildTarGz(t, []*tar.Header{
+		{Name: "/bin/run.sh", Typeflag: tar.TypeReg},
+		{Name: "lib/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "lib/current", Typeflag: tar.TypeSymlink, Linkname: "../bin/run.sh"},
+		{Name: "lib/hard", Typeflag: tar.TypeLink, Linkname: "/bin/run.sh"},
+	}, []string{"run", "", "", ""})
+	dest := filepath.Join(dir, "dest")
+	if err = DeCompressGzipByReader(bytes.NewReader(data), dest); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	for _, name := range []string{"bin/run.sh", "lib/current", "lib/hard"} {
+		content, err := ioutil.ReadFile(filepath.Join(dest, name))
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		if string(content) != "run" {
+			t.Errorf("%s 内容不一致", name)
+		}
+	}
+}
+
+func TestUnzipUnsafe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "extract-test")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	zipFile := filepath.Join(dir, "evil.zip")
+	out, err := os.Create(zipFile)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	zw := zip.NewWriter(out)
+	w, _ := zw.Create("ok.txt")
+	w.Write([]byte("ok"))
+	w, _ = zw.Create("../evil.txt")
+	w.Write([]byte("evil"))
+	zw.Close()
+	out.Close()
+
+	err = Unzip(zipFile, filepath.Join(dir, "dest"))
+	unsafeErr, ok := err.(*UnsafeEntryError)
+	if !ok {
+		t.Errorf("应当返回UnsafeEntryError, 实际为 %v", err)
+		return
+	}
+	if unsafeErr.Name != "../evil.txt" {
+		t.Errorf("错误信息中的条目名称不正确: %s", unsafeErr.Name)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "evil.txt")); err == nil {
+		t.Error("文件被写到了解压目录之外")
+	}
+}
+
+func TestExtractLimits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "extract-test")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// 压缩比很高的文件, 解压时超出MaxRatio
+	bomb := buildTarGz(t, []*tar.Header{
+		{Name: "a.txt", Typeflag: tar.TypeReg},
+		{Name: "zero/zero.bin", Typeflag: tar.TypeReg},
+	}, []string{"a", string(make([]byte, 8*1024*1024))})
+	dest := filepath.Join(dir, "bomb")
+	err = DeCompressGzipByReaderWithOptions(bytes.NewReader(bomb), dest, &ExtractOptions{MaxRatio: 100})
+	if limitErr, ok := err.(*LimitError); !ok || limitErr.Limit != "MaxRatio" || limitErr.Name != "zero/zero.bin" {
+		t.Errorf("应当返回MaxRatio的LimitError, 实际为 %v", err)
+	}
+	if _, err = os.Stat(dest); !os.IsNotExist(err) {
+		t.Error("超出限制后应当清理解压出的内容")
+	}
+
+	// 解压到已存在的目录时只清理新建的内容
+	dest = filepath.Join(dir, "exists")
+	if err = os.MkdirAll(dest, 0755); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if err = ioutil.WriteFile(filepath.Join(dest, "keep.txt"), []byte("keep"), 0644); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	err = DeCompressGzipByReaderWithOptions(bytes.NewReader(bomb), dest, &ExtractOptions{MaxTotalSize: 1024})
+	if limitErr, ok := err.(*LimitError); !ok || limitErr.Limit != "MaxTotalSize" {
+		t.Errorf("应当返回MaxTotalSize的LimitError, 实际为 %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(dest, "keep.txt")); err != nil {
+		t.Error("已存在的文件不应当被清理")
+	}
+	if _, err = os.Stat(filepath.Join(dest, "a.txt")); !os.IsNotExist(err) {
+		t.Error("超出限制后应当清理解压出的内容")
+	}
+
+	src := filepath.Join(dir, "src")
+	writeTestTree(t, src)
+	tarFile := filepath.Join(dir, "app.tar.gz")
+	if err = Gzip(src, tarFile); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	err = DeCompressGzipWithOptions(tarFile, filepath.Join(dir, "entries"), &ExtractOptions{MaxEntries: 3})
+	if limitErr, ok := err.(*LimitError); !ok || limitErr.Limit != "MaxEntries" {
+		t.Errorf("应当返回MaxEntries的LimitError, 实际为 %v", err)
+	}
+	if err = DeCompressGzipWithOptions(tarFile, filepath.Join(dir, "ok"), &ExtractOptions{MaxEntries: 9, MaxTotalSize: 42, MaxFileSize: 20}); err != nil {
+		t.Error(err.Error())
+	}
+
+	// zip在解压前根据目录中记录的大小检查
+	zipFile := filepath.Join(dir, "app.zip")
+	if err = Zip(src, zipFile, nil); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	dest = filepath.Join(dir, "zip")
+	err = Unzip(zipFile, dest)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	_ = os.RemoveAll(dest)
+	err = UnzipWithOptions(zipFile, dest, &ExtractOptions{MaxTotalSize: 41})
+	if limitErr, ok := err.(*LimitError); !ok || limitErr.Limit != "MaxTotalSize" || limitErr.Name != "" {
+		t.Errorf("应当在解压前返回MaxTotalSize的LimitError, 实际为 %v", err)
+	}
+	if _, err = os.Stat(dest); !os.IsNotExist(err) {
+		t.Error("解压前检查失败时不应当写入任何文件")
+	}
+	err = UnzipWithOptions(zipFile, dest, &ExtractOptions{MaxFileSize: 10})
+	if limitErr, ok := err.(*LimitError); !ok || limitErr.Limit != "MaxFileSize" {
+		t.Errorf("应当返回MaxFileSize的LimitError, 实际为 %v", err)
+	}
+	if _, err = os.Stat(dest); !os.IsNotExist(err) {
+		t.Error("超出限制后应当清理解压出的内容")
+	}
+}
+
+func TestCheckZipOverflow(t *testing.T) {
+	e, err := newExtractor(os.TempDir(), &ExtractOptions{MaxTotalSize: 1 << 30}, newProgressTracker(nil, nil))
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	// 累加后溢出为很小的值
+	files := []*zip.File{
+		{FileHeader: zip.FileHeader{Name: "a", UncompressedSize64: 1 << 63, CompressedSize64: 1}},
+		{FileHeader: zip.FileHeader{Name: "b", UncompressedSize64: 1 << 63, CompressedSize64: 1}},
+	}
+	if _, ok := e.checkZip(files).(*LimitError); !ok {
+		t.Error("目录中记录的大小溢出时应当返回LimitError")
+	}
+	files = []*zip.File{
+		{FileHeader: zip.FileHeader{Name: "a", UncompressedSize64: 1<<63 - 1, CompressedSize64: 1}},
+		{FileHeader: zip.FileHeader{Name: "b", UncompressedSize64: 1<<63 - 1, CompressedSize64: 1}},
+	}
+	if _, ok := e.checkZip(files).(*LimitError); !ok {
+		t.Error("总大小超过限制时应当返回LimitError")
+	}
+	if _, ok := e.begin("a", 1<<63-1).(*LimitError); !ok {
+		t.Error("条目大小超过限制时应当返回LimitError")
+	}
+}
@@ -0,0 +1,179 @@
+package compress
+
+import (
+	"archive/zip"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+)
+
+// WriteTarGz 将fsys中的内容压缩为tar.gz写入w, 条目格式与Gzip相同
+// fs.FS无法读取符号链接的目标, 符号链接按指向的文件写入, 指向目录的符号链接被忽略
+func WriteTarGz(w io.Writer, fsys fs.FS) error {
+	compressWriter, err := NewWriter(FormatGzip, w)
+	if err != nil {
+		return err
+	}
+	return writeTar(compressWriter, newProgressTracker(nil, nil), func(a *tarArchiver) error {
+		return a.addFS(fsys)
+	})
+}
+
+func (a *tarArchiver) addFS(fsys fs.FS) error {
+	return fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return errors.New("读取目录结构失败 => " + err.Error())
+		}
+		if name == "." {
+			return nil
+		}
+		stat, err := fsStat(fsys, name, d)
+		if err != nil {
+			return err
+		}
+		if stat == nil {
+			return nil
+		}
+		if err = a.tracker.begin(name); err != nil {
+			return err
+		}
+		header, err := a.writeHeader(stat, "", "/"+name)
+		if err != nil {
+			return err
+		}
+		err = a.writeContent(header, func() (io.ReadCloser, error) {
+			return fsys.Open(name)
+		})
+		if err == nil {
+			a.tracker.done()
+		}
+		return err
+	})
+}
+
+// fsStat 获取文件信息, 符号链接返回指向的文件的信息, 指向目录时返回nil
+func fsStat(fsys fs.FS, name string, d fs.DirEntry) (fs.FileInfo, error) {
+	if d.Type()&fs.ModeSymlink == 0 {
+		stat, err := d.Info()
+		if err != nil {
+			return nil, errors.New("读取文件信息失败 => " + err.Error())
+		}
+		return stat, nil
+	}
+	stat, err := fs.Stat(fsys, name)
+	if err != nil {
+		return nil, errors.New("读取符号链接失败 => " + err.Error())
+	}
+	if stat.IsDir() {
+		return nil, nil
+	}
+	return stat, nil
+}
+
+// WriteZip 将fsys中的内容压缩为zip写入w, opts可以为nil
+func WriteZip(w io.Writer, fsys fs.FS, opts *ZipOptions) error {
+	writer := NewZipWriter(w, opts)
+	if err := writer.AddFS(fsys, ""); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+// AddFS 将fsys中的内容写入压缩包的prefix目录下, 按选项过滤文件, 符号链接的处理同WriteTarGz
+func (z *ZipWriter) AddFS(fsys fs.FS, prefix string) error {
+	prefix = zipEntryName(prefix)
+	includeOnly := z.opts != nil && len(z.opts.Include) > 0
+	return fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return errors.New("读取目录结构失败 => " + err.Error())
+		}
+		if name == "." {
+			return nil
+		}
+		if !z.opts.included(name, d.IsDir()) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		stat, err := fsStat(fsys, name, d)
+		if err != nil {
+			return err
+		}
+		if stat == nil || (stat.IsDir() && includeOnly) {
+			return nil
+		}
+		entryName := path.Join(prefix, name)
+		if stat.IsDir() {
+			return z.AddDir(entryName, stat.Mode(), stat.ModTime())
+		}
+		if !stat.Mode().IsRegular() {
+			return errors.New("不支持压缩的文件类型: " + name)
+		}
+		file, err := fsys.Open(name)
+		if err != nil {
+			return errors.New("打开文件失败 => " + err.Error())
+		}
+		defer file.Close()
+		return z.AddReader(entryName, file, stat.Mode(), stat.ModTime(), z.opts.method(entryName))
+	})
+}
+
+// NewZipFS 由zip创建只读文件系统, 支持随机访问
+func NewZipFS(r io.ReaderAt, size int64) (fs.FS, error) {
+	reader, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, errors.New("创建zip解压流失败 => " + err.Error())
+	}
+	return reader, nil
+}
+
+// ArchiveFS 打开的压缩包文件系统, 使用完毕后需要Close
+type ArchiveFS interface {
+	fs.FS
+	io.Closer
+}
+
+// OpenZipFS 打开zip文件作为只读文件系统
+func OpenZipFS(zipFile string) (ArchiveFS, error) {
+	reader, err := zip.OpenReader(zipFile)
+	if err != nil {
+		return nil, errors.New("创建zip解压流失败 => " + err.Error())
+	}
+	return reader, nil
+}
+
+// OpenTarGzFS 打开tar.gz文件作为只读文件系统
+func OpenTarGzFS(tarFile string) (ArchiveFS, error) {
+	return openTarFS(tarFile, FormatGzip)
+}
+
+func openTarFS(tarFile string, format Format) (ArchiveFS, error) {
+	file, err := os.Open(tarFile)
+	if err != nil {
+		return nil, errors.New("打开压缩文件失败 => " + err.Error())
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, errors.New("读取压缩文件信息失败 => " + err.Error())
+	}
+	t, err := NewCompressedTarFS(file, stat.Size(), format)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &tarFileFS{TarFS: t, file: file}, nil
+}
+
+// tarFileFS 持有打开的压缩包文件
+type tarFileFS struct {
+	*TarFS
+	file *os.File
+}
+
+func (t *tarFileFS) Close() error {
+	return t.file.Close()
+}
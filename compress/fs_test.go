@@ -0,0 +1,177 @@
+package compress
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func testMapFS() fstest.MapFS {
+	modTime := time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC)
+	return fstest.MapFS{
+		"bin/run.sh":          {Data: []byte("#!/bin/sh\n"), Mode: 0755, ModTime: modTime},
+		"lib/app.jar":         {Data: []byte("jar content"), Mode: 0644, ModTime: modTime},
+		"conf/app.properties": {Data: []byte("name=app\n"), Mode: 0644, ModTime: modTime},
+		"empty":               {Mode: fs.ModeDir | 0755, ModTime: modTime},
+	}
+}
+
+func TestTarGzFS(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if err := WriteTarGz(buf, testMapFS()); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	tarFS, err := NewTarGzFS(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if err = fstest.TestFS(tarFS, "bin/run.sh", "lib/app.jar", "conf/app.properties", "empty"); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	content, err := fs.ReadFile(tarFS, "conf/app.properties")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if string(content) != "name=app\n" {
+		t.Error("读取的文件内容不一致")
+	}
+	stat, err := fs.Stat(tarFS, "bin/run.sh")
+	if err != nil || stat.Mode().Perm() != 0755 {
+		t.Error("文件权限不一致")
+	}
+}
+
+func TestTarFS(t *testing.T) {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, hdr := range []*tar.Header{
+		{Name: "./a/b/c.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: 5},
+		{Name: "a/link.txt", Typeflag: tar.TypeSymlink, Linkname: "b/c.txt", Mode: 0777},
+		{Name: "a/hard.txt", Typeflag: tar.TypeLink, Linkname: "a/b/c.txt", Mode: 0644},
+		{Name: "linkdir", Typeflag: tar.TypeSymlink, Linkname: "a/b", Mode: 0777},
+		{Name: "a/up", Typeflag: tar.TypeSymlink, Linkname: "..", Mode: 0777},
+		{Name: "loop1", Typeflag: tar.TypeSymlink, Linkname: "loop2/x", Mode: 0777},
+		{Name: "loop2", Typeflag: tar.TypeSymlink, Linkname: "loop1", Mode: 0777},
+		{Name: "escape", Typeflag: tar.TypeSymlink, Linkname: "../a", Mode: 0777},
+	} {
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Size > 0 {
+			tw.Write([]byte("hello"))
+		}
+	}
+	tw.Close()
+
+	tarFS, err := NewTarFS(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	for _, name := range []string{"a/b/c.txt", "a/link.txt", "a/hard.txt", "linkdir/c.txt", "a/up/linkdir/c.txt"} {
+		content, err := fs.ReadFile(tarFS, name)
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		if string(content) != "hello" {
+			t.Errorf("%s 内容不一致", name)
+		}
+	}
+	entries, err := fs.ReadDir(tarFS, "a")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if len(entries) != 4 || entries[0].Name() != "b" || !entries[0].IsDir() || entries[2].Type() != fs.ModeSymlink {
+		t.Error("目录内容不正确")
+	}
+	if stat, err := fs.Stat(tarFS, "linkdir"); err != nil || !stat.IsDir() || stat.Name() != "linkdir" {
+		t.Error("指向目录的符号链接应当解析为目录")
+	}
+	if _, err = fs.ReadFile(tarFS, "loop1/c.txt"); err == nil {
+		t.Error("循环的符号链接应当返回错误")
+	}
+	if _, err = fs.ReadFile(tarFS, "escape/b/c.txt"); err == nil {
+		t.Error("超出根目录的符号链接应当返回错误")
+	}
+}
+
+func TestZipFS(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if err := WriteZip(buf, testMapFS(), &ZipOptions{Exclude: []string{"*.jar"}}); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	zipFS, err := NewZipFS(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if err = fstest.TestFS(zipFS, "bin/run.sh", "conf/app.properties", "empty"); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if _, err = fs.Stat(zipFS, "lib/app.jar"); err == nil {
+		t.Error("被排除的文件不应当写入压缩包")
+	}
+}
+
+func TestOpenTarGzFS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fs-test")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src")
+	writeTestTree(t, src)
+	if err = os.Symlink("run.sh", filepath.Join(src, "bin/java")); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	tarFile := filepath.Join(dir, "app.tar.gz")
+	if err = Gzip(src, tarFile); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	tarFS, err := OpenTarGzFS(tarFile)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer tarFS.Close()
+	content, err := fs.ReadFile(tarFS, "bin/java")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if string(content) != "#!/bin/sh\necho run\n" {
+		t.Error("通过符号链接读取的内容不一致")
+	}
+
+	// 由本地目录生成的压缩包与Gzip的结果可以互相转换
+	buf := &bytes.Buffer{}
+	if err = WriteTarGz(buf, tarFS); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	dest := filepath.Join(dir, "dest")
+	if err = DeCompressGzipByReader(buf, dest); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if content, err = ioutil.ReadFile(filepath.Join(dest, "bin/java")); err != nil || string(content) != "#!/bin/sh\necho run\n" {
+		t.Error("转换后的内容不一致")
+	}
+}
@@ -3,127 +3,374 @@ package compress
 import (
 	"archive/tar"
 	"compress/gzip"
+	"context"
 	"errors"
 	"io"
+	"io/ioutil"
 	"os"
-	"strings"
+	"path/filepath"
+	"time"
 )
 
-// CompressMemoryGzip 压缩tar.gz
+// Gzip 压缩文件或目录为tar.gz, 保留目录、符号链接、硬链接、权限、修改时间与所有者
+// 压缩包内的条目以/开头, 压缩单个文件时条目名称为空
 func Gzip(srcFilePath, distFilePath string) error {
+	return GzipWithOptions(srcFilePath, distFilePath, nil)
+}
+
+// GzipOptions tar.gz压缩选项
+type GzipOptions struct {
+	// Level 压缩级别, 为0时使用9
+	Level int
+	// Workers 并行压缩的协程数, 为0时使用CPU核数, 为1时使用单线程压缩, 确定性模式下始终按块压缩
+	Workers int
+	// BlockSize 并行压缩时每块数据的大小, 为0时使用1MB
+	BlockSize int
+	// Progress 进度回调
+	Progress ProgressFunc
+	// Deterministic 确定性模式, 修改时间统一为ModTime并清除所有者信息, 相同的输入产生完全相同的压缩包
+	// 输出只与Level、BlockSize有关, 不受Workers影响
+	Deterministic bool
+	// ModTime 确定性模式下条目的修改时间, 为零值时使用1980-01-01 00:00:00 UTC
+	ModTime time.Time
+}
+
+// defaultDeterministicTime 确定性模式下默认的修改时间, 取zip能够表示的最早时间, 使tar.gz与zip一致
+var defaultDeterministicTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// deterministicTime 返回确定性模式下使用的修改时间
+func deterministicTime(t time.Time) time.Time {
+	if t.IsZero() {
+		return defaultDeterministicTime
+	}
+	return t.UTC()
+}
+
+// fixedTime 确定性模式下返回统一的修改时间, 否则返回nil
+func (o *GzipOptions) fixedTime() *time.Time {
+	if o == nil || !o.Deterministic {
+		return nil
+	}
+	t := deterministicTime(o.ModTime)
+	return &t
+}
+
+func (o *GzipOptions) progress() ProgressFunc {
+	if o == nil {
+		return nil
+	}
+	return o.Progress
+}
+
+// newWriter 创建gzip压缩流, 写出的gzip头中不包含文件名与修改时间, 系统类型为unknown
+func (o *GzipOptions) newWriter(w io.Writer) (io.WriteCloser, error) {
+	if o == nil {
+		return NewWriter(FormatGzip, w)
+	}
+	level := o.Level
+	if level == 0 {
+		level = 9
+	}
+	if o.Workers == 1 && !o.Deterministic {
+		gw, err := gzip.NewWriterLevel(w, level)
+		if err != nil {
+			return nil, errors.New("创建gzip压缩流失败 => " + err.Error())
+		}
+		return gw, nil
+	}
+	return NewParallelGzipWriter(w, &ParallelGzipOptions{Level: level, Workers: o.Workers, BlockSize: o.BlockSize})
+}
+
+// GzipWithOptions 按选项压缩文件或目录为tar.gz, 格式与Gzip相同, opts为nil时与Gzip一致
+func GzipWithOptions(srcFilePath, distFilePath string, opts *GzipOptions) error {
+	return GzipContext(context.Background(), srcFilePath, distFilePath, opts)
+}
+
+// GzipContext 按选项压缩文件或目录为tar.gz, ctx取消时停止压缩并返回ctx.Err()
+func GzipContext(ctx context.Context, srcFilePath, distFilePath string, opts *GzipOptions) error {
 	_ = os.RemoveAll(distFilePath)
 	distFile, err := os.Create(distFilePath)
 	if err != nil {
 		return errors.New("创建压缩文件失败")
 	}
-	gzipFile, err := gzip.NewWriterLevel(distFile, 9)
-	if err != nil {
-		return errors.New("创建压缩文件失败 => " + err.Error())
+	defer distFile.Close()
+	if err = GzipToContext(ctx, distFile, srcFilePath, opts); err != nil {
+		distFile.Close()
+		_ = os.Remove(distFilePath)
+		return err
 	}
-	defer gzipFile.Close()
-	tarWriter := tar.NewWriter(gzipFile)
-	defer tarWriter.Close()
-	open, err := os.Open(srcFilePath)
-	if err != nil {
-		return errors.New("打开文件失败 => " + err.Error())
+	if err = distFile.Close(); err != nil {
+		return errors.New("关闭压缩文件失败 => " + err.Error())
 	}
-	defer open.Close()
-	err = compressGzip(tarWriter, open, "")
+	return nil
+}
+
+// GzipTo 压缩文件或目录为tar.gz并写入w, 格式与Gzip相同
+func GzipTo(w io.Writer, srcFilePath string) error {
+	return GzipToWithOptions(w, srcFilePath, nil)
+}
+
+// GzipToWithOptions 按选项压缩文件或目录为tar.gz并写入w
+func GzipToWithOptions(w io.Writer, srcFilePath string, opts *GzipOptions) error {
+	return GzipToContext(context.Background(), w, srcFilePath, opts)
+}
+
+// GzipToContext 按选项压缩文件或目录为tar.gz并写入w, ctx取消时停止压缩并返回ctx.Err()
+func GzipToContext(ctx context.Context, w io.Writer, srcFilePath string, opts *GzipOptions) error {
+	tracker := newProgressTracker(ctx, opts.progress())
+	// 并行压缩在其它协程中写出数据, 不能在写出时回调
+	compressWriter, err := opts.newWriter(tracker.asyncWriter(w))
 	if err != nil {
 		return err
 	}
+	return writeTar(compressWriter, tracker, func(a *tarArchiver) error {
+		a.fixedTime = opts.fixedTime()
+		return a.addRoot(srcFilePath)
+	})
+}
+
+// writeTar 写入tar并关闭压缩流compressWriter
+func writeTar(compressWriter io.WriteCloser, tracker *progressTracker, add func(a *tarArchiver) error) error {
+	tarWriter := tar.NewWriter(compressWriter)
+	if err := add(newTarArchiver(tarWriter, tracker)); err != nil {
+		_ = compressWriter.Close()
+		return err
+	}
+	if err := tarWriter.Close(); err != nil {
+		_ = compressWriter.Close()
+		return wrapError("关闭tar压缩流失败", err)
+	}
+	if err := compressWriter.Close(); err != nil {
+		return wrapError("关闭压缩流失败", err)
+	}
+	// 关闭时写出的剩余数据
+	tracker.report()
 	return nil
 }
 
-func compressGzip(writer *tar.Writer, file *os.File, prefix string) error {
-	var (
-		err     error
-		stat    os.FileInfo
-		readdir []os.FileInfo
-		fi      *os.File
-		header  *tar.Header
-	)
+// tarArchiver 将本地文件写入tar, 同一文件的多个硬链接只写入一次内容
+// 目录下的条目按名称排序写入, 输出的顺序与文件系统无关
+type tarArchiver struct {
+	w       *tar.Writer
+	tracker *progressTracker
+	links   map[[2]uint64]string
+	// fixedTime 不为nil时为确定性模式, 所有条目使用该修改时间并清除所有者信息
+	fixedTime *time.Time
+}
 
-	defer file.Close()
-	stat, err = file.Stat()
+func newTarArchiver(w *tar.Writer, tracker *progressTracker) *tarArchiver {
+	return &tarArchiver{w: w, tracker: tracker, links: make(map[[2]uint64]string)}
+}
+
+// addRoot 写入需要压缩的根路径, 根路径为符号链接时压缩链接指向的内容
+func (a *tarArchiver) addRoot(filePath string) error {
+	stat, err := os.Stat(filePath)
 	if err != nil {
 		return errors.New("读取目录结构失败 => " + err.Error())
 	}
+	return a.add(filePath, "", stat)
+}
+
+// writeHeader 写入条目头信息, 目录名称以/结尾, 已写入过的硬链接文件写为链接
+// 根目录本身不写入, 与旧版保持一致, 此时返回nil
+func (a *tarArchiver) writeHeader(stat os.FileInfo, link, name string) (*tar.Header, error) {
+	header, err := tar.FileInfoHeader(stat, link)
+	if err != nil {
+		return nil, errors.New("创建压缩文件头信息失败 => " + err.Error())
+	}
+	header.Name = name
+	if a.fixedTime != nil {
+		header.ModTime = *a.fixedTime
+		header.AccessTime = time.Time{}
+		header.ChangeTime = time.Time{}
+		header.Uid, header.Gid = 0, 0
+		header.Uname, header.Gname = "", ""
+	}
 	if stat.IsDir() {
-		readdir, err = file.Readdir(-1)
-		if err != nil {
-			if err != io.EOF {
-				return errors.New("读取目录失败! => " + err.Error())
-			}
+		if name == "" {
+			return nil, nil
 		}
-		for _, val := range readdir {
-			fi, err = os.Open(file.Name() + "/" + val.Name())
-			if err != nil {
-				return errors.New("读取目录中的文件失败 => " + err.Error())
-			}
-			err = compressGzip(writer, fi, prefix+"/"+val.Name())
-			if err != nil {
-				return err
+		header.Name = name + "/"
+	} else if stat.Mode().IsRegular() {
+		if key, ok := fileKey(stat); ok {
+			if first, ok := a.links[key]; ok {
+				header.Typeflag = tar.TypeLink
+				header.Linkname = first
+				header.Size = 0
+			} else {
+				a.links[key] = name
 			}
 		}
-	} else {
-		header, err = tar.FileInfoHeader(stat, "")
+	}
+	if err = a.w.WriteHeader(header); err != nil {
+		return nil, wrapError("写入压缩文信息失败", err)
+	}
+	return header, nil
+}
+
+// writeContent 写入普通文件的内容
+func (a *tarArchiver) writeContent(header *tar.Header, open func() (io.ReadCloser, error)) error {
+	if header == nil || header.Typeflag != tar.TypeReg || header.Size == 0 {
+		return nil
+	}
+	file, err := open()
+	if err != nil {
+		return errors.New("读取目录中的文件失败 => " + err.Error())
+	}
+	defer file.Close()
+	if _, err = io.CopyN(a.w, a.tracker.reader(file), header.Size); err != nil {
+		return wrapError("拷贝文件到压缩包内失败", err)
+	}
+	return nil
+}
+
+func (a *tarArchiver) add(filePath, name string, stat os.FileInfo) error {
+	var link string
+	if stat.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(filePath)
 		if err != nil {
-			return errors.New("创建压缩文件头信息失败! ")
+			return errors.New("读取符号链接失败 => " + err.Error())
 		}
-		header.Name = prefix
-		err = writer.WriteHeader(header)
-		if err != nil {
-			return errors.New("写入压缩文信息失败 => " + err.Error())
+		link = filepath.ToSlash(target)
+	}
+	if err := a.tracker.begin(name); err != nil {
+		return err
+	}
+	header, err := a.writeHeader(stat, link, name)
+	if err != nil {
+		return err
+	}
+	if !stat.IsDir() {
+		err = a.writeContent(header, func() (io.ReadCloser, error) {
+			return os.Open(filePath)
+		})
+		if err == nil {
+			a.tracker.done()
 		}
-		_, err = io.Copy(writer, file)
-		file.Close()
-		if err != nil {
-			return errors.New("拷贝文件到压缩包内失败 => " + err.Error())
+		return err
+	}
+	if header != nil {
+		a.tracker.done()
+	}
+	readdir, err := ioutil.ReadDir(filePath)
+	if err != nil {
+		return errors.New("读取目录失败! => " + err.Error())
+	}
+	for _, val := range readdir {
+		if err = a.add(filepath.Join(filePath, val.Name()), name+"/"+val.Name(), val); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
+// DeCompressGzip 解压tar.gz
 func DeCompressGzip(tarFile, dest string) error {
+	return DeCompressGzipWithOptions(tarFile, dest, nil)
+}
+
+// DeCompressGzipWithOptions 按选项解压tar.gz, opts为nil时使用安全模式
+func DeCompressGzipWithOptions(tarFile, dest string, opts *ExtractOptions) error {
+	return DeCompressGzipContext(context.Background(), tarFile, dest, opts)
+}
+
+// DeCompressGzipContext 按选项解压tar.gz, ctx取消时停止解压并返回ctx.Err()
+func DeCompressGzipContext(ctx context.Context, tarFile, dest string, opts *ExtractOptions) error {
 	srcFile, err := os.Open(tarFile)
 	if err != nil {
 		return errors.New("打开tar.gz文件失败 => " + err.Error())
 	}
 	defer srcFile.Close()
-	return DeCompressGzipByReader(srcFile, dest)
+	return DeCompressGzipByReaderContext(ctx, srcFile, dest, opts)
 }
 
+// DeCompressGzipByReader 从流中解压tar.gz
 func DeCompressGzipByReader(tarFile io.Reader, dest string) error {
-	gr, err := gzip.NewReader(tarFile)
+	return DeCompressGzipByReaderWithOptions(tarFile, dest, nil)
+}
+
+// DeCompressGzipByReaderWithOptions 按选项从流中解压tar.gz, opts为nil时使用安全模式
+func DeCompressGzipByReaderWithOptions(tarFile io.Reader, dest string, opts *ExtractOptions) error {
+	return DeCompressGzipByReaderContext(context.Background(), tarFile, dest, opts)
+}
+
+// DeCompressGzipByReaderContext 按选项从流中解压tar.gz, ctx取消时停止解压并返回ctx.Err()
+func DeCompressGzipByReaderContext(ctx context.Context, tarFile io.Reader, dest string, opts *ExtractOptions) error {
+	tracker := newProgressTracker(ctx, opts.progress())
+	gr, err := gzip.NewReader(tracker.reader(tarFile))
 	if err != nil {
-		return errors.New("创建gzip解压流失败 => " + err.Error())
+		return wrapError("创建gzip解压流失败", err)
 	}
 	defer gr.Close()
-	tr := tar.NewReader(gr)
+	return untar(tracker, gr, dest, opts)
+}
+
+// untar 解压未压缩的tar流
+func untar(tracker *progressTracker, r io.Reader, dest string, opts *ExtractOptions) error {
+	e, err := newExtractor(dest, opts, tracker)
+	if err != nil {
+		return errors.New("创建解压目录失败 => " + err.Error())
+	}
+	tr := tar.NewReader(r)
 	for {
 		hdr, err := tr.Next()
 		if err != nil {
 			if err == io.EOF {
 				break
 			} else {
-				return errors.New("读取压缩包内文件失败 => " + err.Error())
+				return wrapError("读取压缩包内文件失败", err)
+			}
+		}
+		if err = tracker.begin(hdr.Name); err == nil {
+			if err = e.begin(hdr.Name, hdr.Size); err == nil {
+				err = untarEntry(e, tr, hdr)
 			}
 		}
-		filename := dest + hdr.Name
-		file, err := createFile(filename)
 		if err != nil {
-			return errors.New("创建本地临时存储文件失败 => " + err.Error())
+			e.abort(err)
+			return err
 		}
-		_, _ = io.Copy(file, tr)
+		tracker.done()
+	}
+	if err = e.finish(); err != nil {
+		return errors.New("还原目录属性失败 => " + err.Error())
 	}
 	return nil
 }
 
-func createFile(name string) (*os.File, error) {
-	err := os.MkdirAll(string([]rune(name)[0:strings.LastIndex(name, "/")]), 0755)
+func untarEntry(e *extractor, tr *tar.Reader, hdr *tar.Header) error {
+	var (
+		p   string
+		err error
+	)
+	mode := hdr.FileInfo().Mode()
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		p, err = e.mkdir(hdr.Name)
+	case tar.TypeReg, tar.TypeRegA:
+		p, err = e.writeFile(hdr.Name, tr, mode)
+	case tar.TypeSymlink:
+		p, err = e.symlink(hdr.Name, hdr.Linkname)
+	case tar.TypeLink:
+		// 硬链接与目标共享属性, 无需单独还原
+		if _, err = e.hardlink(hdr.Name, hdr.Linkname); err != nil {
+			return wrapError("创建硬链接失败", err)
+		}
+		return nil
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		if e.safe() {
+			return &UnsafeEntryError{Name: hdr.Name, Reason: "不支持的特殊文件类型"}
+		}
+		return nil
+	default:
+		return nil
+	}
 	if err != nil {
-		return nil, errors.New("创建临时目录失败 => " + err.Error())
+		return wrapError("创建本地临时存储文件失败", err)
 	}
-	return os.Create(name)
+	err = e.setMeta(&entryMeta{path: p, mode: mode, modTime: hdr.ModTime, uid: hdr.Uid, gid: hdr.Gid})
+	if err != nil {
+		return errors.New("还原文件属性失败 => " + err.Error())
+	}
+	return nil
 }
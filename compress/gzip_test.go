@@ -0,0 +1,192 @@
+package compress
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGzipFidelity(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gzip-test")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "jdk")
+	writeTestTree(t, src)
+	if err = os.Symlink("run.sh", filepath.Join(src, "bin/java")); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if err = os.Link(filepath.Join(src, "lib/app.jar"), filepath.Join(src, "lib/app-link.jar")); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if err = os.Chmod(filepath.Join(src, "conf"), 0700); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	modTime := time.Date(2021, 5, 6, 7, 8, 9, 0, time.UTC)
+	if err = os.Chtimes(filepath.Join(src, "conf"), modTime, modTime); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	tarFile := filepath.Join(dir, "jdk.tar.gz")
+	if err = Gzip(src, tarFile); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	dest := filepath.Join(dir, "dest")
+	if err = DeCompressGzip(tarFile, dest); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	stat, err := os.Stat(filepath.Join(dest, "bin/run.sh"))
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if stat.Mode().Perm() != 0755 {
+		t.Errorf("可执行权限未保留: %v", stat.Mode())
+	}
+	if target, err := os.Readlink(filepath.Join(dest, "bin/java")); err != nil || target != "run.sh" {
+		t.Errorf("符号链接未保留: %s %v", target, err)
+	}
+	jar, _ := os.Stat(filepath.Join(dest, "lib/app.jar"))
+	link, err := os.Stat(filepath.Join(dest, "lib/app-link.jar"))
+	if err != nil || !os.SameFile(jar, link) {
+		t.Error("硬链接未保留")
+	}
+	if stat, err = os.Stat(filepath.Join(dest, "conf")); err != nil || stat.Mode().Perm() != 0700 || !stat.ModTime().Equal(modTime) {
+		t.Error("目录权限或修改时间未保留")
+	}
+	if stat, err = os.Stat(filepath.Join(dest, "conf/app.properties")); err != nil || !stat.ModTime().Equal(time.Date(2020, 1, 2, 3, 4, 6, 0, time.UTC)) {
+		t.Error("文件修改时间未保留")
+	}
+	if stat, err = os.Stat(filepath.Join(dest, "empty")); err != nil || !stat.IsDir() {
+		t.Error("空目录未保留")
+	}
+}
+
+func TestGzipFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gzip-test")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "app.data")
+	if err = ioutil.WriteFile(src, []byte("app data"), 0600); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	tarFile := filepath.Join(dir, "app.content")
+	if err = Gzip(src, tarFile); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	dest := filepath.Join(dir, "out", "app.data")
+	if err = DeCompressGzip(tarFile, dest); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	content, err := ioutil.ReadFile(dest)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if string(content) != "app data" {
+		t.Error("解压后的文件内容不一致")
+	}
+}
+
+// touchTree 修改目录下所有文件的修改时间
+func touchTree(t *testing.T, dir string, modTime time.Time) {
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Chtimes(p, modTime, modTime)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGzipDeterministic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gzip-test")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	var outputs [][]byte
+	for _, src := range []string{"a", "b"} {
+		src = filepath.Join(dir, src)
+		writeTestTree(t, src)
+		touchTree(t, src, time.Now().Add(-time.Duration(len(outputs))*time.Hour))
+		tarFile := filepath.Join(dir, "app.tar.gz")
+		// 单线程与多线程压缩的结果也应当一致
+		workers := 1 + 3*len(outputs)
+		if err = GzipWithOptions(src, tarFile, &GzipOptions{Deterministic: true, Workers: workers, BlockSize: 1024}); err != nil {
+			t.Error(err.Error())
+			return
+		}
+		data, err := ioutil.ReadFile(tarFile)
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		outputs = append(outputs, data)
+	}
+	if string(outputs[0]) != string(outputs[1]) {
+		t.Error("确定性模式下相同的输入应当产生相同的压缩包")
+	}
+
+	entries, err := List(filepath.Join(dir, "app.tar.gz"))
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	for _, entry := range entries {
+		if !entry.ModTime.Equal(defaultDeterministicTime) {
+			t.Errorf("%s 的修改时间未统一: %v", entry.Name, entry.ModTime)
+		}
+	}
+}
+
+func TestDeCompressGzipReplacedDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gzip-test")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+	// d的属性延迟还原, 此时d已被替换为指向target的符号链接, 不能修改target的权限
+	data := buildTarGz(t, []*tar.Header{
+		{Name: "d/", Typeflag: tar.TypeDir, Mode: 0700},
+		{Name: "target/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "d", Typeflag: tar.TypeSymlink, Linkname: "target"},
+	}, []string{"", "", ""})
+	dest := filepath.Join(dir, "dest")
+	if err = DeCompressGzipByReader(bytes.NewReader(data), dest); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	stat, err := os.Stat(filepath.Join(dest, "target"))
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if stat.Mode().Perm() != 0755 {
+		t.Errorf("符号链接的目标权限被修改为 %v", stat.Mode().Perm())
+	}
+}
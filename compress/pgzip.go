@@ -0,0 +1,216 @@
+package compress
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// defaultGzipBlockSize 并行压缩默认的块大小
+const defaultGzipBlockSize = 1 << 20
+
+// ParallelGzipOptions 并行gzip压缩选项
+type ParallelGzipOptions struct {
+	// Level 压缩级别, 为0时使用9
+	Level int
+	// Workers 并行压缩的协程数, 为0时使用CPU核数
+	Workers int
+	// BlockSize 每块数据的大小, 为0时使用1MB
+	BlockSize int
+}
+
+// gzipBlock 一块待压缩的数据
+type gzipBlock struct {
+	data  []byte
+	final bool
+	out   bytes.Buffer
+	err   error
+	done  chan struct{}
+}
+
+// ParallelGzipWriter 多核并行gzip压缩
+// 数据被切分为互相独立的块并行压缩为deflate数据, 按顺序拼接为单个gzip成员, 可以被标准gzip解压
+// 输出只与压缩级别和块大小有关, 与协程数无关
+type ParallelGzipWriter struct {
+	w         io.Writer
+	level     int
+	blockSize int
+	crc       uint32
+	size      uint32
+	buf       []byte
+	jobs      chan *gzipBlock
+	queue     chan *gzipBlock
+	wait      sync.WaitGroup
+	done      chan struct{}
+	lock      sync.Mutex
+	err       error
+	closed    bool
+}
+
+// NewParallelGzipWriter 创建并行gzip压缩, opts可以为nil, Close时写入结尾但不会关闭w
+func NewParallelGzipWriter(w io.Writer, opts *ParallelGzipOptions) (*ParallelGzipWriter, error) {
+	level, workers, blockSize := 9, runtime.NumCPU(), defaultGzipBlockSize
+	if opts != nil {
+		if opts.Level != 0 {
+			level = opts.Level
+		}
+		if opts.Workers > 0 {
+			workers = opts.Workers
+		}
+		if opts.BlockSize > 0 {
+			blockSize = opts.BlockSize
+		}
+	}
+	if level < flate.HuffmanOnly || level > flate.BestCompression {
+		return nil, errors.New("无效的gzip压缩级别")
+	}
+
+	z := &ParallelGzipWriter{
+		w:         w,
+		level:     level,
+		blockSize: blockSize,
+		buf:       make([]byte, 0, blockSize),
+		jobs:      make(chan *gzipBlock, workers),
+		queue:     make(chan *gzipBlock, workers*2),
+		done:      make(chan struct{}),
+	}
+	// 压缩级别为9时XFL为2, 为1时XFL为4
+	xfl := byte(0)
+	switch level {
+	case flate.BestCompression:
+		xfl = 2
+	case flate.BestSpeed:
+		xfl = 4
+	}
+	if _, err := w.Write([]byte{0x1f, 0x8b, 8, 0, 0, 0, 0, 0, xfl, 255}); err != nil {
+		return nil, errors.New("写入gzip头失败 => " + err.Error())
+	}
+
+	z.wait.Add(workers)
+	for i := 0; i < workers; i++ {
+		go z.compress()
+	}
+	go z.output()
+	return z, nil
+}
+
+// compress 压缩协程, 每个协程复用一个flate.Writer
+func (z *ParallelGzipWriter) compress() {
+	defer z.wait.Done()
+	var fw *flate.Writer
+	for block := range z.jobs {
+		if fw == nil {
+			fw, block.err = flate.NewWriter(&block.out, z.level)
+		} else {
+			fw.Reset(&block.out)
+		}
+		if block.err == nil {
+			_, block.err = fw.Write(block.data)
+		}
+		if block.err == nil {
+			// 非最后一块使用同步刷新, 以字节对齐结束且不设置结束标记
+			if block.final {
+				block.err = fw.Close()
+			} else {
+				block.err = fw.Flush()
+			}
+		}
+		close(block.done)
+	}
+}
+
+// output 按顺序写出压缩后的数据
+func (z *ParallelGzipWriter) output() {
+	defer close(z.done)
+	for block := range z.queue {
+		<-block.done
+		if z.error() != nil {
+			continue
+		}
+		if block.err != nil {
+			z.setError(errors.New("压缩数据失败 => " + block.err.Error()))
+			continue
+		}
+		if _, err := z.w.Write(block.out.Bytes()); err != nil {
+			z.setError(wrapError("写出压缩数据失败", err))
+		}
+	}
+}
+
+func (z *ParallelGzipWriter) error() error {
+	z.lock.Lock()
+	defer z.lock.Unlock()
+	return z.err
+}
+
+func (z *ParallelGzipWriter) setError(err error) {
+	z.lock.Lock()
+	defer z.lock.Unlock()
+	if z.err == nil {
+		z.err = err
+	}
+}
+
+// submit 提交当前块
+func (z *ParallelGzipWriter) submit(final bool) {
+	block := &gzipBlock{data: z.buf, final: final, done: make(chan struct{})}
+	z.queue <- block
+	z.jobs <- block
+	if !final {
+		z.buf = make([]byte, 0, z.blockSize)
+	}
+}
+
+// Write 写入需要压缩的数据
+func (z *ParallelGzipWriter) Write(p []byte) (int, error) {
+	if z.closed {
+		return 0, errors.New("压缩流已关闭")
+	}
+	if err := z.error(); err != nil {
+		return 0, err
+	}
+	z.crc = crc32.Update(z.crc, crc32.IEEETable, p)
+	z.size += uint32(len(p))
+	n := 0
+	for len(p) > 0 {
+		free := z.blockSize - len(z.buf)
+		if free > len(p) {
+			free = len(p)
+		}
+		z.buf = append(z.buf, p[:free]...)
+		p = p[free:]
+		n += free
+		if len(z.buf) == z.blockSize {
+			z.submit(false)
+		}
+	}
+	return n, nil
+}
+
+// Close 压缩剩余的数据并写入gzip结尾, 不会关闭底层的io.Writer
+func (z *ParallelGzipWriter) Close() error {
+	if z.closed {
+		return z.error()
+	}
+	z.closed = true
+	z.submit(true)
+	close(z.jobs)
+	close(z.queue)
+	z.wait.Wait()
+	<-z.done
+	if err := z.error(); err != nil {
+		return err
+	}
+	trailer := make([]byte, 8)
+	binary.LittleEndian.PutUint32(trailer, z.crc)
+	binary.LittleEndian.PutUint32(trailer[4:], z.size)
+	if _, err := z.w.Write(trailer); err != nil {
+		return errors.New("写入gzip结尾失败 => " + err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testGzipData 生成部分可压缩的数据
+func testGzipData(size int) []byte {
+	r := rand.New(rand.NewSource(1))
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = "abcdefghijklmnopqrstuvwxyz .\n"[r.Intn(29)]
+	}
+	return data
+}
+
+func TestParallelGzipWriter(t *testing.T) {
+	const blockSize = 4096
+	for _, size := range []int{0, 1, blockSize - 1, blockSize, blockSize*3 + 1234} {
+		data := testGzipData(size)
+		var first []byte
+		for _, workers := range []int{1, 3, 8} {
+			buf := &bytes.Buffer{}
+			w, err := NewParallelGzipWriter(buf, &ParallelGzipOptions{Workers: workers, BlockSize: blockSize})
+			if err != nil {
+				t.Error(err.Error())
+				return
+			}
+			// 分多次写入, 覆盖跨块的情况
+			for p := data; len(p) > 0; {
+				n := 1000
+				if n > len(p) {
+					n = len(p)
+				}
+				if _, err = w.Write(p[:n]); err != nil {
+					t.Error(err.Error())
+					return
+				}
+				p = p[n:]
+			}
+			if err = w.Close(); err != nil {
+				t.Error(err.Error())
+				return
+			}
+
+			gr, err := gzip.NewReader(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Error(err.Error())
+				return
+			}
+			result, err := ioutil.ReadAll(gr)
+			if err != nil {
+				t.Errorf("size %d workers %d: %s", size, workers, err.Error())
+				return
+			}
+			if !bytes.Equal(result, data) {
+				t.Errorf("size %d workers %d: 解压后的数据不一致", size, workers)
+			}
+			if first == nil {
+				first = buf.Bytes()
+			} else if !bytes.Equal(first, buf.Bytes()) {
+				t.Errorf("size %d: 不同协程数的输出不一致", size)
+			}
+		}
+	}
+}
+
+func TestGzipWithOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pgzip-test")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src")
+	writeTestTree(t, src)
+	if err = ioutil.WriteFile(filepath.Join(src, "lib/big.bin"), testGzipData(300000), 0644); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	tarFile := filepath.Join(dir, "app.tar.gz")
+	if err = GzipWithOptions(src, tarFile, &GzipOptions{Workers: 4, BlockSize: 64 << 10}); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	dest := filepath.Join(dir, "dest")
+	if err = DeCompressGzip(tarFile, dest); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	content, err := ioutil.ReadFile(filepath.Join(dest, "lib/big.bin"))
+	if err != nil || !bytes.Equal(content, testGzipData(300000)) {
+		t.Error("解压后的文件内容不一致")
+	}
+}
+
+func BenchmarkGzipWriter(b *testing.B) {
+	data := testGzipData(8 << 20)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w, _ := gzip.NewWriterLevel(ioutil.Discard, 9)
+		w.Write(data)
+		w.Close()
+	}
+}
+
+func BenchmarkParallelGzipWriter(b *testing.B) {
+	data := testGzipData(8 << 20)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w, _ := NewParallelGzipWriter(ioutil.Discard, nil)
+		w.Write(data)
+		w.Close()
+	}
+}
@@ -0,0 +1,157 @@
+package compress
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+)
+
+// Progress 压缩与解压的进度
+type Progress struct {
+	// Entries 已处理完成的条目数
+	Entries int
+	// BytesIn 已读取的字节数, 压缩时为源文件的大小, 解压时为压缩包的大小
+	BytesIn int64
+	// BytesOut 已写出的字节数, 压缩时为压缩包的大小, 解压时为解压出的文件的大小
+	BytesOut int64
+	// Name 当前处理的条目名称
+	Name string
+}
+
+// ProgressFunc 进度回调, 在开始处理条目、读写数据与条目处理完成时调用
+type ProgressFunc func(p Progress)
+
+// progressTracker 统计进度并检查是否已取消, 回调只在调用方的协程中执行
+type progressTracker struct {
+	// asyncOut 其它协程写出的字节数, 使用原子操作读写, 放在首位保证32位系统上的对齐
+	asyncOut int64
+	ctx      context.Context
+	fn       ProgressFunc
+	p        Progress
+}
+
+func newProgressTracker(ctx context.Context, fn ProgressFunc) *progressTracker {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return &progressTracker{ctx: ctx, fn: fn}
+}
+
+// check 检查是否已取消
+func (t *progressTracker) check() error {
+	return t.ctx.Err()
+}
+
+func (t *progressTracker) report() {
+	if t.fn != nil {
+		p := t.p
+		p.BytesOut += atomic.LoadInt64(&t.asyncOut)
+		t.fn(p)
+	}
+}
+
+// begin 开始处理条目
+func (t *progressTracker) begin(name string) error {
+	if err := t.check(); err != nil {
+		return err
+	}
+	t.p.Name = name
+	t.report()
+	return nil
+}
+
+// done 条目处理完成
+func (t *progressTracker) done() {
+	t.p.Entries++
+	t.report()
+}
+
+func (t *progressTracker) addIn(n int64) {
+	t.p.BytesIn += n
+	t.report()
+}
+
+func (t *progressTracker) addOut(n int64) {
+	t.p.BytesOut += n
+	t.report()
+}
+
+// reader 统计读取的字节数为BytesIn, 每次读取前检查是否已取消
+func (t *progressTracker) reader(r io.Reader) io.Reader {
+	return &progressReader{r: r, t: t}
+}
+
+// writer 统计写出的字节数为BytesOut, 每次写出前检查是否已取消
+func (t *progressTracker) writer(w io.Writer) io.Writer {
+	return &progressWriter{w: w, t: t}
+}
+
+// asyncWriter 统计写出的字节数为BytesOut, 可以在其它协程中写出
+// 只累加计数, 不调用回调, 由调用方的协程在下次报告进度时读取
+func (t *progressTracker) asyncWriter(w io.Writer) io.Writer {
+	return &asyncProgressWriter{w: w, t: t}
+}
+
+type progressReader struct {
+	r io.Reader
+	t *progressTracker
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	if err := r.t.check(); err != nil {
+		return 0, err
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.t.addIn(int64(n))
+	}
+	return n, err
+}
+
+type progressWriter struct {
+	w io.Writer
+	t *progressTracker
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	if err := w.t.check(); err != nil {
+		return 0, err
+	}
+	n, err := w.w.Write(p)
+	if n > 0 {
+		w.t.addOut(int64(n))
+	}
+	return n, err
+}
+
+// wrapError 包装错误信息, UnsafeEntryError、LimitError、密码错误与取消产生的错误原样返回以便调用方判断
+func wrapError(msg string, err error) error {
+	switch err.(type) {
+	case *UnsafeEntryError, *LimitError:
+		return err
+	}
+	if err == ErrPasswordRequired || err == ErrWrongPassword {
+		return err
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return errors.New(msg + " => " + err.Error())
+}
+
+type asyncProgressWriter struct {
+	w io.Writer
+	t *progressTracker
+}
+
+func (w *asyncProgressWriter) Write(p []byte) (int, error) {
+	if err := w.t.check(); err != nil {
+		return 0, err
+	}
+	n, err := w.w.Write(p)
+	if n > 0 {
+		atomic.AddInt64(&w.t.asyncOut, int64(n))
+	}
+	return n, err
+}
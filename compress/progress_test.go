@@ -0,0 +1,162 @@
+package compress
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProgressParallelGzip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "progress-test")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+	writeTestTree(t, dir)
+	if err = ioutil.WriteFile(filepath.Join(dir, "lib/big.bin"), bytes.Repeat([]byte("0123456789"), 100*1024), 0644); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	// 并行压缩在其它协程中写出数据, 回调应当只在调用方的协程中执行, 使用-race检查
+	var last Progress
+	calls := 0
+	progress := func(p Progress) {
+		if p.BytesOut < last.BytesOut {
+			t.Error("进度不应当减少")
+		}
+		last = p
+		calls++
+	}
+	var buf bytes.Buffer
+	if err = GzipToWithOptions(&buf, dir, &GzipOptions{Workers: 4, BlockSize: 4096, Progress: progress}); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if calls == 0 || last.BytesOut != int64(buf.Len()) || last.BytesIn != 42+100*1024*10 {
+		t.Errorf("压缩进度不正确: %+v", last)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "progress-test")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src")
+	writeTestTree(t, src)
+
+	var last Progress
+	names := map[string]bool{}
+	progress := func(p Progress) {
+		if p.Entries < last.Entries || p.BytesIn < last.BytesIn || p.BytesOut < last.BytesOut {
+			t.Error("进度不应当减少")
+		}
+		last = p
+		names[p.Name] = true
+	}
+
+	tarFile := filepath.Join(dir, "app.tar.gz")
+	err = GzipContext(context.Background(), src, tarFile, &GzipOptions{Workers: 1, Progress: progress})
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	stat, _ := os.Stat(tarFile)
+	// 4个文件与5个目录
+	if last.Entries != 9 || last.BytesOut != stat.Size() || last.BytesIn != 42 || !names["/conf/app.properties"] {
+		t.Errorf("压缩进度不正确: %+v", last)
+	}
+
+	last = Progress{}
+	err = DeCompressGzipContext(context.Background(), tarFile, filepath.Join(dir, "dest"), &ExtractOptions{Progress: progress})
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if last.Entries != 9 || last.BytesIn != stat.Size() || last.BytesOut != 42 {
+		t.Errorf("解压进度不正确: %+v", last)
+	}
+
+	zipFile := filepath.Join(dir, "app.zip")
+	last = Progress{}
+	if err = ZipContext(context.Background(), src, zipFile, &ZipOptions{Progress: progress}); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if last.Entries != 9 || last.BytesIn != 42 {
+		t.Errorf("zip压缩进度不正确: %+v", last)
+	}
+	last = Progress{}
+	err = UnzipContext(context.Background(), zipFile, filepath.Join(dir, "unzip"), &ExtractOptions{Progress: progress})
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if last.Entries != 9 || last.BytesOut != 42 {
+		t.Errorf("zip解压进度不正确: %+v", last)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "progress-test")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src")
+	writeTestTree(t, src)
+	tarFile := filepath.Join(dir, "app.tar.gz")
+	if err = Gzip(src, tarFile); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	zipFile := filepath.Join(dir, "app.zip")
+	if err = Zip(src, zipFile, nil); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	// 处理完第一个条目后取消
+	newCancel := func() (context.Context, ProgressFunc) {
+		ctx, cancel := context.WithCancel(context.Background())
+		return ctx, func(p Progress) {
+			if p.Entries > 0 {
+				cancel()
+			}
+		}
+	}
+
+	ctx, progress := newCancel()
+	err = DeCompressGzipContext(ctx, tarFile, filepath.Join(dir, "dest"), &ExtractOptions{Progress: progress})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("解压tar.gz应当被取消: %v", err)
+	}
+	ctx, progress = newCancel()
+	err = UnzipContext(ctx, zipFile, filepath.Join(dir, "unzip"), &ExtractOptions{Progress: progress})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("解压zip应当被取消: %v", err)
+	}
+	ctx, progress = newCancel()
+	out := filepath.Join(dir, "cancel.tar.gz")
+	err = GzipContext(ctx, src, out, &GzipOptions{Progress: progress})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("压缩tar.gz应当被取消: %v", err)
+	}
+	if _, err = os.Stat(out); err == nil {
+		t.Error("取消后应当删除未完成的压缩文件")
+	}
+	ctx, progress = newCancel()
+	err = ZipContext(ctx, src, filepath.Join(dir, "cancel.zip"), &ZipOptions{Progress: progress})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("压缩zip应当被取消: %v", err)
+	}
+}
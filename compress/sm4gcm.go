@@ -0,0 +1,385 @@
+package compress
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"github.com/byzk-org/common-utils/gmsm"
+	"github.com/tjfoc/gmsm/sm4"
+	"io"
+	"os"
+)
+
+// SM4-GCM加密容器的格式, 所有整数均为大端序:
+//
+//	magic(6) version(1) kdf(1) iterations(4) chunkSize(4) salt(16) noncePrefix(7)
+//	chunk... 每块为chunkSize字节明文的密文与16字节认证标签, 最后一块可以更短
+//
+// 每块的nonce为noncePrefix + 块序号(4) + 是否最后一块(1), 文件头作为每块的附加认证数据,
+// 因此调换、删除、截断数据块以及修改文件头都会导致解密失败
+const (
+	sm4GcmVersion     = 1
+	sm4GcmHeaderSize  = 39
+	sm4GcmSaltSize    = 16
+	sm4GcmPrefixSize  = 7
+	sm4GcmTagSize     = 16
+	sm4GcmChunkSize   = 64 * 1024
+	sm4GcmMaxChunk    = 16 * 1024 * 1024
+	sm4GcmIterations  = 100000
+	sm4GcmMaxIter     = 10000000
+	sm4GcmKdfKey      = 1
+	sm4GcmKdfPassword = 2
+)
+
+var sm4GcmMagic = []byte("BZSM4\x00")
+
+// sm4GcmInfo HKDF派生内容密钥时使用的信息
+var sm4GcmInfo = []byte("common-utils compress sm4-gcm")
+
+// Sm4Options SM4-GCM加密选项, Key与Password二选一, 同时设置时使用Key
+type Sm4Options struct {
+	// Key 16字节的SM4密钥, 每个压缩包通过HKDF-SM3与随机盐值派生独立的内容密钥
+	Key []byte
+	// Password 口令, 通过PBKDF2-SM3派生内容密钥
+	Password string
+	// Iterations PBKDF2迭代次数, 为0时使用100000, 解密时从文件头中读取
+	Iterations int
+	// ChunkSize 每块明文的大小, 为0时使用64KB
+	ChunkSize int
+	// Format 加密前使用的压缩格式, 为0时使用FormatGzip, 仅用于Sm4Archive
+	Format Format
+}
+
+// sm4GcmKey 派生内容密钥
+func sm4GcmKey(kdf byte, key []byte, password string, salt []byte, iter int) ([]byte, error) {
+	switch kdf {
+	case sm4GcmKdfKey:
+		if len(key) != sm4.BlockSize {
+			return nil, errors.New("sm4密钥长度错误")
+		}
+		return gmsm.Hkdf(gmsm.KdfHashSm3, key, salt, sm4GcmInfo, sm4.BlockSize)
+	case sm4GcmKdfPassword:
+		if password == "" {
+			return nil, ErrPasswordRequired
+		}
+		return gmsm.Pbkdf2(gmsm.KdfHashSm3, []byte(password), salt, iter, sm4.BlockSize)
+	default:
+		return nil, errors.New("不支持的密钥派生方式")
+	}
+}
+
+func newSm4Gcm(key []byte) (cipher.AEAD, error) {
+	block, err := sm4.NewCipher(key)
+	if err != nil {
+		return nil, errors.New("创建sm4加密器失败 => " + err.Error())
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.New("创建sm4-gcm加密器失败 => " + err.Error())
+	}
+	return aead, nil
+}
+
+// sm4GcmStream 分块加解密的公共状态
+type sm4GcmStream struct {
+	aead    cipher.AEAD
+	header  []byte
+	nonce   []byte
+	counter uint32
+}
+
+func (s *sm4GcmStream) nextNonce(last bool) ([]byte, error) {
+	if s.counter == 1<<32-1 {
+		return nil, errors.New("sm4-gcm加密数据块过多")
+	}
+	binary.BigEndian.PutUint32(s.nonce[sm4GcmPrefixSize:], s.counter)
+	s.nonce[len(s.nonce)-1] = 0
+	if last {
+		s.nonce[len(s.nonce)-1] = 1
+	}
+	s.counter++
+	return s.nonce, nil
+}
+
+// sm4GcmWriter 分块加密写入
+type sm4GcmWriter struct {
+	w   io.Writer
+	s   *sm4GcmStream
+	buf []byte
+	out []byte
+	err error
+}
+
+// NewSm4GcmWriter 创建SM4-GCM加密流, Close时写入最后一块但不会关闭w
+func NewSm4GcmWriter(w io.Writer, opts *Sm4Options) (io.WriteCloser, error) {
+	if opts == nil {
+		return nil, errors.New("sm4-gcm加密选项不能为空")
+	}
+	iter, chunkSize := opts.Iterations, opts.ChunkSize
+	if iter == 0 {
+		iter = sm4GcmIterations
+	}
+	if chunkSize == 0 {
+		chunkSize = sm4GcmChunkSize
+	}
+	if iter < 0 || iter > sm4GcmMaxIter || chunkSize < 0 || chunkSize > sm4GcmMaxChunk {
+		return nil, errors.New("sm4-gcm加密选项错误")
+	}
+	kdf := byte(sm4GcmKdfPassword)
+	if len(opts.Key) > 0 {
+		kdf = sm4GcmKdfKey
+	}
+
+	header := make([]byte, sm4GcmHeaderSize)
+	copy(header, sm4GcmMagic)
+	header[6] = sm4GcmVersion
+	header[7] = kdf
+	binary.BigEndian.PutUint32(header[8:], uint32(iter))
+	binary.BigEndian.PutUint32(header[12:], uint32(chunkSize))
+	if _, err := io.ReadFull(rand.Reader, header[16:]); err != nil {
+		return nil, errors.New("生成随机数失败 => " + err.Error())
+	}
+	key, err := sm4GcmKey(kdf, opts.Key, opts.Password, header[16:16+sm4GcmSaltSize], iter)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newSm4Gcm(key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(header); err != nil {
+		return nil, err
+	}
+	return &sm4GcmWriter{
+		w:   w,
+		s:   &sm4GcmStream{aead: aead, header: header, nonce: sm4GcmNonce(header)},
+		buf: make([]byte, 0, chunkSize),
+	}, nil
+}
+
+func sm4GcmNonce(header []byte) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, header[16+sm4GcmSaltSize:])
+	return nonce
+}
+
+func (w *sm4GcmWriter) flush(last bool) error {
+	nonce, err := w.s.nextNonce(last)
+	if err != nil {
+		return err
+	}
+	w.out = w.s.aead.Seal(w.out[:0], nonce, w.buf, w.s.header)
+	w.buf = w.buf[:0]
+	_, err = w.w.Write(w.out)
+	return err
+}
+
+func (w *sm4GcmWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	written := 0
+	for len(p) > 0 {
+		// 缓冲区已满且还有数据时才写出, 保证最后一块在Close时标记
+		if len(w.buf) == cap(w.buf) {
+			if w.err = w.flush(false); w.err != nil {
+				return written, w.err
+			}
+		}
+		n := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (w *sm4GcmWriter) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	w.err = errors.New("sm4-gcm加密流已关闭")
+	return w.flush(true)
+}
+
+// sm4GcmReader 分块解密读取
+type sm4GcmReader struct {
+	r     *bufio.Reader
+	s     *sm4GcmStream
+	chunk []byte
+	buf   []byte
+	plain []byte
+	done  bool
+	err   error
+}
+
+// NewSm4GcmReader 创建SM4-GCM解密流, 每块数据在认证通过后才会返回
+// 口令错误与密钥错误无法区分, 均在读取第一块数据时返回ErrWrongPassword
+func NewSm4GcmReader(r io.Reader, opts *Sm4Options) (io.Reader, error) {
+	if opts == nil {
+		return nil, errors.New("sm4-gcm解密选项不能为空")
+	}
+	header := make([]byte, sm4GcmHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, errors.New("读取sm4-gcm文件头失败 => " + err.Error())
+	}
+	if !bytes.Equal(header[:len(sm4GcmMagic)], sm4GcmMagic) {
+		return nil, errors.New("数据不是sm4-gcm加密格式")
+	}
+	if header[6] != sm4GcmVersion {
+		return nil, errors.New("不支持的sm4-gcm格式版本")
+	}
+	iter := binary.BigEndian.Uint32(header[8:])
+	chunkSize := binary.BigEndian.Uint32(header[12:])
+	if iter == 0 || iter > sm4GcmMaxIter || chunkSize == 0 || chunkSize > sm4GcmMaxChunk {
+		return nil, errors.New("sm4-gcm文件头参数错误")
+	}
+	kdf := header[7]
+	if kdf == sm4GcmKdfKey && len(opts.Key) == 0 {
+		return nil, errors.New("sm4-gcm压缩包使用密钥加密, 需要提供密钥")
+	}
+	key, err := sm4GcmKey(kdf, opts.Key, opts.Password, header[16:16+sm4GcmSaltSize], int(iter))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newSm4Gcm(key)
+	if err != nil {
+		return nil, err
+	}
+	return &sm4GcmReader{
+		r:     bufio.NewReader(r),
+		s:     &sm4GcmStream{aead: aead, header: header, nonce: sm4GcmNonce(header)},
+		chunk: make([]byte, int(chunkSize)+sm4GcmTagSize),
+	}, nil
+}
+
+func (r *sm4GcmReader) next() error {
+	n, err := io.ReadFull(r.r, r.chunk)
+	last := false
+	switch err {
+	case nil:
+		// 读满一块时需要判断之后是否还有数据
+		if _, err = r.r.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	case io.ErrUnexpectedEOF:
+		last = true
+	case io.EOF:
+		return errors.New("sm4-gcm数据不完整")
+	default:
+		return err
+	}
+	if n < sm4GcmTagSize {
+		return errors.New("sm4-gcm数据不完整")
+	}
+	nonce, err := r.s.nextNonce(last)
+	if err != nil {
+		return err
+	}
+	r.buf, err = r.s.aead.Open(r.buf[:0], nonce, r.chunk[:n], r.s.header)
+	if err != nil {
+		if r.s.counter == 1 {
+			return ErrWrongPassword
+		}
+		return errors.New("sm4-gcm数据认证失败, 数据已损坏或被篡改")
+	}
+	r.plain = r.buf
+	r.done = last
+	return nil
+}
+
+func (r *sm4GcmReader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.done {
+			r.err = io.EOF
+			return 0, r.err
+		}
+		if r.err = r.next(); r.err != nil {
+			return 0, r.err
+		}
+	}
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+// Sm4Archive 压缩文件或目录并使用SM4-GCM加密, 压缩格式由opts.Format决定
+func Sm4Archive(srcPath, destFile string, opts *Sm4Options) error {
+	format := FormatGzip
+	if opts != nil && opts.Format != FormatUnknown {
+		format = opts.Format
+	}
+	if format == FormatZip {
+		return errors.New("sm4-gcm加密仅支持tar格式")
+	}
+	_ = os.RemoveAll(destFile)
+	file, err := os.Create(destFile)
+	if err != nil {
+		return errors.New("创建压缩文件失败 => " + err.Error())
+	}
+	defer file.Close()
+	err = func() error {
+		encryptWriter, err := NewSm4GcmWriter(file, opts)
+		if err != nil {
+			return err
+		}
+		if err = ArchiveTo(encryptWriter, srcPath, format); err != nil {
+			return err
+		}
+		return encryptWriter.Close()
+	}()
+	if err != nil {
+		file.Close()
+		_ = os.Remove(destFile)
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return errors.New("关闭压缩文件失败 => " + err.Error())
+	}
+	return nil
+}
+
+// extractSm4 解密SM4-GCM压缩包并解压其中的tar
+func extractSm4(tracker *progressTracker, r io.Reader, destDir string, opts *ExtractOptions) error {
+	sm4Opts := &Sm4Options{}
+	if opts != nil {
+		sm4Opts.Key, sm4Opts.Password = opts.Sm4Key, opts.Password
+	}
+	if sm4Opts.Password == "" && len(sm4Opts.Key) == 0 {
+		return ErrPasswordRequired
+	}
+	reader, err := NewSm4GcmReader(r, sm4Opts)
+	if err != nil {
+		return err
+	}
+	format, reader, err := Detect(reader)
+	if err != nil {
+		return wrapError("解密压缩包失败", err)
+	}
+	if format == FormatZip || format == FormatSm4Gcm {
+		return errors.New("sm4-gcm压缩包内不是tar格式")
+	}
+	return extractTar(tracker, format, reader, destDir, opts)
+}
+
+// Sm4Extract 解密并解压SM4-GCM压缩包, 解压选项可以为nil
+func Sm4Extract(archiveFile, destDir string, opts *Sm4Options, extractOpts *ExtractOptions) error {
+	if opts == nil {
+		return errors.New("sm4-gcm解密选项不能为空")
+	}
+	o := ExtractOptions{}
+	if extractOpts != nil {
+		o = *extractOpts
+	}
+	o.Sm4Key, o.Password = opts.Key, opts.Password
+	return ExtractContext(context.Background(), archiveFile, destDir, &o)
+}
@@ -0,0 +1,126 @@
+package compress
+
+import (
+	"bytes"
+	"github.com/byzk-org/common-utils/gmsm"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func sm4GcmRoundTrip(plain []byte, opts *Sm4Options) ([]byte, []byte, error) {
+	var buf bytes.Buffer
+	writer, err := NewSm4GcmWriter(&buf, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err = writer.Write(plain); err != nil {
+		return nil, nil, err
+	}
+	if err = writer.Close(); err != nil {
+		return nil, nil, err
+	}
+	reader, err := NewSm4GcmReader(bytes.NewReader(buf.Bytes()), opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	result, err := ioutil.ReadAll(reader)
+	return buf.Bytes(), result, err
+}
+
+func TestSm4GcmStream(t *testing.T) {
+	key := gmsm.Sm4RandomKey()
+	for _, size := range []int{0, 1, 15, 16, 17, 64, 1000} {
+		plain := bytes.Repeat([]byte{byte(size)}, size)
+		for _, opts := range []*Sm4Options{
+			{Key: key, ChunkSize: 16},
+			{Password: "secret", Iterations: 1000, ChunkSize: 16},
+		} {
+			encrypted, result, err := sm4GcmRoundTrip(plain, opts)
+			if err != nil {
+				t.Error(err.Error())
+				return
+			}
+			if !bytes.Equal(result, plain) {
+				t.Errorf("%d字节的数据解密后不一致", size)
+			}
+
+			// 去掉最后一块时应当检测到截断
+			if size > 16 {
+				truncated := encrypted[:len(encrypted)-(size%16+sm4GcmTagSize)]
+				if size%16 == 0 {
+					truncated = encrypted[:len(encrypted)-sm4GcmTagSize]
+				}
+				reader, err := NewSm4GcmReader(bytes.NewReader(truncated), opts)
+				if err == nil {
+					_, err = ioutil.ReadAll(reader)
+				}
+				if err == nil {
+					t.Errorf("%d字节的数据被截断后应当解密失败", size)
+				}
+			}
+		}
+	}
+
+	encrypted, _, err := sm4GcmRoundTrip([]byte("hello"), &Sm4Options{Password: "secret", Iterations: 1000})
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	reader, err := NewSm4GcmReader(bytes.NewReader(encrypted), &Sm4Options{Password: "wrong"})
+	if err == nil {
+		_, err = ioutil.ReadAll(reader)
+	}
+	if err != ErrWrongPassword {
+		t.Errorf("密码错误时应当返回ErrWrongPassword: %v", err)
+	}
+}
+
+func TestSm4Archive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sm4gcm-test")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src")
+	writeTestTree(t, src)
+
+	archiveFile := filepath.Join(dir, "app.tar.zst.sm4")
+	opts := &Sm4Options{Password: "secret", Iterations: 1000, Format: FormatZstd}
+	if err = Sm4Archive(src, archiveFile, opts); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if format, _ := DetectFile(archiveFile); format != FormatSm4Gcm {
+		t.Errorf("识别的格式为 %s", format)
+	}
+	if err = Extract(archiveFile, filepath.Join(dir, "nopass"), nil); err != ErrPasswordRequired {
+		t.Errorf("未提供密码时应当返回ErrPasswordRequired: %v", err)
+	}
+
+	dest := filepath.Join(dir, "out")
+	if err = Sm4Extract(archiveFile, dest, opts, nil); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	content, err := ioutil.ReadFile(filepath.Join(dest, "conf/app.properties"))
+	if err != nil || string(content) != "name=app\n" {
+		t.Error("解压后的文件内容不一致")
+	}
+
+	key := gmsm.Sm4RandomKey()
+	if err = Sm4Archive(src, archiveFile, &Sm4Options{Key: key}); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	dest = filepath.Join(dir, "out-key")
+	if err = Extract(archiveFile, dest, &ExtractOptions{Sm4Key: key}); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if _, err = os.Stat(filepath.Join(dest, "bin/run.sh")); err != nil {
+		t.Error("解压后的文件不存在")
+	}
+}
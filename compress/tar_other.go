@@ -0,0 +1,11 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package compress
+
+import "os"
+
+// fileKey 当前平台不识别硬链接
+func fileKey(info os.FileInfo) ([2]uint64, bool) {
+	return [2]uint64{}, false
+}
@@ -0,0 +1,373 @@
+package compress
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TarFS 只读的tar文件系统, 创建时读取一遍压缩包建立索引
+// 未压缩的tar可以随机访问, 压缩的tar在打开文件时从头解压到对应的位置
+type TarFS struct {
+	ra      io.ReaderAt
+	size    int64
+	format  Format
+	entries map[string]*tarEntry
+}
+
+type tarEntry struct {
+	name     string
+	hdr      *tar.Header
+	index    int
+	offset   int64
+	children []*tarEntry
+}
+
+// countReader 统计已读取的字节数
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// NewTarFS 由未压缩的tar创建只读文件系统
+func NewTarFS(r io.ReaderAt, size int64) (*TarFS, error) {
+	return NewCompressedTarFS(r, size, FormatTar)
+}
+
+// NewTarGzFS 由tar.gz创建只读文件系统
+func NewTarGzFS(r io.ReaderAt, size int64) (*TarFS, error) {
+	return NewCompressedTarFS(r, size, FormatGzip)
+}
+
+// NewCompressedTarFS 由format格式压缩的tar创建只读文件系统
+func NewCompressedTarFS(r io.ReaderAt, size int64, format Format) (*TarFS, error) {
+	if format == FormatZip || format == FormatUnknown {
+		return nil, errors.New("不支持的tar压缩格式: " + format.String())
+	}
+	t := &TarFS{ra: r, size: size, format: format, entries: make(map[string]*tarEntry)}
+	t.entries["."] = &tarEntry{name: ".", index: -1}
+
+	stream, closer, err := t.stream()
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+	counter := &countReader{r: stream}
+	tr := tar.NewReader(counter)
+	for index := 0; ; index++ {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.New("读取压缩包内文件失败 => " + err.Error())
+		}
+		name := tarFSName(hdr.Name)
+		if name == "" {
+			continue
+		}
+		entry := &tarEntry{name: name, hdr: hdr, index: index, offset: counter.n}
+		if old, ok := t.entries[name]; ok {
+			// 同名条目以后出现的为准, 保留已建立的子条目
+			entry.children = old.children
+		} else {
+			t.parent(name).children = append(t.parent(name).children, entry)
+		}
+		t.entries[name] = entry
+	}
+	for _, entry := range t.entries {
+		sort.Slice(entry.children, func(i, j int) bool {
+			return entry.children[i].name < entry.children[j].name
+		})
+	}
+	return t, nil
+}
+
+// tarFSName 将条目名称转换为fs.FS格式的路径, 无法转换时返回空
+func tarFSName(name string) string {
+	name = strings.Trim(name, "/")
+	if name == "" {
+		return ""
+	}
+	name = path.Clean(name)
+	if !fs.ValidPath(name) || name == "." {
+		return ""
+	}
+	return name
+}
+
+// parent 获取上级目录, 压缩包内未包含的上级目录会被自动补全
+func (t *TarFS) parent(name string) *tarEntry {
+	dir := path.Dir(name)
+	if entry, ok := t.entries[dir]; ok {
+		return entry
+	}
+	entry := &tarEntry{name: dir, index: -1}
+	t.entries[dir] = entry
+	p := t.parent(dir)
+	p.children = append(p.children, entry)
+	return entry
+}
+
+// stream 打开解压后的tar数据流
+func (t *TarFS) stream() (io.Reader, io.Closer, error) {
+	r, err := NewReader(t.format, io.NewSectionReader(t.ra, 0, t.size))
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, r, nil
+}
+
+// lookup 查找条目, 路径中的符号链接逐级解析, 硬链接被解析为目标条目, 最多跟随maxEntryLinks次链接
+func (t *TarFS) lookup(name string) (*tarEntry, error) {
+	links := 0
+	resolved, rest := ".", name
+	for rest != "" {
+		part := rest
+		rest = ""
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			part, rest = part[:i], part[i+1:]
+		}
+		current := path.Join(resolved, part)
+		entry, ok := t.entries[current]
+		if !ok {
+			return nil, fs.ErrNotExist
+		}
+		if entry.hdr == nil {
+			resolved = current
+			continue
+		}
+		var target string
+		switch entry.hdr.Typeflag {
+		case tar.TypeSymlink:
+			target = entry.hdr.Linkname
+			if !strings.HasPrefix(target, "/") {
+				target = path.Join(resolved, target)
+			}
+		case tar.TypeLink:
+			target = entry.hdr.Linkname
+		default:
+			resolved = current
+			continue
+		}
+		links++
+		if links > maxEntryLinks {
+			return nil, errors.New("符号链接层级过多")
+		}
+		// 链接目标与剩余的路径拼接后从根目录重新查找
+		rest = path.Clean(strings.TrimLeft(path.Join(target, rest), "/"))
+		if !fs.ValidPath(rest) {
+			return nil, fs.ErrNotExist
+		}
+		resolved = "."
+	}
+	return t.entries[resolved], nil
+}
+
+// Open 实现fs.FS
+func (t *TarFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	entry, err := t.lookup(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	info := &tarFileInfo{entry: entry, name: name}
+	if info.IsDir() {
+		return &tarDir{info: info}, nil
+	}
+	if entry.hdr.Typeflag != tar.TypeReg && entry.hdr.Typeflag != tar.TypeRegA {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errors.New("不支持读取的文件类型")}
+	}
+	if t.format == FormatTar && !isSparse(entry.hdr) {
+		return &tarSectionFile{SectionReader: io.NewSectionReader(t.ra, entry.offset, entry.hdr.Size), info: info}, nil
+	}
+	r, closer, err := t.seek(entry)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &tarFile{info: info, r: r, closer: closer}, nil
+}
+
+func isSparse(hdr *tar.Header) bool {
+	return hdr.Typeflag == tar.TypeGNUSparse || hdr.PAXRecords["GNU.sparse.map"] != "" || hdr.PAXRecords["GNU.sparse.major"] != ""
+}
+
+// seek 从头读取压缩包直到对应的条目
+func (t *TarFS) seek(entry *tarEntry) (io.Reader, io.Closer, error) {
+	stream, closer, err := t.stream()
+	if err != nil {
+		return nil, nil, err
+	}
+	tr := tar.NewReader(stream)
+	for i := 0; i <= entry.index; i++ {
+		if _, err = tr.Next(); err != nil {
+			closer.Close()
+			return nil, nil, errors.New("读取压缩包内文件失败 => " + err.Error())
+		}
+	}
+	return tr, closer, nil
+}
+
+// ReadDir 实现fs.ReadDirFS
+func (t *TarFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	file, err := t.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	dir, ok := file.(*tarDir)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("不是目录")}
+	}
+	return dir.ReadDir(-1)
+}
+
+// Stat 实现fs.StatFS
+func (t *TarFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	entry, err := t.lookup(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return &tarFileInfo{entry: entry, name: name}, nil
+}
+
+// tarFileInfo 实现fs.FileInfo与fs.DirEntry
+type tarFileInfo struct {
+	entry *tarEntry
+	// name 打开的路径, 符号链接被解析后与条目名称不同
+	name string
+}
+
+func (i *tarFileInfo) Name() string {
+	if i.name != "" {
+		return path.Base(i.name)
+	}
+	return path.Base(i.entry.name)
+}
+
+func (i *tarFileInfo) Size() int64 {
+	if i.entry.hdr == nil || i.IsDir() {
+		return 0
+	}
+	return i.entry.hdr.Size
+}
+
+func (i *tarFileInfo) Mode() fs.FileMode {
+	if i.entry.hdr == nil {
+		return fs.ModeDir | 0755
+	}
+	mode := i.entry.hdr.FileInfo().Mode()
+	if i.entry.hdr.Typeflag == tar.TypeLink {
+		mode = mode &^ fs.ModeType
+	}
+	// 以/结尾的目录在旧格式中可能被标记为普通文件
+	if len(i.entry.children) > 0 {
+		mode = mode&^fs.ModeType | fs.ModeDir
+	}
+	return mode
+}
+
+func (i *tarFileInfo) ModTime() time.Time {
+	if i.entry.hdr == nil {
+		return time.Time{}
+	}
+	return i.entry.hdr.ModTime
+}
+
+func (i *tarFileInfo) IsDir() bool {
+	return i.Mode().IsDir()
+}
+
+func (i *tarFileInfo) Sys() interface{} {
+	return i.entry.hdr
+}
+
+func (i *tarFileInfo) Type() fs.FileMode {
+	return i.Mode().Type()
+}
+
+func (i *tarFileInfo) Info() (fs.FileInfo, error) {
+	return i, nil
+}
+
+type tarFile struct {
+	info   *tarFileInfo
+	r      io.Reader
+	closer io.Closer
+}
+
+func (f *tarFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *tarFile) Read(p []byte) (int, error) {
+	return f.r.Read(p)
+}
+
+func (f *tarFile) Close() error {
+	return f.closer.Close()
+}
+
+// tarSectionFile 未压缩tar中的文件, 支持随机读取
+type tarSectionFile struct {
+	*io.SectionReader
+	info *tarFileInfo
+}
+
+func (f *tarSectionFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *tarSectionFile) Close() error {
+	return nil
+}
+
+type tarDir struct {
+	info   *tarFileInfo
+	offset int
+}
+
+func (d *tarDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *tarDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.entry.name, Err: errors.New("是目录")}
+}
+
+func (d *tarDir) Close() error {
+	return nil
+}
+
+// ReadDir 实现fs.ReadDirFile
+func (d *tarDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	children := d.info.entry.children[d.offset:]
+	if n > 0 && len(children) == 0 {
+		return nil, io.EOF
+	}
+	if n > 0 && len(children) > n {
+		children = children[:n]
+	}
+	d.offset += len(children)
+	result := make([]fs.DirEntry, len(children))
+	for i, child := range children {
+		result[i] = &tarFileInfo{entry: child}
+	}
+	return result, nil
+}
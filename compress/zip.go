@@ -2,51 +2,121 @@ package compress
 
 import (
 	"archive/zip"
+	"context"
 	"errors"
-	"github.com/byzk-org/common-utils/commonutils"
 	"io"
+	"io/ioutil"
 	"os"
-	"path/filepath"
 )
 
 // Unzip 解压zip
 func Unzip(zipFile string, destDir string) error {
-	zipReader, err := zip.OpenReader(zipFile)
+	return UnzipWithOptions(zipFile, destDir, nil)
+}
+
+// UnzipWithOptions 按选项解压zip, opts为nil时使用安全模式
+func UnzipWithOptions(zipFile string, destDir string, opts *ExtractOptions) error {
+	return UnzipContext(context.Background(), zipFile, destDir, opts)
+}
+
+// UnzipContext 按选项解压zip, ctx取消时停止解压并返回ctx.Err()
+func UnzipContext(ctx context.Context, zipFile string, destDir string, opts *ExtractOptions) error {
+	zipReader, err := openZipArchive(zipFile)
 	if err != nil {
-		return errors.New("创建zip解压流失败 => " + err.Error())
+		return err
 	}
 	defer zipReader.Close()
 
+	tracker := newProgressTracker(ctx, opts.progress())
+	e, err := newExtractor(destDir, opts, tracker)
+	if err != nil {
+		return errors.New("创建解压目录失败 => " + err.Error())
+	}
+	if err = e.checkZip(zipReader.File); err != nil {
+		return err
+	}
 	for _, f := range zipReader.File {
-		fpath := commonutils.PathJoin(destDir, f.Name)
-		if f.FileInfo().IsDir() {
-			os.MkdirAll(fpath, os.ModePerm)
-		} else {
-			if err = os.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
-				return errors.New("创建临时目录失败 => " + err.Error())
+		if err = tracker.begin(f.Name); err == nil {
+			if err = checkZipSize(f); err == nil {
+				err = e.begin(f.Name, int64(f.UncompressedSize64))
 			}
-
-			inFile, err := f.Open()
-			if err != nil {
-				return errors.New("打开临时目录失败 => " + err.Error())
+			if err == nil {
+				e.pendingIn = int64(f.CompressedSize64)
+				err = unzipFile(e, zipReader.file, f)
 			}
-			defer func(file io.ReadCloser) {
-				file.Close()
-			}(inFile)
+		}
+		if err != nil {
+			e.abort(err)
+			return err
+		}
+		e.pendingIn = 0
+		tracker.addIn(int64(f.CompressedSize64))
+		tracker.done()
+	}
+	return nil
+}
 
-			outFile, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
-			if err != nil {
-				return errors.New("打开临时文件失败 => " + err.Error())
-			}
-			defer func(file *os.File) {
-				file.Close()
-			}(outFile)
+// checkZip 解压前根据zip目录中记录的大小检查限制, 尽早拒绝压缩炸弹
+func (e *extractor) checkZip(files []*zip.File) error {
+	var total uint64
+	for _, f := range files {
+		if err := checkZipSize(f); err != nil {
+			return err
+		}
+		if err := e.opts.checkRatio(f.Name, int64(f.UncompressedSize64), int64(f.CompressedSize64)); err != nil {
+			return err
+		}
+		// 构造的目录可以记录接近2^64的大小, 先比较再累加, 避免溢出
+		if total > maxZipSize-f.UncompressedSize64 {
+			total = maxZipSize
+		} else {
+			total += f.UncompressedSize64
+		}
+	}
+	return e.opts.checkArchive(len(files), int64(total))
+}
 
-			_, err = io.Copy(outFile, inFile)
-			if err != nil {
-				return errors.New("从压缩包内解压文件失败 => " + err.Error())
-			}
+// maxZipSize zip目录中可以转换为int64的最大大小
+const maxZipSize = 1<<63 - 1
+
+// checkZipSize 拒绝目录中记录的大小超出int64的条目
+func checkZipSize(f *zip.File) error {
+	if f.UncompressedSize64 > maxZipSize || f.CompressedSize64 > maxZipSize {
+		return &LimitError{Name: f.Name, Limit: "MaxFileSize", Reason: "zip目录中记录的文件大小无效"}
+	}
+	return nil
+}
+
+func unzipFile(e *extractor, r io.ReaderAt, f *zip.File) error {
+	mode := f.Mode()
+	if err := e.checkMode(f.Name, mode); err != nil {
+		return err
+	}
+	if mode.IsDir() {
+		if _, err := e.mkdir(f.Name); err != nil {
+			return wrapError("创建临时目录失败", err)
 		}
+		return nil
+	}
+
+	inFile, err := openZipFile(r, f, e.opts.Password)
+	if err != nil {
+		return wrapError("打开压缩包内文件失败", err)
+	}
+	defer inFile.Close()
+
+	if mode&os.ModeSymlink != 0 && e.safe() {
+		target, err := ioutil.ReadAll(inFile)
+		if err != nil {
+			return wrapError("读取符号链接失败", err)
+		}
+		if _, err = e.symlink(f.Name, string(target)); err != nil {
+			return wrapError("创建符号链接失败", err)
+		}
+		return nil
+	}
+	if _, err = e.writeFile(f.Name, inFile, mode); err != nil {
+		return wrapError("从压缩包内解压文件失败", err)
 	}
 	return nil
 }
@@ -0,0 +1,170 @@
+package compress
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestTree(t *testing.T, dir string) {
+	files := map[string]string{
+		"bin/run.sh":          "#!/bin/sh\necho run\n",
+		"lib/app.jar":         "jar content",
+		"conf/app.properties": "name=app\n",
+		"logs/app.log":        "log",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chmod(filepath.Join(dir, "bin/run.sh"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Date(2020, 1, 2, 3, 4, 6, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(dir, "conf/app.properties"), modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestZip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zip-test")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src")
+	writeTestTree(t, src)
+
+	zipFile := filepath.Join(dir, "app.zip")
+	err = Zip(src, zipFile, &ZipOptions{Exclude: []string{"logs"}, Store: []string{"*.jar"}})
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	reader, err := zip.OpenReader(zipFile)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	entries := map[string]*zip.File{}
+	for _, f := range reader.File {
+		entries[f.Name] = f
+	}
+	reader.Close()
+	if _, ok := entries["logs/app.log"]; ok {
+		t.Error("被排除的文件不应当写入压缩包")
+	}
+	if _, ok := entries["empty/"]; !ok {
+		t.Error("空目录应当写入压缩包")
+	}
+	if f := entries["lib/app.jar"]; f == nil || f.Method != zip.Store {
+		t.Error("jar文件应当直接存储")
+	}
+	if f := entries["bin/run.sh"]; f == nil || f.Mode().Perm() != 0755 {
+		t.Error("文件权限未保留")
+	}
+	if f := entries["conf/app.properties"]; f == nil || !f.Modified.Equal(time.Date(2020, 1, 2, 3, 4, 6, 0, time.UTC)) {
+		t.Error("文件修改时间未保留")
+	}
+
+	dest := filepath.Join(dir, "dest")
+	if err = Unzip(zipFile, dest); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	content, err := ioutil.ReadFile(filepath.Join(dest, "conf/app.properties"))
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if string(content) != "name=app\n" {
+		t.Error("解压后的文件内容不一致")
+	}
+}
+
+func TestZipInclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zip-test")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+	writeTestTree(t, dir)
+
+	out, err := os.Create(filepath.Join(dir, "out.zip"))
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer out.Close()
+	writer := NewZipWriter(out, &ZipOptions{Level: 9, Include: []string{"*.jar", "*.properties"}})
+	if err = writer.AddTree(filepath.Join(dir, "lib"), "/app/lib"); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if err = writer.AddTree(filepath.Join(dir, "conf"), "app/conf"); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if err = writer.Close(); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	reader, err := zip.OpenReader(out.Name())
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer reader.Close()
+	var names []string
+	for _, f := range reader.File {
+		names = append(names, f.Name)
+	}
+	if len(names) != 2 || names[0] != "app/lib/app.jar" || names[1] != "app/conf/app.properties" {
+		t.Errorf("压缩包内容不正确: %v", names)
+	}
+}
+
+func TestZipDeterministic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zip-test")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	var outputs []string
+	for _, src := range []string{"a", "b"} {
+		src = filepath.Join(dir, src)
+		writeTestTree(t, src)
+		touchTree(t, src, time.Now().Add(-time.Duration(len(outputs))*time.Hour))
+		zipFile := filepath.Join(dir, "app.zip")
+		if err = Zip(src, zipFile, &ZipOptions{Deterministic: true}); err != nil {
+			t.Error(err.Error())
+			return
+		}
+		data, err := ioutil.ReadFile(zipFile)
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		outputs = append(outputs, string(data))
+	}
+	if outputs[0] != outputs[1] {
+		t.Error("确定性模式下相同的输入应当产生相同的压缩包")
+	}
+}
@@ -0,0 +1,252 @@
+package compress
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ZipOptions zip压缩选项
+type ZipOptions struct {
+	// Level deflate压缩级别, 为0时使用默认级别
+	Level int
+	// Include 需要包含的文件, 为空时包含全部文件, 支持path.Match格式, 匹配相对路径或文件名
+	Include []string
+	// Exclude 需要排除的文件或目录, 格式同Include
+	Exclude []string
+	// Store 不压缩直接存储的文件, 如已经压缩过的jar、zip等, 格式同Include
+	Store []string
+	// Progress 进度回调
+	Progress ProgressFunc
+	// Deterministic 确定性模式, 修改时间统一为ModTime, 相同的输入产生完全相同的压缩包
+	Deterministic bool
+	// ModTime 确定性模式下条目的修改时间, 为零值时使用1980-01-01 00:00:00 UTC
+	ModTime time.Time
+	// Password 不为空时使用WinZip AES(AE-2)加密文件内容, 目录项与文件名不加密
+	// 每个文件使用随机的盐值, 因此加密后的输出在确定性模式下也不相同
+	Password string
+	// Strength AES加密强度, 为0时使用Aes256
+	Strength AesStrength
+}
+
+// modTime 确定性模式下返回统一的修改时间
+func (o *ZipOptions) modTime(t time.Time) time.Time {
+	if o == nil || !o.Deterministic {
+		return t
+	}
+	return deterministicTime(o.ModTime)
+}
+
+func (o *ZipOptions) progress() ProgressFunc {
+	if o == nil {
+		return nil
+	}
+	return o.Progress
+}
+
+func (o *ZipOptions) included(name string, isDir bool) bool {
+	if o == nil {
+		return true
+	}
+	if matchGlobs(o.Exclude, name) {
+		return false
+	}
+	if isDir || len(o.Include) == 0 {
+		return true
+	}
+	return matchGlobs(o.Include, name)
+}
+
+func (o *ZipOptions) method(name string) uint16 {
+	if o != nil && matchGlobs(o.Store, name) {
+		return zip.Store
+	}
+	return zip.Deflate
+}
+
+// matchGlobs 判断相对路径或其文件名是否匹配任意一个模式
+func matchGlobs(patterns []string, name string) bool {
+	base := path.Base(name)
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, base); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ZipWriter 流式zip写入, 可以写入任意io.Writer
+type ZipWriter struct {
+	w       zipArchiveWriter
+	opts    *ZipOptions
+	tracker *progressTracker
+}
+
+// NewZipWriter 创建zip写入, opts可以为nil
+func NewZipWriter(w io.Writer, opts *ZipOptions) *ZipWriter {
+	return NewZipWriterContext(context.Background(), w, opts)
+}
+
+// NewZipWriterContext 创建zip写入, ctx取消后写入返回ctx.Err()
+func NewZipWriterContext(ctx context.Context, w io.Writer, opts *ZipOptions) *ZipWriter {
+	tracker := newProgressTracker(ctx, opts.progress())
+	if opts != nil && opts.Password != "" {
+		aw := newAesZipWriter(tracker.writer(w), []byte(opts.Password), opts.Strength, opts.Level)
+		return &ZipWriter{w: aw, opts: opts, tracker: tracker}
+	}
+	zw := zip.NewWriter(tracker.writer(w))
+	if opts != nil && opts.Level != 0 {
+		level := opts.Level
+		zw.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(out, level)
+		})
+	}
+	return &ZipWriter{w: zw, opts: opts, tracker: tracker}
+}
+
+// AddDir 写入目录项
+func (z *ZipWriter) AddDir(name string, mode os.FileMode, modTime time.Time) error {
+	name = strings.TrimSuffix(zipEntryName(name), "/") + "/"
+	if err := z.tracker.begin(name); err != nil {
+		return err
+	}
+	header := &zip.FileHeader{Name: name, Method: zip.Store}
+	header.Modified = z.opts.modTime(modTime)
+	header.SetMode(mode | os.ModeDir)
+	if _, err := z.w.CreateHeader(header); err != nil {
+		return wrapError("写入压缩包目录失败", err)
+	}
+	z.tracker.done()
+	return nil
+}
+
+// AddReader 将r中的内容以name写入压缩包, method为zip.Deflate或zip.Store
+func (z *ZipWriter) AddReader(name string, r io.Reader, mode os.FileMode, modTime time.Time, method uint16) error {
+	header := &zip.FileHeader{Name: zipEntryName(name), Method: method}
+	if err := z.tracker.begin(header.Name); err != nil {
+		return err
+	}
+	header.Modified = z.opts.modTime(modTime)
+	header.SetMode(mode)
+	writer, err := z.w.CreateHeader(header)
+	if err != nil {
+		return wrapError("写入压缩文件信息失败", err)
+	}
+	if _, err = io.Copy(writer, z.tracker.reader(r)); err != nil {
+		return wrapError("拷贝文件到压缩包内失败", err)
+	}
+	z.tracker.done()
+	return nil
+}
+
+// AddFile 将本地文件以name写入压缩包, 保留权限与修改时间, 符号链接以链接形式写入
+func (z *ZipWriter) AddFile(name, filePath string) error {
+	stat, err := os.Lstat(filePath)
+	if err != nil {
+		return errors.New("读取文件信息失败 => " + err.Error())
+	}
+	switch {
+	case stat.IsDir():
+		return z.AddDir(name, stat.Mode(), stat.ModTime())
+	case stat.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(filePath)
+		if err != nil {
+			return errors.New("读取符号链接失败 => " + err.Error())
+		}
+		return z.AddReader(name, strings.NewReader(filepath.ToSlash(target)), stat.Mode(), stat.ModTime(), zip.Store)
+	case !stat.Mode().IsRegular():
+		return errors.New("不支持压缩的文件类型: " + filePath)
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return errors.New("打开文件失败 => " + err.Error())
+	}
+	defer file.Close()
+	return z.AddReader(name, file, stat.Mode(), stat.ModTime(), z.opts.method(name))
+}
+
+// AddTree 将srcDir目录下的内容按名称顺序写入压缩包的prefix目录下, 按选项过滤文件
+func (z *ZipWriter) AddTree(srcDir, prefix string) error {
+	prefix = strings.Trim(zipEntryName(prefix), "/")
+	return filepath.Walk(srcDir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return errors.New("读取目录结构失败 => " + err.Error())
+		}
+		rel, err := filepath.Rel(srcDir, filePath)
+		if err != nil {
+			return errors.New("计算相对路径失败 => " + err.Error())
+		}
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if !z.opts.included(rel, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// 指定包含的文件时不单独写入目录项, 避免产生空目录
+		if info.IsDir() && z.opts != nil && len(z.opts.Include) > 0 {
+			return nil
+		}
+		return z.AddFile(path.Join(prefix, rel), filePath)
+	})
+}
+
+// Close 写入zip目录并关闭, 不会关闭底层的io.Writer
+func (z *ZipWriter) Close() error {
+	if err := z.w.Close(); err != nil {
+		return wrapError("关闭zip压缩流失败", err)
+	}
+	return nil
+}
+
+// zipEntryName 统一压缩包内的路径分隔符并去掉开头的/
+func zipEntryName(name string) string {
+	return strings.TrimLeft(filepath.ToSlash(name), "/")
+}
+
+// Zip 压缩srcDir目录下的内容为zip文件, opts可以为nil
+func Zip(srcDir, destFile string, opts *ZipOptions) error {
+	return ZipContext(context.Background(), srcDir, destFile, opts)
+}
+
+// ZipContext 压缩srcDir目录下的内容为zip文件, ctx取消时停止压缩并返回ctx.Err()
+func ZipContext(ctx context.Context, srcDir, destFile string, opts *ZipOptions) error {
+	stat, err := os.Stat(srcDir)
+	if err != nil {
+		return errors.New("读取压缩目录失败 => " + err.Error())
+	}
+	if !stat.IsDir() {
+		return errors.New("压缩路径不是目录: " + srcDir)
+	}
+	_ = os.RemoveAll(destFile)
+	file, err := os.Create(destFile)
+	if err != nil {
+		return errors.New("创建压缩文件失败 => " + err.Error())
+	}
+	writer := NewZipWriterContext(ctx, file, opts)
+	if err = writer.AddTree(srcDir, ""); err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		file.Close()
+		_ = os.Remove(destFile)
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return errors.New("关闭压缩文件失败 => " + err.Error())
+	}
+	return nil
+}
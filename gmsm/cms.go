@@ -0,0 +1,150 @@
+package gmsm
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"github.com/tjfoc/gmsm/sm2"
+	"github.com/tjfoc/gmsm/x509"
+	"math/big"
+)
+
+// CmsOidScheme CMS内容类型使用的OID体系
+type CmsOidScheme int
+
+const (
+	// CmsOidPkcs7 PKCS#7 / RFC 5652 定义的内容类型OID
+	CmsOidPkcs7 CmsOidScheme = iota
+	// CmsOidGm GM/T 0010 定义的内容类型OID
+	CmsOidGm
+)
+
+var (
+	oidPkcs7Data          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidPkcs7SignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidPkcs7EnvelopedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 3}
+
+	oidGmData          = asn1.ObjectIdentifier{1, 2, 156, 10197, 6, 1, 4, 2, 1}
+	oidGmSignedData    = asn1.ObjectIdentifier{1, 2, 156, 10197, 6, 1, 4, 2, 2}
+	oidGmEnvelopedData = asn1.ObjectIdentifier{1, 2, 156, 10197, 6, 1, 4, 2, 3}
+
+	oidSm4Cbc     = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 104, 2}
+	oidSm2Sign    = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 301, 1}
+	oidSm2Encrypt = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 301, 3}
+	oidSm3        = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 401}
+	oidSm2WithSm3 = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 501}
+)
+
+func (s CmsOidScheme) dataOid() asn1.ObjectIdentifier {
+	if s == CmsOidGm {
+		return oidGmData
+	}
+	return oidPkcs7Data
+}
+
+func (s CmsOidScheme) signedDataOid() asn1.ObjectIdentifier {
+	if s == CmsOidGm {
+		return oidGmSignedData
+	}
+	return oidPkcs7SignedData
+}
+
+func (s CmsOidScheme) envelopedDataOid() asn1.ObjectIdentifier {
+	if s == CmsOidGm {
+		return oidGmEnvelopedData
+	}
+	return oidPkcs7EnvelopedData
+}
+
+type cmsContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type cmsIssuerAndSerial struct {
+	IssuerName   asn1.RawValue
+	SerialNumber *big.Int
+}
+
+// marshalCmsContentInfo 使用ContentInfo包装内容
+func marshalCmsContentInfo(contentType asn1.ObjectIdentifier, content []byte) ([]byte, error) {
+	info := cmsContentInfo{ContentType: contentType}
+	if content != nil {
+		info.Content = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: content}
+	}
+	return asn1.Marshal(info)
+}
+
+// parseCmsContentInfo 解析ContentInfo, 返回内容类型与内容
+func parseCmsContentInfo(data []byte) (asn1.ObjectIdentifier, []byte, error) {
+	var info cmsContentInfo
+	rest, err := asn1.Unmarshal(data, &info)
+	if err != nil {
+		return nil, nil, errors.New("解析ContentInfo失败 => " + err.Error())
+	}
+	if len(rest) != 0 {
+		return nil, nil, errors.New("ContentInfo后存在多余数据")
+	}
+	return info.ContentType, info.Content.Bytes, nil
+}
+
+// parseCmsOctetString 解析OCTET STRING的内容, 兼容BER分段编码
+func parseCmsOctetString(raw asn1.RawValue) ([]byte, error) {
+	if !raw.IsCompound {
+		return raw.Bytes, nil
+	}
+	var (
+		result []byte
+		rest   = raw.Bytes
+	)
+	for len(rest) > 0 {
+		var part asn1.RawValue
+		var err error
+		rest, err = asn1.Unmarshal(rest, &part)
+		if err != nil {
+			return nil, errors.New("解析分段OCTET STRING失败")
+		}
+		b, err := parseCmsOctetString(part)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, b...)
+	}
+	return result, nil
+}
+
+func cmsIssuerAndSerialOf(cert *x509.Certificate) cmsIssuerAndSerial {
+	return cmsIssuerAndSerial{
+		IssuerName:   asn1.RawValue{FullBytes: cert.RawIssuer},
+		SerialNumber: cert.SerialNumber,
+	}
+}
+
+func (ias cmsIssuerAndSerial) match(cert *x509.Certificate) bool {
+	return cert.SerialNumber != nil && ias.SerialNumber != nil &&
+		cert.SerialNumber.Cmp(ias.SerialNumber) == 0 &&
+		string(cert.RawIssuer) == string(ias.IssuerName.FullBytes)
+}
+
+func cmsAlgorithm(oid asn1.ObjectIdentifier) pkix.AlgorithmIdentifier {
+	return pkix.AlgorithmIdentifier{Algorithm: oid, Parameters: asn1.NullRawValue}
+}
+
+// Sm2PublicKeyOfCert 获取证书中的sm2公钥
+func Sm2PublicKeyOfCert(cert *x509.Certificate) (*sm2.PublicKey, error) {
+	if cert == nil {
+		return nil, errors.New("证书不能为空")
+	}
+	switch pub := cert.PublicKey.(type) {
+	case *sm2.PublicKey:
+		return pub, nil
+	case *ecdsa.PublicKey:
+		if pub.Curve != sm2.P256Sm2() {
+			return nil, errors.New("证书公钥不是sm2公钥")
+		}
+		return &sm2.PublicKey{Curve: pub.Curve, X: pub.X, Y: pub.Y}, nil
+	default:
+		return nil, errors.New("证书公钥不是sm2公钥")
+	}
+}
@@ -0,0 +1,143 @@
+package gmsm
+
+import (
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"github.com/tjfoc/gmsm/x509"
+	"io"
+)
+
+type cmsEnvelopedData struct {
+	Version              int
+	RecipientInfos       []cmsRecipientInfo `asn1:"set"`
+	EncryptedContentInfo cmsEncryptedContentInfo
+}
+
+type cmsRecipientInfo struct {
+	Version                int
+	IssuerAndSerialNumber  cmsIssuerAndSerial
+	KeyEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedKey           []byte
+}
+
+type cmsEncryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           asn1.RawValue `asn1:"tag:0,optional"`
+}
+
+// SealEnvelope 创建数字信封(EnvelopedData)
+// 内容使用随机sm4密钥以CBC模式加密, sm4密钥使用每个接收者证书中的sm2公钥加密(ASN.1密文格式)
+func SealEnvelope(content []byte, recipients []*x509.Certificate, scheme CmsOidScheme) ([]byte, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("数字信封接收者不能为空")
+	}
+
+	key := make([]byte, 16)
+	iv := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, errors.New("生成数据密钥失败")
+	}
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, errors.New("生成初始向量失败")
+	}
+
+	encryptContent, err := Sm4CbcEncrypt(key, iv, content)
+	if err != nil {
+		return nil, err
+	}
+
+	recipientInfos := make([]cmsRecipientInfo, 0, len(recipients))
+	for _, cert := range recipients {
+		pubKey, err := Sm2PublicKeyOfCert(cert)
+		if err != nil {
+			return nil, err
+		}
+		encryptKey, err := Sm2EncryptWithMode(pubKey, key, Sm2CipherAsn1)
+		if err != nil {
+			return nil, errors.New("加密数据密钥失败")
+		}
+		recipientInfos = append(recipientInfos, cmsRecipientInfo{
+			IssuerAndSerialNumber:  cmsIssuerAndSerialOf(cert),
+			KeyEncryptionAlgorithm: cmsAlgorithm(oidSm2Encrypt),
+			EncryptedKey:           encryptKey,
+		})
+	}
+
+	ivParam, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, errors.New("转换初始向量失败")
+	}
+
+	envelopedData, err := asn1.Marshal(cmsEnvelopedData{
+		RecipientInfos: recipientInfos,
+		EncryptedContentInfo: cmsEncryptedContentInfo{
+			ContentType: scheme.dataOid(),
+			ContentEncryptionAlgorithm: pkix.AlgorithmIdentifier{
+				Algorithm:  oidSm4Cbc,
+				Parameters: asn1.RawValue{FullBytes: ivParam},
+			},
+			EncryptedContent: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, Bytes: encryptContent},
+		},
+	})
+	if err != nil {
+		return nil, errors.New("转换数字信封失败 => " + err.Error())
+	}
+	return marshalCmsContentInfo(scheme.envelopedDataOid(), envelopedData)
+}
+
+// OpenEnvelope 打开数字信封, 同时支持PKCS#7与GM/T 0010的内容类型OID
+// cert为空时依次使用私钥尝试每个接收者, pri可以是*sm2.PrivateKey或密钥提供者返回的解密句柄
+func OpenEnvelope(data []byte, cert *x509.Certificate, pri Decrypter) ([]byte, error) {
+	if pri == nil {
+		return nil, errors.New("解密私钥不能为空")
+	}
+
+	contentType, content, err := parseCmsContentInfo(data)
+	if err != nil {
+		return nil, err
+	}
+	if !contentType.Equal(oidPkcs7EnvelopedData) && !contentType.Equal(oidGmEnvelopedData) {
+		return nil, errors.New("数据不是数字信封")
+	}
+
+	var envelopedData cmsEnvelopedData
+	if _, err = asn1.Unmarshal(content, &envelopedData); err != nil {
+		return nil, errors.New("解析数字信封失败 => " + err.Error())
+	}
+
+	eci := envelopedData.EncryptedContentInfo
+	if !eci.ContentEncryptionAlgorithm.Algorithm.Equal(oidSm4Cbc) {
+		return nil, errors.New("不支持的内容加密算法 => " + eci.ContentEncryptionAlgorithm.Algorithm.String())
+	}
+	var iv []byte
+	if _, err = asn1.Unmarshal(eci.ContentEncryptionAlgorithm.Parameters.FullBytes, &iv); err != nil {
+		return nil, errors.New("解析初始向量失败")
+	}
+	encryptContent, err := parseCmsOctetString(eci.EncryptedContent)
+	if err != nil {
+		return nil, err
+	}
+
+	var key []byte
+	for _, recipient := range envelopedData.RecipientInfos {
+		if cert != nil && !recipient.IssuerAndSerialNumber.match(cert) {
+			continue
+		}
+		if !recipient.KeyEncryptionAlgorithm.Algorithm.Equal(oidSm2Encrypt) &&
+			!recipient.KeyEncryptionAlgorithm.Algorithm.Equal(oidSm2Sign) {
+			continue
+		}
+		if key, err = Sm2DecryptAutoWith(pri, recipient.EncryptedKey); err == nil {
+			break
+		}
+		key = nil
+	}
+	if key == nil {
+		return nil, errors.New("未找到可以解密的接收者信息")
+	}
+
+	return Sm4CbcDecrypt(key, iv, encryptContent)
+}
@@ -0,0 +1,73 @@
+package gmsm
+
+import (
+	"bytes"
+	"crypto/x509/pkix"
+	"github.com/byzk-org/common-utils/cert"
+	"github.com/tjfoc/gmsm/x509"
+	"testing"
+	"time"
+)
+
+func createTestCa(t *testing.T) *cert.Sm2CertCreateResult {
+	result, err := cert.CreateSm2Cert(cert.GetCaCertTemplate(&pkix.Name{
+		CommonName:   "测试Ca证书",
+		Organization: []string{"byzk"},
+		Country:      []string{"CN"},
+	}, time.Now().AddDate(1, 0, 0)))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return result
+}
+
+func createTestCert(t *testing.T, ca *cert.Sm2CertCreateResult, commonName string) *cert.Sm2CertCreateResult {
+	result, err := cert.CreateSm2CertWithCa(cert.GetUserCertTemplate(&pkix.Name{
+		CommonName:   commonName,
+		Organization: []string{"byzk"},
+		Country:      []string{"CN"},
+	}, time.Now().AddDate(1, 0, 0)), ca.Cert, ca.Pri)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return result
+}
+
+func TestEnvelope(t *testing.T) {
+	ca := createTestCa(t)
+	alice := createTestCert(t, ca, "alice")
+	bob := createTestCert(t, ca, "bob")
+	eve := createTestCert(t, ca, "eve")
+	content := bytes.Repeat([]byte("数字信封测试"), 100)
+
+	for _, scheme := range []CmsOidScheme{CmsOidPkcs7, CmsOidGm} {
+		envelope, err := SealEnvelope(content, []*x509.Certificate{alice.Cert, bob.Cert}, scheme)
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+
+		for _, recipient := range []*cert.Sm2CertCreateResult{alice, bob} {
+			data, err := OpenEnvelope(envelope, recipient.Cert, recipient.Pri)
+			if err != nil {
+				t.Error(err.Error())
+				return
+			}
+			if !bytes.Equal(data, content) {
+				t.Error("数字信封解密结果不一致")
+			}
+
+			data, err = OpenEnvelope(envelope, nil, recipient.Pri)
+			if err != nil || !bytes.Equal(data, content) {
+				t.Error("未指定证书时打开数字信封失败")
+			}
+		}
+
+		if _, err = OpenEnvelope(envelope, eve.Cert, eve.Pri); err == nil {
+			t.Error("非接收者打开了数字信封")
+		}
+		if _, err = OpenEnvelope(envelope, nil, eve.Pri); err == nil {
+			t.Error("非接收者打开了数字信封")
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package gmsm
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/tjfoc/gmsm/sm3"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+	"hash"
+	"io"
+	"strings"
+)
+
+// KdfHash 密钥派生使用的摘要算法
+type KdfHash int
+
+const (
+	KdfHashSm3 KdfHash = iota
+	KdfHashSha256
+)
+
+func (h KdfHash) String() string {
+	switch h {
+	case KdfHashSm3:
+		return "sm3"
+	case KdfHashSha256:
+		return "sha256"
+	default:
+		return "unknown"
+	}
+}
+
+// New 创建摘要
+func (h KdfHash) New() hash.Hash {
+	if h == KdfHashSha256 {
+		return sha256.New()
+	}
+	return sm3.New()
+}
+
+func (h KdfHash) check() error {
+	if h != KdfHashSm3 && h != KdfHashSha256 {
+		return errors.New("不支持的摘要算法")
+	}
+	return nil
+}
+
+// Sm3Kdf GM/T 0003 中基于sm3的密钥派生函数, 输出keyLen字节, z为依次拼接的共享信息, keyLen不大于0时返回nil
+func Sm3Kdf(keyLen int, z ...[]byte) []byte {
+	if keyLen <= 0 {
+		return nil
+	}
+	var (
+		result = make([]byte, 0, keyLen+32)
+		ct     = make([]byte, 4)
+		h      = sm3.New()
+	)
+	for counter := uint32(1); len(result) < keyLen; counter++ {
+		h.Reset()
+		for _, v := range z {
+			h.Write(v)
+		}
+		binary.BigEndian.PutUint32(ct, counter)
+		h.Write(ct)
+		result = append(result, h.Sum(nil)...)
+	}
+	return result[:keyLen]
+}
+
+// Hkdf RFC 5869 HKDF密钥派生
+func Hkdf(h KdfHash, secret, salt, info []byte, keyLen int) ([]byte, error) {
+	if err := h.check(); err != nil {
+		return nil, err
+	}
+	if keyLen <= 0 || keyLen > 255*h.New().Size() {
+		return nil, errors.New("HKDF派生密钥长度错误")
+	}
+	result := make([]byte, keyLen)
+	if _, err := io.ReadFull(hkdf.New(h.New, secret, salt, info), result); err != nil {
+		return nil, errors.New("HKDF派生密钥失败")
+	}
+	return result, nil
+}
+
+// Pbkdf2 RFC 8018 PBKDF2口令密钥派生
+func Pbkdf2(h KdfHash, password, salt []byte, iter, keyLen int) ([]byte, error) {
+	if err := h.check(); err != nil {
+		return nil, err
+	}
+	if iter <= 0 || keyLen <= 0 {
+		return nil, errors.New("PBKDF2迭代次数与派生密钥长度必须大于0")
+	}
+	return pbkdf2.Key(password, salt, iter, keyLen, h.New), nil
+}
+
+// PasswordHashAlg 口令存储算法
+type PasswordHashAlg int
+
+const (
+	PasswordHashArgon2id PasswordHashAlg = iota
+	PasswordHashScrypt
+	PasswordHashPbkdf2Sm3
+)
+
+const (
+	passwordSaltLen = 16
+	passwordKeyLen  = 32
+
+	argon2idTime    = 3
+	argon2idMemory  = 64 * 1024
+	argon2idThreads = 2
+
+	scryptLogN = 15
+	scryptR    = 8
+	scryptP    = 1
+
+	pbkdf2Sm3Iter = 100000
+
+	// 校验时摘要中参数的上限, 防止构造的摘要导致过多的内存与计算
+	passwordMaxMemory = 256 * 1024 * 1024
+	passwordMaxKeyLen = 128
+	argon2idMaxTime   = 64
+	scryptMaxR        = 32
+	scryptMaxP        = 16
+	pbkdf2MaxIter     = 10000000
+)
+
+var passwordEncoding = base64.RawStdEncoding
+
+// PasswordHash 计算用于存储的口令摘要, 结果为PHC字符串格式, 包含算法、参数与盐值, 例如:
+//
+//	$argon2id$v=19$m=65536,t=3,p=2$<盐值>$<摘要>
+//	$scrypt$ln=15,r=8,p=1$<盐值>$<摘要>
+//	$pbkdf2-sm3$i=100000$<盐值>$<摘要>
+func PasswordHash(password string, alg PasswordHashAlg) (string, error) {
+	salt := make([]byte, passwordSaltLen)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return "", errors.New("生成盐值失败")
+	}
+
+	var (
+		params string
+		key    []byte
+		err    error
+	)
+	switch alg {
+	case PasswordHashArgon2id:
+		params = fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d", argon2.Version, argon2idMemory, argon2idTime, argon2idThreads)
+		key = argon2.IDKey([]byte(password), salt, argon2idTime, argon2idMemory, argon2idThreads, passwordKeyLen)
+	case PasswordHashScrypt:
+		params = fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d", scryptLogN, scryptR, scryptP)
+		key, err = scrypt.Key([]byte(password), salt, 1<<scryptLogN, scryptR, scryptP, passwordKeyLen)
+	case PasswordHashPbkdf2Sm3:
+		params = fmt.Sprintf("$pbkdf2-sm3$i=%d", pbkdf2Sm3Iter)
+		key, err = Pbkdf2(KdfHashSm3, []byte(password), salt, pbkdf2Sm3Iter, passwordKeyLen)
+	default:
+		return "", errors.New("不支持的口令存储算法")
+	}
+	if err != nil {
+		return "", errors.New("计算口令摘要失败 => " + err.Error())
+	}
+	return params + "$" + passwordEncoding.EncodeToString(salt) + "$" + passwordEncoding.EncodeToString(key), nil
+}
+
+// PasswordVerify 校验口令与PasswordHash生成的摘要是否匹配
+func PasswordVerify(password, encoded string) (bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) < 5 || parts[0] != "" {
+		return false, errors.New("口令摘要格式错误")
+	}
+	salt, err := passwordEncoding.DecodeString(parts[len(parts)-2])
+	if err != nil {
+		return false, errors.New("口令摘要盐值格式错误")
+	}
+	expect, err := passwordEncoding.DecodeString(parts[len(parts)-1])
+	if err != nil || len(expect) == 0 || len(expect) > passwordMaxKeyLen {
+		return false, errors.New("口令摘要格式错误")
+	}
+
+	var key []byte
+	switch parts[1] {
+	case "argon2id":
+		var (
+			version, memory, time uint32
+			threads               uint8
+		)
+		if len(parts) != 6 {
+			return false, errors.New("口令摘要格式错误")
+		}
+		if _, err = fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+			return false, errors.New("不支持的argon2版本")
+		}
+		if _, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil ||
+			time == 0 || threads == 0 {
+			return false, errors.New("argon2id参数格式错误")
+		}
+		// memory的单位为KiB
+		if uint64(memory)*1024 > passwordMaxMemory || time > argon2idMaxTime {
+			return false, errors.New("argon2id参数超出上限")
+		}
+		key = argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(expect)))
+	case "scrypt":
+		var logN, r, p int
+		if _, err = fmt.Sscanf(parts[2], "ln=%d,r=%d,p=%d", &logN, &r, &p); err != nil || logN <= 0 || logN > 30 {
+			return false, errors.New("scrypt参数格式错误")
+		}
+		// scrypt需要128*N*r字节的内存
+		if r <= 0 || r > scryptMaxR || p <= 0 || p > scryptMaxP || uint64(128*r)<<uint(logN) > passwordMaxMemory {
+			return false, errors.New("scrypt参数超出上限")
+		}
+		if key, err = scrypt.Key([]byte(password), salt, 1<<uint(logN), r, p, len(expect)); err != nil {
+			return false, errors.New("scrypt参数错误 => " + err.Error())
+		}
+	case "pbkdf2-sm3":
+		var iter int
+		if _, err = fmt.Sscanf(parts[2], "i=%d", &iter); err != nil {
+			return false, errors.New("pbkdf2参数格式错误")
+		}
+		if iter > pbkdf2MaxIter {
+			return false, errors.New("pbkdf2参数超出上限")
+		}
+		if key, err = Pbkdf2(KdfHashSm3, []byte(password), salt, iter, len(expect)); err != nil {
+			return false, err
+		}
+	default:
+		return false, errors.New("不支持的口令存储算法 => " + parts[1])
+	}
+	return subtle.ConstantTimeCompare(key, expect) == 1, nil
+}
@@ -0,0 +1,94 @@
+package gmsm
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestSm3Kdf(t *testing.T) {
+	key := Sm3Kdf(40, []byte("byzk-"), []byte("sm3-kdf"))
+	if hex.EncodeToString(key) != "b6c012c3d0badc08e0b41511613f7fa90ad54ab506742ecf0525985c930885fc8ad9c41e7ec7f935" {
+		t.Errorf("sm3 kdf结果错误: %x", key)
+	}
+	for _, keyLen := range []int{0, -1, -33, -1 << 40} {
+		if Sm3Kdf(keyLen, []byte("byzk")) != nil {
+			t.Errorf("密钥长度为%d时应当返回nil", keyLen)
+		}
+	}
+}
+
+func TestHkdfPbkdf2(t *testing.T) {
+	ikm := bytes.Repeat([]byte{0x0b}, 22)
+	salt, _ := hex.DecodeString("000102030405060708090a0b0c")
+	info, _ := hex.DecodeString("f0f1f2f3f4f5f6f7f8f9")
+	key, err := Hkdf(KdfHashSha256, ikm, salt, info, 42)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if hex.EncodeToString(key) != "3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf34007208d5b887185865" {
+		t.Errorf("HKDF-SHA256结果错误: %x", key)
+	}
+
+	key, err = Pbkdf2(KdfHashSha256, []byte("password"), []byte("salt"), 1, 32)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if hex.EncodeToString(key) != "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b" {
+		t.Errorf("PBKDF2-SHA256结果错误: %x", key)
+	}
+
+	sm3Key, err := Pbkdf2(KdfHashSm3, []byte("password"), []byte("salt"), 1, 32)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if bytes.Equal(sm3Key, key) {
+		t.Error("PBKDF2-SM3结果不应与SHA256相同")
+	}
+	sm3HkdfKey, err := Hkdf(KdfHashSm3, ikm, salt, info, 42)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if len(sm3HkdfKey) != 42 {
+		t.Error("HKDF-SM3派生密钥长度错误")
+	}
+}
+
+func TestPasswordHash(t *testing.T) {
+	for _, alg := range []PasswordHashAlg{PasswordHashArgon2id, PasswordHashScrypt, PasswordHashPbkdf2Sm3} {
+		encoded, err := PasswordHash("operator-password", alg)
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		ok, err := PasswordVerify("operator-password", encoded)
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		if !ok {
+			t.Errorf("口令校验失败: %s", encoded)
+		}
+		if ok, _ = PasswordVerify("wrong-password", encoded); ok {
+			t.Errorf("错误口令校验通过: %s", encoded)
+		}
+	}
+
+	if _, err := PasswordVerify("password", "$md5$abc$def"); err == nil {
+		t.Error("不支持的算法应当返回错误")
+	}
+	for _, encoded := range []string{
+		"$argon2id$v=19$m=16777216,t=3,p=2$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U",
+		"$scrypt$ln=24,r=8,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U",
+		"$scrypt$ln=15,r=8,p=1000$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U",
+		"$pbkdf2-sm3$i=2000000000$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U",
+	} {
+		if _, err := PasswordVerify("password", encoded); err == nil {
+			t.Errorf("参数超出上限时应当返回错误: %s", encoded)
+		}
+	}
+}
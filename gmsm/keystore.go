@@ -0,0 +1,533 @@
+package gmsm
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"github.com/byzk-org/common-utils/commonutils"
+	"github.com/tjfoc/gmsm/sm2"
+	"github.com/tjfoc/gmsm/sm3"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// KeyStoreKeyType 密钥库中的密钥类型
+type KeyStoreKeyType string
+
+const (
+	KeyStoreKeySm4  KeyStoreKeyType = "sm4"
+	KeyStoreKeySm2  KeyStoreKeyType = "sm2"
+	KeyStoreKeyHmac KeyStoreKeyType = "hmac-sm3"
+)
+
+// KeyStoreKeyStatus 密钥状态, 轮换后旧版本变为retired, 仍可用于解密历史数据
+type KeyStoreKeyStatus string
+
+const (
+	KeyStoreKeyActive  KeyStoreKeyStatus = "active"
+	KeyStoreKeyRetired KeyStoreKeyStatus = "retired"
+)
+
+const (
+	keyStoreFormatVersion = 1
+	keyStorePasswordIter  = 100000
+	keyStoreMasterKeyLen  = 16
+	keyStoreHmacKeyLen    = 32
+)
+
+// KeyStoreEntry 密钥元数据
+type KeyStoreEntry struct {
+	Name    string            `json:"name"`
+	Type    KeyStoreKeyType   `json:"type"`
+	Version int               `json:"version"`
+	Status  KeyStoreKeyStatus `json:"status"`
+	Created time.Time         `json:"created"`
+	Meta    map[string]string `json:"meta,omitempty"`
+}
+
+type keyStoreKey struct {
+	KeyStoreEntry
+	// Wrapped 使用密钥库kek以sm4密钥包装(RFC 5649)后的密钥
+	Wrapped []byte `json:"wrapped"`
+}
+
+type keyStoreKdf struct {
+	Alg  string `json:"alg"`
+	Salt []byte `json:"salt"`
+	Iter int    `json:"iter"`
+}
+
+type keyStoreFile struct {
+	Version int           `json:"version"`
+	Kdf     *keyStoreKdf  `json:"kdf,omitempty"`
+	Keys    []keyStoreKey `json:"keys"`
+	// Mac 除Mac外文件内容的HMAC-SM3
+	Mac []byte `json:"mac,omitempty"`
+}
+
+// KeyStore 本地密钥库文件, 按名称保存sm4、sm2与hmac密钥的多个版本
+// 密钥库由16字节主密钥或口令(PBKDF2-SM3)保护, 主密钥经HKDF-SM3派生出密钥包装密钥与完整性校验密钥
+type KeyStore struct {
+	lock   sync.RWMutex
+	path   string
+	kek    *commonutils.Secret
+	macKey *commonutils.Secret
+	file   keyStoreFile
+}
+
+// CreateKeyStore 创建由主密钥保护的密钥库, 文件已存在时返回错误
+func CreateKeyStore(path string, masterKey []byte) (*KeyStore, error) {
+	if len(masterKey) != keyStoreMasterKeyLen {
+		return nil, errors.New("密钥库主密钥长度必须为16字节")
+	}
+	return createKeyStore(path, masterKey, nil)
+}
+
+// CreateKeyStoreWithPassword 创建由口令保护的密钥库, 文件已存在时返回错误
+func CreateKeyStoreWithPassword(path, password string) (*KeyStore, error) {
+	if password == "" {
+		return nil, errors.New("密钥库口令不能为空")
+	}
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, errors.New("生成盐值失败")
+	}
+	kdf := &keyStoreKdf{Alg: "pbkdf2-sm3", Salt: salt, Iter: keyStorePasswordIter}
+	masterKey, err := kdf.derive(password)
+	if err != nil {
+		return nil, err
+	}
+	defer commonutils.Zero(masterKey)
+	return createKeyStore(path, masterKey, kdf)
+}
+
+func createKeyStore(path string, masterKey []byte, kdf *keyStoreKdf) (*KeyStore, error) {
+	if _, err := os.Stat(path); err == nil {
+		return nil, errors.New("密钥库文件已存在 => " + path)
+	}
+	s, err := newKeyStore(path, masterKey)
+	if err != nil {
+		return nil, err
+	}
+	s.file = keyStoreFile{Version: keyStoreFormatVersion, Kdf: kdf, Keys: []keyStoreKey{}}
+	if err = s.save(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// OpenKeyStore 打开由主密钥保护的密钥库
+func OpenKeyStore(path string, masterKey []byte) (*KeyStore, error) {
+	file, err := readKeyStoreFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if file.Kdf != nil {
+		return nil, errors.New("密钥库由口令保护")
+	}
+	return openKeyStore(path, masterKey, file)
+}
+
+// OpenKeyStoreWithPassword 打开由口令保护的密钥库
+func OpenKeyStoreWithPassword(path, password string) (*KeyStore, error) {
+	file, err := readKeyStoreFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if file.Kdf == nil {
+		return nil, errors.New("密钥库由主密钥保护")
+	}
+	masterKey, err := file.Kdf.derive(password)
+	if err != nil {
+		return nil, err
+	}
+	defer commonutils.Zero(masterKey)
+	return openKeyStore(path, masterKey, file)
+}
+
+func openKeyStore(path string, masterKey []byte, file *keyStoreFile) (*KeyStore, error) {
+	s, err := newKeyStore(path, masterKey)
+	if err != nil {
+		return nil, err
+	}
+	mac, err := s.mac(file)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(mac, file.Mac) {
+		return nil, errors.New("密钥库主密钥或口令错误, 或文件已被篡改")
+	}
+	s.file = *file
+	return s, nil
+}
+
+// Close 关闭密钥库并清零内存中的密钥包装密钥与完整性校验密钥
+func (s *KeyStore) Close() error {
+	_ = s.kek.Close()
+	return s.macKey.Close()
+}
+
+func newKeyStore(path string, masterKey []byte) (*KeyStore, error) {
+	kek, err := Hkdf(KdfHashSm3, masterKey, nil, []byte("keystore-wrap"), 16)
+	if err != nil {
+		return nil, err
+	}
+	macKey, err := Hkdf(KdfHashSm3, masterKey, nil, []byte("keystore-mac"), 32)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyStore{
+		path:   path,
+		kek:    commonutils.NewSecretAndZero(kek),
+		macKey: commonutils.NewSecretAndZero(macKey),
+	}, nil
+}
+
+func readKeyStoreFile(path string) (*keyStoreFile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.New("读取密钥库文件失败 => " + err.Error())
+	}
+	file := &keyStoreFile{}
+	if err = json.Unmarshal(data, file); err != nil {
+		return nil, errors.New("解析密钥库文件失败 => " + err.Error())
+	}
+	if file.Version != keyStoreFormatVersion {
+		return nil, errors.New("不支持的密钥库版本 => " + strconv.Itoa(file.Version))
+	}
+	return file, nil
+}
+
+func (k *keyStoreKdf) derive(password string) ([]byte, error) {
+	if k.Alg != "pbkdf2-sm3" {
+		return nil, errors.New("不支持的密钥库口令派生算法 => " + k.Alg)
+	}
+	return Pbkdf2(KdfHashSm3, []byte(password), k.Salt, k.Iter, keyStoreMasterKeyLen)
+}
+
+func (s *KeyStore) mac(file *keyStoreFile) ([]byte, error) {
+	tmp := *file
+	tmp.Mac = nil
+	data, err := json.Marshal(&tmp)
+	if err != nil {
+		return nil, errors.New("转换密钥库内容失败")
+	}
+	h := hmac.New(sm3.New, s.macKey.Bytes())
+	h.Write(data)
+	return h.Sum(nil), nil
+}
+
+// save 计算完整性校验值后写入临时文件再替换原文件
+func (s *KeyStore) save() error {
+	mac, err := s.mac(&s.file)
+	if err != nil {
+		return err
+	}
+	s.file.Mac = mac
+	data, err := json.MarshalIndent(&s.file, "", "  ")
+	if err != nil {
+		return errors.New("转换密钥库内容失败")
+	}
+	tmpPath := s.path + ".tmp"
+	if err = ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return errors.New("写出密钥库文件失败 => " + err.Error())
+	}
+	if err = os.Rename(tmpPath, s.path); err != nil {
+		_ = os.Remove(tmpPath)
+		return errors.New("写出密钥库文件失败 => " + err.Error())
+	}
+	return nil
+}
+
+func cloneKeyStoreEntry(e KeyStoreEntry) *KeyStoreEntry {
+	if e.Meta != nil {
+		meta := make(map[string]string, len(e.Meta))
+		for k, v := range e.Meta {
+			meta[k] = v
+		}
+		e.Meta = meta
+	}
+	return &e
+}
+
+// add 以新版本添加密钥, 同名密钥的旧版本变为retired
+func (s *KeyStore) add(name string, keyType KeyStoreKeyType, key []byte, meta map[string]string) (*KeyStoreEntry, error) {
+	if name == "" {
+		return nil, errors.New("密钥名称不能为空")
+	}
+	if s.kek.Closed() {
+		return nil, errors.New("密钥库已关闭")
+	}
+	wrapped, err := Sm4KeyWrap(s.kek.Bytes(), key)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	version := 0
+	for i := range s.file.Keys {
+		k := &s.file.Keys[i]
+		if k.Name != name {
+			continue
+		}
+		if k.Type != keyType {
+			return nil, errors.New("密钥类型与已存在的同名密钥不一致 => " + name)
+		}
+		if k.Version > version {
+			version = k.Version
+		}
+	}
+
+	old := s.file.Keys
+	keys := make([]keyStoreKey, len(old), len(old)+1)
+	copy(keys, old)
+	for i := range keys {
+		if keys[i].Name == name {
+			keys[i].Status = KeyStoreKeyRetired
+		}
+	}
+	entry := KeyStoreEntry{
+		Name:    name,
+		Type:    keyType,
+		Version: version + 1,
+		Status:  KeyStoreKeyActive,
+		Created: time.Now().UTC(),
+		Meta:    cloneKeyStoreEntry(KeyStoreEntry{Meta: meta}).Meta,
+	}
+	s.file.Keys = append(keys, keyStoreKey{KeyStoreEntry: entry, Wrapped: wrapped})
+	if err = s.save(); err != nil {
+		s.file.Keys = old
+		return nil, err
+	}
+	return cloneKeyStoreEntry(entry), nil
+}
+
+// ImportSm4Key 导入sm4密钥, 同名密钥已存在时作为新版本保存
+func (s *KeyStore) ImportSm4Key(name string, key []byte, meta map[string]string) (*KeyStoreEntry, error) {
+	if len(key) != 16 {
+		return nil, errors.New("sm4密钥长度必须为16字节")
+	}
+	return s.add(name, KeyStoreKeySm4, key, meta)
+}
+
+// ImportSm2Key 导入sm2私钥, 同名密钥已存在时作为新版本保存
+func (s *KeyStore) ImportSm2Key(name string, pri *sm2.PrivateKey, meta map[string]string) (*KeyStoreEntry, error) {
+	if pri == nil || pri.D == nil {
+		return nil, errors.New("私钥不能为空")
+	}
+	return s.add(name, KeyStoreKeySm2, sm2PadInt(pri.D), meta)
+}
+
+// ImportHmacKey 导入hmac密钥, 同名密钥已存在时作为新版本保存
+func (s *KeyStore) ImportHmacKey(name string, key []byte, meta map[string]string) (*KeyStoreEntry, error) {
+	if len(key) == 0 {
+		return nil, errors.New("hmac密钥不能为空")
+	}
+	return s.add(name, KeyStoreKeyHmac, key, meta)
+}
+
+// GenerateKey 生成指定类型的密钥并保存, 同名密钥已存在时作为新版本保存
+func (s *KeyStore) GenerateKey(name string, keyType KeyStoreKeyType, meta map[string]string) (*KeyStoreEntry, error) {
+	switch keyType {
+	case KeyStoreKeySm4:
+		key, err := Sm4GenerateKey()
+		if err != nil {
+			return nil, err
+		}
+		return s.ImportSm4Key(name, key, meta)
+	case KeyStoreKeySm2:
+		pri, err := sm2.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, errors.New("生成sm2私钥失败")
+		}
+		return s.ImportSm2Key(name, pri, meta)
+	case KeyStoreKeyHmac:
+		key := make([]byte, keyStoreHmacKeyLen)
+		if _, err := io.ReadFull(rand.Reader, key); err != nil {
+			return nil, errors.New("生成hmac密钥失败")
+		}
+		return s.ImportHmacKey(name, key, meta)
+	default:
+		return nil, errors.New("不支持的密钥类型 => " + string(keyType))
+	}
+}
+
+// Rotate 轮换密钥, 生成同类型的新版本密钥并沿用当前版本的元数据
+func (s *KeyStore) Rotate(name string) (*KeyStoreEntry, error) {
+	entry, err := s.Entry(name, 0)
+	if err != nil {
+		return nil, err
+	}
+	return s.GenerateKey(name, entry.Type, entry.Meta)
+}
+
+// Delete 删除密钥, version为0时删除全部版本
+func (s *KeyStore) Delete(name string, version int) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	old := s.file.Keys
+	keys := make([]keyStoreKey, 0, len(old))
+	for _, k := range old {
+		if k.Name == name && (version == 0 || k.Version == version) {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	if len(keys) == len(old) {
+		return ErrKeyNotFound
+	}
+	s.file.Keys = keys
+	if err := s.save(); err != nil {
+		s.file.Keys = old
+		return err
+	}
+	return nil
+}
+
+// Entries 获取全部密钥的元数据, 按名称与版本排序
+func (s *KeyStore) Entries() []*KeyStoreEntry {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	result := make([]*KeyStoreEntry, 0, len(s.file.Keys))
+	for _, k := range s.file.Keys {
+		result = append(result, cloneKeyStoreEntry(k.KeyStoreEntry))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Name != result[j].Name {
+			return result[i].Name < result[j].Name
+		}
+		return result[i].Version < result[j].Version
+	})
+	return result
+}
+
+func (s *KeyStore) find(name string, version int) (*keyStoreKey, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	var result *keyStoreKey
+	for i := range s.file.Keys {
+		k := &s.file.Keys[i]
+		if k.Name != name {
+			continue
+		}
+		if version == 0 && k.Status == KeyStoreKeyActive || version != 0 && k.Version == version {
+			tmp := *k
+			result = &tmp
+		}
+	}
+	if result == nil {
+		return nil, ErrKeyNotFound
+	}
+	return result, nil
+}
+
+// Entry 获取密钥元数据, version为0时获取当前有效版本
+func (s *KeyStore) Entry(name string, version int) (*KeyStoreEntry, error) {
+	k, err := s.find(name, version)
+	if err != nil {
+		return nil, err
+	}
+	return cloneKeyStoreEntry(k.KeyStoreEntry), nil
+}
+
+func (s *KeyStore) key(name string, version int, keyType KeyStoreKeyType) ([]byte, *KeyStoreEntry, error) {
+	k, err := s.find(name, version)
+	if err != nil {
+		return nil, nil, err
+	}
+	if k.Type != keyType {
+		return nil, nil, errors.New("密钥类型不匹配 => " + name)
+	}
+	if s.kek.Closed() {
+		return nil, nil, errors.New("密钥库已关闭")
+	}
+	key, err := Sm4KeyUnwrap(s.kek.Bytes(), k.Wrapped)
+	if err != nil {
+		return nil, nil, errors.New("解包装密钥失败 => " + name)
+	}
+	return key, cloneKeyStoreEntry(k.KeyStoreEntry), nil
+}
+
+// Sm4Key 获取sm4密钥, version为0时获取当前有效版本
+func (s *KeyStore) Sm4Key(name string, version int) ([]byte, error) {
+	key, _, err := s.key(name, version, KeyStoreKeySm4)
+	return key, err
+}
+
+// HmacKey 获取hmac密钥, version为0时获取当前有效版本
+func (s *KeyStore) HmacKey(name string, version int) ([]byte, error) {
+	key, _, err := s.key(name, version, KeyStoreKeyHmac)
+	return key, err
+}
+
+// Sm2Key 获取sm2私钥, version为0时获取当前有效版本
+func (s *KeyStore) Sm2Key(name string, version int) (*sm2.PrivateKey, error) {
+	key, _, err := s.key(name, version, KeyStoreKeySm2)
+	if err != nil {
+		return nil, err
+	}
+	curve := sm2.P256Sm2()
+	pri := &sm2.PrivateKey{D: new(big.Int).SetBytes(key)}
+	pri.PublicKey.Curve = curve
+	pri.PublicKey.X, pri.PublicKey.Y = curve.ScalarBaseMult(key)
+	return pri, nil
+}
+
+func (s *KeyStore) Name() string {
+	return "keystore:" + s.path
+}
+
+// Labels 获取全部密钥名称
+func (s *KeyStore) Labels() ([]string, error) {
+	exists := make(map[string]bool)
+	labels := make([]string, 0)
+	for _, e := range s.Entries() {
+		if !exists[e.Name] {
+			exists[e.Name] = true
+			labels = append(labels, e.Name)
+		}
+	}
+	return labels, nil
+}
+
+func (s *KeyStore) Signer(label string) (Signer, error) {
+	pri, err := s.Sm2Key(label, 0)
+	if err != nil {
+		return nil, err
+	}
+	return pri, nil
+}
+
+func (s *KeyStore) Decrypter(label string) (Decrypter, error) {
+	pri, err := s.Sm2Key(label, 0)
+	if err != nil {
+		return nil, err
+	}
+	return pri, nil
+}
+
+func (s *KeyStore) Encrypter(label string) (Encrypter, error) {
+	pri, err := s.Sm2Key(label, 0)
+	if err != nil {
+		return nil, err
+	}
+	return NewSm2Encrypter(&pri.PublicKey), nil
+}
+
+func (s *KeyStore) SymmetricKey(label string) (SymmetricKey, error) {
+	key, err := s.Sm4Key(label, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &softSymmetricKey{label: label, key: key}, nil
+}
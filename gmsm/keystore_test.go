@@ -0,0 +1,153 @@
+package gmsm
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeyWrap(t *testing.T) {
+	kek, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	key, _ := hex.DecodeString("00112233445566778899aabbccddeeff")
+	block, _ := aes.NewCipher(kek)
+	wrapped, err := KeyWrap(block, key)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if hex.EncodeToString(wrapped) != "1fa68b0a8112b447aef34bd8fb5a7b829d3e862371d2cfe5" {
+		t.Errorf("RFC 3394密钥包装结果错误: %x", wrapped)
+	}
+	unwrapped, err := KeyUnwrap(block, wrapped)
+	if err != nil || !bytes.Equal(unwrapped, key) {
+		t.Error("RFC 3394密钥解包装失败")
+	}
+
+	kek, _ = hex.DecodeString("5840df6e29b02af1ab493b705bf16ea1ae8338f4dcc176a8")
+	key, _ = hex.DecodeString("c37b7e6492584340bed12207808941155068f738")
+	wrapped, err = AesKeyWrap(kek, key)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if hex.EncodeToString(wrapped) != "138bdeaa9b8fa7fc61f97742e72248ee5ae6ae5360d1ae6a5f54f373fa543b6a" {
+		t.Errorf("RFC 5649密钥包装结果错误: %x", wrapped)
+	}
+
+	sm4Kek := Sm4RandomKey()
+	for _, size := range []int{1, 7, 8, 16, 32, 45} {
+		key = bytes.Repeat([]byte{0x5a}, size)
+		wrapped, err = Sm4KeyWrap(sm4Kek, key)
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		unwrapped, err = Sm4KeyUnwrap(sm4Kek, wrapped)
+		if err != nil || !bytes.Equal(unwrapped, key) {
+			t.Errorf("sm4密钥解包装失败: %d", size)
+		}
+		wrapped[len(wrapped)-1] ^= 1
+		if _, err = Sm4KeyUnwrap(sm4Kek, wrapped); err == nil {
+			t.Errorf("篡改后的包装密钥应当解包装失败: %d", size)
+		}
+	}
+}
+
+func TestKeyStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keystore")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "keys.json")
+
+	store, err := CreateKeyStoreWithPassword(path, "keystore-password")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	sm4Key := Sm4RandomKey()
+	if _, err = store.ImportSm4Key("data", sm4Key, map[string]string{"usage": "package"}); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if _, err = store.GenerateKey("sign", KeyStoreKeySm2, nil); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if _, err = store.GenerateKey("mac", KeyStoreKeyHmac, nil); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	entry, err := store.Rotate("data")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if entry.Version != 2 || entry.Meta["usage"] != "package" {
+		t.Errorf("轮换后的密钥信息错误: %+v", entry)
+	}
+
+	if _, err = OpenKeyStoreWithPassword(path, "wrong-password"); err == nil {
+		t.Error("错误的口令应当打开失败")
+	}
+	store, err = OpenKeyStoreWithPassword(path, "keystore-password")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	old, err := store.Sm4Key("data", 1)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if !bytes.Equal(old, sm4Key) {
+		t.Error("旧版本sm4密钥不一致")
+	}
+	current, err := store.Sm4Key("data", 0)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if bytes.Equal(current, sm4Key) {
+		t.Error("轮换后的sm4密钥不应与旧版本相同")
+	}
+	if entry, _ = store.Entry("data", 1); entry.Status != KeyStoreKeyRetired {
+		t.Error("轮换后旧版本应当为retired状态")
+	}
+	if _, err = store.Sm4Key("sign", 0); err == nil {
+		t.Error("密钥类型不匹配时应当返回错误")
+	}
+
+	signer, err := store.Signer("sign")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	pubKey, _ := Sm2PublicKeyOf(signer)
+	sign, err := signer.Sign(nil, []byte("keystore"), nil)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if !pubKey.Verify([]byte("keystore"), sign) {
+		t.Error("密钥库sm2私钥签名验证失败")
+	}
+
+	data, _ := ioutil.ReadFile(path)
+	tampered := bytes.Replace(data, []byte(`"version": 2`), []byte(`"version": 3`), 1)
+	if bytes.Equal(tampered, data) {
+		t.Error("测试数据替换失败")
+		return
+	}
+	_ = ioutil.WriteFile(path, tampered, 0600)
+	if _, err = OpenKeyStoreWithPassword(path, "keystore-password"); err == nil {
+		t.Error("被篡改的密钥库应当打开失败")
+	}
+}
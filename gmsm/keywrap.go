@@ -0,0 +1,172 @@
+package gmsm
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"github.com/tjfoc/gmsm/sm4"
+)
+
+var (
+	keyWrapIv    = []byte{0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6}
+	keyWrapPadIv = []byte{0xa6, 0x59, 0x59, 0xa6}
+)
+
+// KeyWrap RFC 3394 密钥包装, block为分组长度16字节的分组密码(sm4/aes), key长度必须为8的倍数且不小于16字节
+func KeyWrap(block cipher.Block, key []byte) ([]byte, error) {
+	if len(key) < 16 || len(key)%8 != 0 {
+		return nil, errors.New("被包装密钥长度必须为8的倍数且不小于16字节")
+	}
+	return keyWrap(block, keyWrapIv, key)
+}
+
+// KeyUnwrap RFC 3394 密钥解包装
+func KeyUnwrap(block cipher.Block, wrapped []byte) ([]byte, error) {
+	if len(wrapped) < 24 || len(wrapped)%8 != 0 {
+		return nil, errors.New("包装密钥长度错误")
+	}
+	a, key, err := keyUnwrap(block, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare(a, keyWrapIv) != 1 {
+		return nil, errors.New("密钥解包装校验失败")
+	}
+	return key, nil
+}
+
+// KeyWrapPad RFC 5649 带填充的密钥包装, key可以为任意非空长度
+func KeyWrapPad(block cipher.Block, key []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, errors.New("被包装密钥不能为空")
+	}
+	iv := make([]byte, 8)
+	copy(iv, keyWrapPadIv)
+	binary.BigEndian.PutUint32(iv[4:], uint32(len(key)))
+
+	padded := make([]byte, (len(key)+7)/8*8)
+	copy(padded, key)
+	if len(padded) == 8 {
+		result := make([]byte, 16)
+		block.Encrypt(result, append(iv, padded...))
+		return result, nil
+	}
+	return keyWrap(block, iv, padded)
+}
+
+// KeyUnwrapPad RFC 5649 带填充的密钥解包装
+func KeyUnwrapPad(block cipher.Block, wrapped []byte) ([]byte, error) {
+	if len(wrapped) < 16 || len(wrapped)%8 != 0 {
+		return nil, errors.New("包装密钥长度错误")
+	}
+
+	var a, padded []byte
+	if len(wrapped) == 16 {
+		plain := make([]byte, 16)
+		block.Decrypt(plain, wrapped)
+		a, padded = plain[:8], plain[8:]
+	} else {
+		var err error
+		if a, padded, err = keyUnwrap(block, wrapped); err != nil {
+			return nil, err
+		}
+	}
+
+	size := int(binary.BigEndian.Uint32(a[4:]))
+	if subtle.ConstantTimeCompare(a[:4], keyWrapPadIv) != 1 || size > len(padded) || size <= len(padded)-8 {
+		return nil, errors.New("密钥解包装校验失败")
+	}
+	var zero byte
+	for _, v := range padded[size:] {
+		zero |= v
+	}
+	if zero != 0 {
+		return nil, errors.New("密钥解包装校验失败")
+	}
+	return padded[:size], nil
+}
+
+func keyWrap(block cipher.Block, iv, key []byte) ([]byte, error) {
+	if block.BlockSize() != 16 {
+		return nil, errors.New("密钥包装需要分组长度为16字节的分组密码")
+	}
+	n := len(key) / 8
+	result := make([]byte, 8+len(key))
+	copy(result, iv)
+	copy(result[8:], key)
+
+	b := make([]byte, 16)
+	for j := 0; j < 6; j++ {
+		for i := 1; i <= n; i++ {
+			copy(b, result[:8])
+			copy(b[8:], result[i*8:i*8+8])
+			block.Encrypt(b, b)
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(result[:8], binary.BigEndian.Uint64(b[:8])^t)
+			copy(result[i*8:], b[8:])
+		}
+	}
+	return result, nil
+}
+
+func keyUnwrap(block cipher.Block, wrapped []byte) ([]byte, []byte, error) {
+	if block.BlockSize() != 16 {
+		return nil, nil, errors.New("密钥包装需要分组长度为16字节的分组密码")
+	}
+	n := len(wrapped)/8 - 1
+	a := make([]byte, 8)
+	copy(a, wrapped[:8])
+	r := make([]byte, len(wrapped)-8)
+	copy(r, wrapped[8:])
+
+	b := make([]byte, 16)
+	for j := 5; j >= 0; j-- {
+		for i := n; i >= 1; i-- {
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(b[:8], binary.BigEndian.Uint64(a)^t)
+			copy(b[8:], r[(i-1)*8:i*8])
+			block.Decrypt(b, b)
+			copy(a, b[:8])
+			copy(r[(i-1)*8:], b[8:])
+		}
+	}
+	return a, r, nil
+}
+
+// Sm4KeyWrap 使用sm4密钥加密密钥(kek)包装密钥, 任意长度密钥使用RFC 5649填充
+func Sm4KeyWrap(kek, key []byte) ([]byte, error) {
+	block, err := sm4.NewCipher(kek)
+	if err != nil {
+		return nil, errors.New("创建sm4加密器失败 => " + err.Error())
+	}
+	return KeyWrapPad(block, key)
+}
+
+// Sm4KeyUnwrap 使用sm4密钥加密密钥(kek)解包装密钥
+func Sm4KeyUnwrap(kek, wrapped []byte) ([]byte, error) {
+	block, err := sm4.NewCipher(kek)
+	if err != nil {
+		return nil, errors.New("创建sm4解密器失败 => " + err.Error())
+	}
+	return KeyUnwrapPad(block, wrapped)
+}
+
+// AesKeyWrap 使用aes密钥加密密钥(kek)包装密钥, 任意长度密钥使用RFC 5649填充
+func AesKeyWrap(kek, key []byte) ([]byte, error) {
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, errors.New("创建aes加密器失败 => " + err.Error())
+	}
+	return KeyWrapPad(block, key)
+}
+
+// AesKeyUnwrap 使用aes密钥加密密钥(kek)解包装密钥
+func AesKeyUnwrap(kek, wrapped []byte) ([]byte, error) {
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, errors.New("创建aes解密器失败 => " + err.Error())
+	}
+	return KeyUnwrapPad(block, wrapped)
+}
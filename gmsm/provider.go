@@ -0,0 +1,269 @@
+package gmsm
+
+import (
+	"crypto"
+	"crypto/rand"
+	"errors"
+	"github.com/tjfoc/gmsm/sm2"
+	"io"
+	"sort"
+	"sync"
+)
+
+// Signer sm2签名密钥句柄, *sm2.PrivateKey满足该接口
+// Sign的msg为原文, 由实现方使用默认用户标识计算ZA与sm3摘要, 返回ASN.1格式签名
+type Signer interface {
+	Public() crypto.PublicKey
+	Sign(rand io.Reader, msg []byte, opts crypto.SignerOpts) ([]byte, error)
+}
+
+// Decrypter sm2解密密钥句柄, *sm2.PrivateKey满足该接口
+// Decrypt的密文为C1C3C2格式
+type Decrypter interface {
+	Public() crypto.PublicKey
+	Decrypt(rand io.Reader, msg []byte, opts crypto.DecrypterOpts) ([]byte, error)
+}
+
+// Encrypter 公钥加密句柄, sm2实现输出C1C3C2格式密文, sm9实现输出ASN.1格式密文
+type Encrypter interface {
+	Public() crypto.PublicKey
+	Encrypt(data []byte) ([]byte, error)
+}
+
+// SymmetricKey sm4对称密钥句柄
+// Encrypt输出 iv || sm4-cbc密文, Decrypt为其逆过程
+type SymmetricKey interface {
+	Label() string
+	Encrypt(plainText []byte) ([]byte, error)
+	Decrypt(cipherText []byte) ([]byte, error)
+}
+
+// Provider 密钥提供者, 通过标签查找密钥句柄
+// 软件实现为SoftProvider与SoftToken, 密码卡(SDF/SKF)等硬件实现只需实现该接口
+type Provider interface {
+	Name() string
+	Labels() ([]string, error)
+	Signer(label string) (Signer, error)
+	Decrypter(label string) (Decrypter, error)
+	Encrypter(label string) (Encrypter, error)
+	SymmetricKey(label string) (SymmetricKey, error)
+}
+
+// ErrKeyNotFound 未找到密钥
+var ErrKeyNotFound = errors.New("未找到密钥")
+
+type sm2Encrypter struct {
+	pubKey *sm2.PublicKey
+}
+
+// NewSm2Encrypter 使用sm2公钥创建加密句柄
+func NewSm2Encrypter(pubKey *sm2.PublicKey) Encrypter {
+	return &sm2Encrypter{pubKey: pubKey}
+}
+
+func (e *sm2Encrypter) Public() crypto.PublicKey {
+	return e.pubKey
+}
+
+func (e *sm2Encrypter) Encrypt(data []byte) ([]byte, error) {
+	return Sm2Encrypt(e.pubKey, data)
+}
+
+// Sm2PublicKeyOf 获取密钥句柄中的sm2公钥
+func Sm2PublicKeyOf(key interface{ Public() crypto.PublicKey }) (*sm2.PublicKey, error) {
+	if key == nil {
+		return nil, errors.New("密钥句柄不能为空")
+	}
+	pubKey, ok := key.Public().(*sm2.PublicKey)
+	if !ok || pubKey == nil {
+		return nil, errors.New("密钥句柄不是sm2公钥")
+	}
+	return pubKey, nil
+}
+
+// Sm2DecryptAutoWith 使用解密句柄自动识别密文格式并解密
+func Sm2DecryptAutoWith(d Decrypter, data []byte) ([]byte, error) {
+	if pri, ok := d.(*sm2.PrivateKey); ok {
+		return Sm2DecryptAuto(pri, data)
+	}
+
+	mode, err := Sm2CipherDetect(data)
+	if err != nil {
+		return nil, err
+	}
+	modes := []Sm2CipherMode{Sm2CipherC1C3C2, Sm2CipherC1C2C3}
+	if mode == Sm2CipherAsn1 {
+		modes = []Sm2CipherMode{Sm2CipherAsn1}
+	}
+	for _, m := range modes {
+		c1c3c2, err := Sm2CipherConvert(data, m, Sm2CipherC1C3C2)
+		if err != nil {
+			return nil, err
+		}
+		if decrypt, err := d.Decrypt(rand.Reader, c1c3c2, nil); err == nil {
+			return decrypt, nil
+		}
+	}
+	return nil, errors.New("解密数据失败")
+}
+
+type softSymmetricKey struct {
+	label string
+	key   []byte
+}
+
+func (k *softSymmetricKey) Label() string {
+	return k.label
+}
+
+func (k *softSymmetricKey) Encrypt(plainText []byte) ([]byte, error) {
+	iv := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, errors.New("生成初始向量失败")
+	}
+	encrypt, err := Sm4CbcEncrypt(k.key, iv, plainText)
+	if err != nil {
+		return nil, err
+	}
+	return append(iv, encrypt...), nil
+}
+
+func (k *softSymmetricKey) Decrypt(cipherText []byte) ([]byte, error) {
+	if len(cipherText) < 16 {
+		return nil, errors.New("sm4密文长度错误")
+	}
+	return Sm4CbcDecrypt(k.key, cipherText[:16], cipherText[16:])
+}
+
+// SoftProvider 进程内软件密钥提供者
+type SoftProvider struct {
+	lock    sync.RWMutex
+	sm2Keys map[string]*sm2.PrivateKey
+	sm4Keys map[string][]byte
+}
+
+// NewSoftProvider 创建进程内软件密钥提供者
+func NewSoftProvider() *SoftProvider {
+	return &SoftProvider{
+		sm2Keys: make(map[string]*sm2.PrivateKey),
+		sm4Keys: make(map[string][]byte),
+	}
+}
+
+func (p *SoftProvider) Name() string {
+	return "soft"
+}
+
+// AddSm2Key 添加sm2私钥
+func (p *SoftProvider) AddSm2Key(label string, pri *sm2.PrivateKey) error {
+	if label == "" || pri == nil {
+		return errors.New("密钥标签与私钥不能为空")
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.sm2Keys[label] = pri
+	return nil
+}
+
+// AddSm4Key 添加sm4密钥
+func (p *SoftProvider) AddSm4Key(label string, key []byte) error {
+	if label == "" {
+		return errors.New("密钥标签不能为空")
+	}
+	if len(key) != 16 {
+		return errors.New("sm4密钥长度必须为16字节")
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.sm4Keys[label] = append([]byte(nil), key...)
+	return nil
+}
+
+// GenerateSm2Key 生成并添加sm2私钥
+func (p *SoftProvider) GenerateSm2Key(label string) (*sm2.PublicKey, error) {
+	pri, err := sm2.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, errors.New("生成sm2私钥失败")
+	}
+	if err = p.AddSm2Key(label, pri); err != nil {
+		return nil, err
+	}
+	return &pri.PublicKey, nil
+}
+
+// GenerateSm4Key 生成并添加sm4密钥
+func (p *SoftProvider) GenerateSm4Key(label string) error {
+	key := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return errors.New("生成sm4密钥失败")
+	}
+	return p.AddSm4Key(label, key)
+}
+
+// Remove 删除密钥
+func (p *SoftProvider) Remove(label string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	delete(p.sm2Keys, label)
+	delete(p.sm4Keys, label)
+}
+
+func (p *SoftProvider) Labels() ([]string, error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	labels := make([]string, 0, len(p.sm2Keys)+len(p.sm4Keys))
+	for label := range p.sm2Keys {
+		labels = append(labels, label)
+	}
+	for label := range p.sm4Keys {
+		if _, ok := p.sm2Keys[label]; !ok {
+			labels = append(labels, label)
+		}
+	}
+	sort.Strings(labels)
+	return labels, nil
+}
+
+func (p *SoftProvider) sm2Key(label string) (*sm2.PrivateKey, error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	pri, ok := p.sm2Keys[label]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return pri, nil
+}
+
+func (p *SoftProvider) Signer(label string) (Signer, error) {
+	pri, err := p.sm2Key(label)
+	if err != nil {
+		return nil, err
+	}
+	return pri, nil
+}
+
+func (p *SoftProvider) Decrypter(label string) (Decrypter, error) {
+	pri, err := p.sm2Key(label)
+	if err != nil {
+		return nil, err
+	}
+	return pri, nil
+}
+
+func (p *SoftProvider) Encrypter(label string) (Encrypter, error) {
+	pri, err := p.sm2Key(label)
+	if err != nil {
+		return nil, err
+	}
+	return NewSm2Encrypter(&pri.PublicKey), nil
+}
+
+func (p *SoftProvider) SymmetricKey(label string) (SymmetricKey, error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	key, ok := p.sm4Keys[label]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return &softSymmetricKey{label: label, key: key}, nil
+}
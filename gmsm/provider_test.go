@@ -0,0 +1,169 @@
+package gmsm
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testProvider(t *testing.T, p Provider) {
+	signer, err := p.Signer("sm2")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	pubKey, err := Sm2PublicKeyOf(signer)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	data := []byte("密钥提供者测试")
+	sign, err := signer.Sign(rand.Reader, data, nil)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if !pubKey.Verify(data, sign) {
+		t.Error("签名验证失败")
+	}
+
+	encrypter, err := p.Encrypter("sm2")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	decrypter, err := p.Decrypter("sm2")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	encrypt, err := encrypter.Encrypt(data)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	asn1Encrypt, err := Sm2CipherConvert(encrypt, Sm2CipherC1C3C2, Sm2CipherAsn1)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	for _, v := range [][]byte{encrypt, asn1Encrypt} {
+		decrypt, err := Sm2DecryptAutoWith(decrypter, v)
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		if !bytes.Equal(decrypt, data) {
+			t.Error("sm2解密结果不一致")
+		}
+	}
+
+	key, err := p.SymmetricKey("sm4")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	encrypt, err = key.Encrypt(data)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	decrypt, err := key.Decrypt(encrypt)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if !bytes.Equal(decrypt, data) {
+		t.Error("sm4解密结果不一致")
+	}
+
+	if _, err = p.Signer("none"); err != ErrKeyNotFound {
+		t.Error("查找不存在的密钥应当返回ErrKeyNotFound")
+	}
+	labels, err := p.Labels()
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if len(labels) != 2 || labels[0] != "sm2" || labels[1] != "sm4" {
+		t.Errorf("密钥标签列表错误: %v", labels)
+	}
+}
+
+func TestSoftProvider(t *testing.T) {
+	p := NewSoftProvider()
+	if _, err := p.GenerateSm2Key("sm2"); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if err := p.GenerateSm4Key("sm4"); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	testProvider(t, p)
+}
+
+func TestSoftToken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "softtoken")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	token, err := OpenSoftToken(dir, "123456")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if _, err = token.GenerateSm2Key("sm2"); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if err = token.GenerateSm4Key("sm4"); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if err = token.ImportSm4Key("../sm4", make([]byte, 16)); err == nil {
+		t.Error("非法的密钥标签应当被拒绝")
+	}
+
+	if _, err = OpenSoftToken(dir, "654321"); err == nil {
+		t.Error("错误的口令应当打开失败")
+	}
+	token, err = OpenSoftToken(dir, "123456")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	testProvider(t, token)
+}
+
+func TestSoftTokenVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "softtoken")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// 缺少Version头或版本未知的令牌不能打开
+	for _, headers := range []map[string]string{
+		{"Salt": hex.EncodeToString(make([]byte, 16))},
+		{"Salt": hex.EncodeToString(make([]byte, 16)), "Version": "99"},
+	} {
+		token := &pem.Block{Type: "SOFT TOKEN", Headers: headers, Bytes: make([]byte, 32)}
+		if err = ioutil.WriteFile(filepath.Join(dir, softTokenInfoFile), pem.EncodeToMemory(token), 0600); err != nil {
+			t.Error(err.Error())
+			return
+		}
+		if _, err = OpenSoftToken(dir, "123456"); err == nil {
+			t.Errorf("版本不正确的令牌应当打开失败: %v", headers)
+		}
+	}
+}
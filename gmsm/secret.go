@@ -0,0 +1,105 @@
+package gmsm
+
+import (
+	"errors"
+	"github.com/byzk-org/common-utils/commonutils"
+	"github.com/tjfoc/gmsm/sm2"
+	"github.com/tjfoc/gmsm/x509"
+	"os"
+)
+
+// Sm4RandomSecret 生成保存在敏感数据缓冲区中的sm4随机密钥
+func Sm4RandomSecret() *commonutils.Secret {
+	return commonutils.NewSecretAndZero(Sm4RandomKey())
+}
+
+func secretKey(key *commonutils.Secret) ([]byte, error) {
+	data := key.Bytes()
+	if data == nil {
+		return nil, errors.New("密钥为空或已关闭")
+	}
+	return data, nil
+}
+
+// Sm4EncryptSecret 使用敏感数据缓冲区中的密钥进行sm4加密
+func Sm4EncryptSecret(key *commonutils.Secret, plainText []byte) ([]byte, error) {
+	data, err := secretKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return Sm4Encrypt(data, plainText)
+}
+
+// Sm4Encrypt2FileSecret 使用敏感数据缓冲区中的密钥加密sm4到文件
+func Sm4Encrypt2FileSecret(key *commonutils.Secret, srcFile, destFile *os.File) error {
+	data, err := secretKey(key)
+	if err != nil {
+		return err
+	}
+	return Sm4Encrypt2File(data, srcFile, destFile)
+}
+
+// Sm4CbcEncryptSecret 使用敏感数据缓冲区中的密钥进行sm4 CBC模式加密
+func Sm4CbcEncryptSecret(key *commonutils.Secret, iv, plainText []byte) ([]byte, error) {
+	data, err := secretKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return Sm4CbcEncrypt(data, iv, plainText)
+}
+
+// Sm4CbcDecryptSecret 使用敏感数据缓冲区中的密钥进行sm4 CBC模式解密
+func Sm4CbcDecryptSecret(key *commonutils.Secret, iv, cipherText []byte) ([]byte, error) {
+	data, err := secretKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return Sm4CbcDecrypt(data, iv, cipherText)
+}
+
+// Sm2EncryptSecret 使用sm2公钥加密敏感数据缓冲区中的内容, 密文为C1C3C2格式
+func Sm2EncryptSecret(pubKey *sm2.PublicKey, secret *commonutils.Secret) ([]byte, error) {
+	data, err := secretKey(secret)
+	if err != nil {
+		return nil, err
+	}
+	return Sm2Encrypt(pubKey, data)
+}
+
+// Sm2DecryptSecret sm2解密, 明文保存在敏感数据缓冲区中
+func Sm2DecryptSecret(pri *sm2.PrivateKey, data []byte) (*commonutils.Secret, error) {
+	decrypt, err := Sm2Decrypt(pri, data)
+	if err != nil {
+		return nil, err
+	}
+	return commonutils.NewSecretAndZero(decrypt), nil
+}
+
+// ParseSm2PrivateKeySecret 解析敏感数据缓冲区中的PEM格式sm2私钥, pwd为空时私钥未加密
+func ParseSm2PrivateKeySecret(keyPem, pwd *commonutils.Secret) (*sm2.PrivateKey, error) {
+	data, err := secretKey(keyPem)
+	if err != nil {
+		return nil, err
+	}
+	var password []byte
+	if pwd != nil {
+		password = pwd.Bytes()
+	}
+	pri, err := x509.ReadPrivateKeyFromPem(data, password)
+	if err != nil {
+		return nil, errors.New("解析sm2私钥失败")
+	}
+	return pri, nil
+}
+
+// ZeroSm2PrivateKey 清零sm2私钥
+func ZeroSm2PrivateKey(pri *sm2.PrivateKey) {
+	if pri == nil || pri.D == nil {
+		return
+	}
+	words := pri.D.Bits()
+	for i := range words {
+		words[i] = 0
+	}
+	pri.D.SetInt64(0)
+}
@@ -0,0 +1,379 @@
+package gmsm
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"github.com/tjfoc/gmsm/sm3"
+	"github.com/tjfoc/gmsm/x509"
+	"io"
+	"io/ioutil"
+	"sort"
+	"time"
+)
+
+var (
+	oidAttributeContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttributeMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidAttributeSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+)
+
+type cmsSignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      cmsContentInfo
+	Certificates     asn1.RawValue   `asn1:"optional,tag:0"`
+	Crls             asn1.RawValue   `asn1:"optional,tag:1"`
+	SignerInfos      []cmsSignerInfo `asn1:"set"`
+}
+
+type cmsSignerInfo struct {
+	Version                   int
+	IssuerAndSerialNumber     cmsIssuerAndSerial
+	DigestAlgorithm           pkix.AlgorithmIdentifier
+	AuthenticatedAttributes   asn1.RawValue `asn1:"optional,tag:0"`
+	DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedDigest           []byte
+	UnauthenticatedAttributes asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type cmsAttribute struct {
+	Type  asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+type cmsAttributeValue struct {
+	oid   asn1.ObjectIdentifier
+	value interface{}
+}
+
+// SignedDataOptions CMS签名选项
+type SignedDataOptions struct {
+	// Detached 分离式签名, 签名结果中不包含原文
+	Detached bool
+	// Chain 随签名附带的证书链(不含签名证书)
+	Chain []*x509.Certificate
+	// Scheme 内容类型OID体系
+	Scheme CmsOidScheme
+	// SigningTime 签名时间, 为空时使用当前时间
+	SigningTime time.Time
+}
+
+// SignedDataInfo CMS签名验证结果
+type SignedDataInfo struct {
+	// Signer 签名证书
+	Signer *x509.Certificate
+	// Certificates 签名中附带的全部证书
+	Certificates []*x509.Certificate
+	// SigningTime 签名时间属性, 不存在时为空
+	SigningTime time.Time
+	// Content 原文, 分离式签名时为空
+	Content []byte
+}
+
+// CreateSignedData 使用sm2/sm3创建CMS签名(SignedData)
+// 分离式签名时以流的方式计算摘要, 适用于大文件; 非分离式签名需要将原文放入签名结果中
+// pri可以是*sm2.PrivateKey或密钥提供者返回的签名句柄
+func CreateSignedData(content io.Reader, signCert *x509.Certificate, pri Signer, opts *SignedDataOptions) ([]byte, error) {
+	if signCert == nil || pri == nil {
+		return nil, errors.New("签名证书与私钥不能为空")
+	}
+	if opts == nil {
+		opts = &SignedDataOptions{}
+	}
+
+	var (
+		h    = sm3.New()
+		data []byte
+		err  error
+	)
+	if opts.Detached {
+		_, err = io.Copy(h, content)
+	} else {
+		data, err = ioutil.ReadAll(content)
+		if err == nil {
+			h.Write(data)
+		}
+	}
+	if err != nil {
+		return nil, errors.New("读取签名原文失败 => " + err.Error())
+	}
+
+	signingTime := opts.SigningTime
+	if signingTime.IsZero() {
+		signingTime = time.Now()
+	}
+	attrs, err := marshalCmsAttributes([]cmsAttributeValue{
+		{oidAttributeContentType, opts.Scheme.dataOid()},
+		{oidAttributeMessageDigest, h.Sum(nil)},
+		{oidAttributeSigningTime, signingTime.UTC()},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := pri.Sign(rand.Reader, attrs.FullBytes, nil)
+	if err != nil {
+		return nil, errors.New("签名失败 => " + err.Error())
+	}
+
+	certs := bytes.Buffer{}
+	certs.Write(signCert.Raw)
+	for _, c := range opts.Chain {
+		certs.Write(c.Raw)
+	}
+
+	contentInfo := cmsContentInfo{ContentType: opts.Scheme.dataOid()}
+	if !opts.Detached {
+		octets, err := asn1.Marshal(data)
+		if err != nil {
+			return nil, errors.New("转换签名原文失败")
+		}
+		contentInfo.Content = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: octets}
+	}
+
+	signedData, err := asn1.Marshal(cmsSignedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{cmsAlgorithm(oidSm3)},
+		ContentInfo:      contentInfo,
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certs.Bytes()},
+		SignerInfos: []cmsSignerInfo{{
+			Version:                   1,
+			IssuerAndSerialNumber:     cmsIssuerAndSerialOf(signCert),
+			DigestAlgorithm:           cmsAlgorithm(oidSm3),
+			AuthenticatedAttributes:   asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attrs.Bytes},
+			DigestEncryptionAlgorithm: cmsAlgorithm(oidSm2Sign),
+			EncryptedDigest:           signature,
+		}},
+	})
+	if err != nil {
+		return nil, errors.New("转换签名数据失败 => " + err.Error())
+	}
+	return marshalCmsContentInfo(opts.Scheme.signedDataOid(), signedData)
+}
+
+// VerifySignedData 验证CMS签名, 同时支持PKCS#7与GM/T 0010的内容类型OID
+// content为空时使用签名中附带的原文; roots不为空时校验签名证书链
+func VerifySignedData(signed []byte, content io.Reader, roots *x509.CertPool) (*SignedDataInfo, error) {
+	contentType, raw, err := parseCmsContentInfo(signed)
+	if err != nil {
+		return nil, err
+	}
+	if !contentType.Equal(oidPkcs7SignedData) && !contentType.Equal(oidGmSignedData) {
+		return nil, errors.New("数据不是签名数据")
+	}
+
+	var signedData cmsSignedData
+	if _, err = asn1.Unmarshal(raw, &signedData); err != nil {
+		return nil, errors.New("解析签名数据失败 => " + err.Error())
+	}
+	if len(signedData.SignerInfos) == 0 {
+		return nil, errors.New("签名数据中不包含签名者信息")
+	}
+
+	certs, err := parseCmsCertificates(signedData.Certificates)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SignedDataInfo{Certificates: certs}
+	if len(signedData.ContentInfo.Content.Bytes) > 0 {
+		var octets asn1.RawValue
+		if _, err = asn1.Unmarshal(signedData.ContentInfo.Content.Bytes, &octets); err != nil {
+			return nil, errors.New("解析签名原文失败")
+		}
+		if result.Content, err = parseCmsOctetString(octets); err != nil {
+			return nil, err
+		}
+	}
+
+	// 没有签名属性时签名值直接针对原文, 需要保留原文
+	needContent := false
+	for _, signer := range signedData.SignerInfos {
+		if len(signer.AuthenticatedAttributes.Bytes) == 0 {
+			needContent = true
+		}
+	}
+
+	data := result.Content
+	h := sm3.New()
+	if content != nil {
+		if needContent {
+			data, err = ioutil.ReadAll(content)
+			h.Write(data)
+		} else {
+			_, err = io.Copy(h, content)
+		}
+		if err != nil {
+			return nil, errors.New("读取签名原文失败 => " + err.Error())
+		}
+	} else if data != nil {
+		h.Write(data)
+	} else {
+		return nil, errors.New("分离式签名需要提供原文")
+	}
+	digest := h.Sum(nil)
+
+	for i, signer := range signedData.SignerInfos {
+		signCert := findCmsCertificate(certs, signer.IssuerAndSerialNumber)
+		if signCert == nil {
+			return nil, errors.New("未找到签名证书")
+		}
+		signingTime, err := verifyCmsSigner(signer, signCert, digest, data)
+		if err != nil {
+			return nil, err
+		}
+
+		if roots != nil {
+			intermediates := x509.NewCertPool()
+			for _, c := range certs {
+				intermediates.AddCert(c)
+			}
+			if _, err = signCert.Verify(x509.VerifyOptions{
+				Roots:         roots,
+				Intermediates: intermediates,
+				KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+			}); err != nil {
+				return nil, errors.New("签名证书链验证失败 => " + err.Error())
+			}
+		}
+
+		if i == 0 {
+			result.Signer = signCert
+			result.SigningTime = signingTime
+		}
+	}
+	return result, nil
+}
+
+func verifyCmsSigner(signer cmsSignerInfo, signCert *x509.Certificate, digest, data []byte) (time.Time, error) {
+	var signingTime time.Time
+
+	if !signer.DigestAlgorithm.Algorithm.Equal(oidSm3) {
+		return signingTime, errors.New("不支持的摘要算法 => " + signer.DigestAlgorithm.Algorithm.String())
+	}
+	if alg := signer.DigestEncryptionAlgorithm.Algorithm; !alg.Equal(oidSm2Sign) && !alg.Equal(oidSm2WithSm3) {
+		return signingTime, errors.New("不支持的签名算法 => " + alg.String())
+	}
+
+	pubKey, err := Sm2PublicKeyOfCert(signCert)
+	if err != nil {
+		return signingTime, err
+	}
+
+	signSrc := data
+	if len(signer.AuthenticatedAttributes.Bytes) > 0 {
+		attrs, err := parseCmsAttributes(signer.AuthenticatedAttributes.Bytes)
+		if err != nil {
+			return signingTime, err
+		}
+
+		var messageDigest []byte
+		if v, ok := attrs[oidAttributeMessageDigest.String()]; !ok {
+			return signingTime, errors.New("签名属性中缺少原文摘要")
+		} else if _, err = asn1.Unmarshal(v, &messageDigest); err != nil {
+			return signingTime, errors.New("解析原文摘要属性失败")
+		}
+		if !bytes.Equal(messageDigest, digest) {
+			return signingTime, errors.New("原文摘要不一致")
+		}
+
+		if v, ok := attrs[oidAttributeSigningTime.String()]; ok {
+			if _, err = asn1.Unmarshal(v, &signingTime); err != nil {
+				return signingTime, errors.New("解析签名时间属性失败")
+			}
+		}
+
+		// 签名针对的是 SET OF Attribute 的DER编码
+		signSrc, err = asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: signer.AuthenticatedAttributes.Bytes})
+		if err != nil {
+			return signingTime, errors.New("转换签名属性失败")
+		}
+	}
+
+	if !pubKey.Verify(signSrc, signer.EncryptedDigest) {
+		return signingTime, errors.New("签名值验证失败")
+	}
+	return signingTime, nil
+}
+
+// marshalCmsAttributes 按DER规则编码 SET OF Attribute, 返回值的Bytes为集合内容
+func marshalCmsAttributes(values []cmsAttributeValue) (*asn1.RawValue, error) {
+	encoded := make([][]byte, 0, len(values))
+	for _, value := range values {
+		v, err := asn1.Marshal(value.value)
+		if err != nil {
+			return nil, errors.New("转换签名属性失败 => " + err.Error())
+		}
+		attr, err := asn1.Marshal(cmsAttribute{
+			Type:  value.oid,
+			Value: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: v},
+		})
+		if err != nil {
+			return nil, errors.New("转换签名属性失败 => " + err.Error())
+		}
+		encoded = append(encoded, attr)
+	}
+
+	sort.Slice(encoded, func(i, j int) bool {
+		return bytes.Compare(encoded[i], encoded[j]) < 0
+	})
+
+	set := &asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: bytes.Join(encoded, nil)}
+	fullBytes, err := asn1.Marshal(*set)
+	if err != nil {
+		return nil, errors.New("转换签名属性失败 => " + err.Error())
+	}
+	set.FullBytes = fullBytes
+	return set, nil
+}
+
+// parseCmsAttributes 解析签名属性, 返回属性OID到第一个属性值的映射
+func parseCmsAttributes(data []byte) (map[string][]byte, error) {
+	result := make(map[string][]byte)
+	for rest := data; len(rest) > 0; {
+		var (
+			attr cmsAttribute
+			err  error
+		)
+		if rest, err = asn1.Unmarshal(rest, &attr); err != nil {
+			return nil, errors.New("解析签名属性失败")
+		}
+		var value asn1.RawValue
+		if _, err = asn1.Unmarshal(attr.Value.Bytes, &value); err != nil {
+			return nil, errors.New("解析签名属性值失败")
+		}
+		result[attr.Type.String()] = value.FullBytes
+	}
+	return result, nil
+}
+
+func parseCmsCertificates(raw asn1.RawValue) ([]*x509.Certificate, error) {
+	certs := make([]*x509.Certificate, 0, 2)
+	for rest := raw.Bytes; len(rest) > 0; {
+		var (
+			v   asn1.RawValue
+			err error
+		)
+		if rest, err = asn1.Unmarshal(rest, &v); err != nil {
+			return nil, errors.New("解析签名中的证书失败")
+		}
+		c, err := x509.ParseCertificate(v.FullBytes)
+		if err != nil {
+			return nil, errors.New("解析签名中的证书失败 => " + err.Error())
+		}
+		certs = append(certs, c)
+	}
+	return certs, nil
+}
+
+func findCmsCertificate(certs []*x509.Certificate, ias cmsIssuerAndSerial) *x509.Certificate {
+	for _, c := range certs {
+		if ias.match(c) {
+			return c
+		}
+	}
+	return nil
+}
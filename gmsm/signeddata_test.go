@@ -0,0 +1,75 @@
+package gmsm
+
+import (
+	"bytes"
+	"github.com/tjfoc/gmsm/x509"
+	"testing"
+	"time"
+)
+
+func TestSignedData(t *testing.T) {
+	ca := createTestCa(t)
+	signer := createTestCert(t, ca, "signer")
+	other := createTestCa(t)
+	content := bytes.Repeat([]byte("CMS签名测试"), 1000)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+	otherRoots := x509.NewCertPool()
+	otherRoots.AddCert(other.Cert)
+
+	signingTime := time.Date(2021, 4, 1, 8, 0, 0, 0, time.UTC)
+	for _, scheme := range []CmsOidScheme{CmsOidPkcs7, CmsOidGm} {
+		for _, detached := range []bool{false, true} {
+			signed, err := CreateSignedData(bytes.NewReader(content), signer.Cert, signer.Pri, &SignedDataOptions{
+				Detached:    detached,
+				Chain:       []*x509.Certificate{ca.Cert},
+				Scheme:      scheme,
+				SigningTime: signingTime,
+			})
+			if err != nil {
+				t.Error(err.Error())
+				return
+			}
+
+			info, err := VerifySignedData(signed, bytes.NewReader(content), roots)
+			if err != nil {
+				t.Error(err.Error())
+				return
+			}
+			if !bytes.Equal(info.Signer.Raw, signer.Cert.Raw) || len(info.Certificates) != 2 {
+				t.Error("签名证书信息错误")
+			}
+			if !info.SigningTime.Equal(signingTime) {
+				t.Errorf("签名时间错误: %s", info.SigningTime)
+			}
+
+			if detached {
+				if info.Content != nil {
+					t.Error("分离式签名不应包含原文")
+				}
+				if _, err = VerifySignedData(signed, nil, nil); err == nil {
+					t.Error("分离式签名未提供原文时应验证失败")
+				}
+			} else {
+				info, err = VerifySignedData(signed, nil, nil)
+				if err != nil {
+					t.Error(err.Error())
+					return
+				}
+				if !bytes.Equal(info.Content, content) {
+					t.Error("签名原文不一致")
+				}
+			}
+
+			tampered := append([]byte{}, content...)
+			tampered[0] ^= 0xff
+			if _, err = VerifySignedData(signed, bytes.NewReader(tampered), nil); err == nil {
+				t.Error("篡改的原文验证通过")
+			}
+			if _, err = VerifySignedData(signed, bytes.NewReader(content), otherRoots); err == nil {
+				t.Error("不受信任的证书链验证通过")
+			}
+		}
+	}
+}
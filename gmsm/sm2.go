@@ -2,11 +2,52 @@ package gmsm
 
 import (
 	"crypto/rand"
+	"encoding/asn1"
 	"errors"
 	"github.com/tjfoc/gmsm/sm2"
+	"math/big"
 )
 
-// Sm2Encrypt Sm2加密
+// Sm2CipherMode sm2密文格式
+type Sm2CipherMode int
+
+const (
+	// Sm2CipherC1C3C2 04 || C1 || C3 || C2 拼接格式(GM/T 0003-2012)
+	Sm2CipherC1C3C2 Sm2CipherMode = iota
+	// Sm2CipherC1C2C3 04 || C1 || C2 || C3 拼接格式(旧版标准, 部分Java实现默认)
+	Sm2CipherC1C2C3
+	// Sm2CipherAsn1 GM/T 0009 定义的ASN.1 DER格式
+	Sm2CipherAsn1
+)
+
+func (m Sm2CipherMode) String() string {
+	switch m {
+	case Sm2CipherC1C3C2:
+		return "C1C3C2"
+	case Sm2CipherC1C2C3:
+		return "C1C2C3"
+	case Sm2CipherAsn1:
+		return "ASN1"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	// sm2CipherC1Len 04 || x || y
+	sm2CipherC1Len = 65
+	sm2CipherC3Len = 32
+)
+
+// sm2Cipher GM/T 0009 SM2Cipher
+type sm2Cipher struct {
+	XCoordinate *big.Int
+	YCoordinate *big.Int
+	Hash        []byte
+	CipherText  []byte
+}
+
+// Sm2Encrypt Sm2加密, 密文为C1C3C2格式
 func Sm2Encrypt(pubKey *sm2.PublicKey, data []byte) ([]byte, error) {
 	encrypt, err := sm2.Encrypt(pubKey, data, rand.Reader)
 	if err != nil {
@@ -15,11 +56,143 @@ func Sm2Encrypt(pubKey *sm2.PublicKey, data []byte) ([]byte, error) {
 	return encrypt, err
 }
 
-// Sm2Decrypt sn2解密
+// Sm2Decrypt sn2解密, 密文为C1C3C2格式
 func Sm2Decrypt(pri *sm2.PrivateKey, data []byte) ([]byte, error) {
+	if len(data) < sm2CipherC1Len+sm2CipherC3Len {
+		return nil, errors.New("解密数据失败")
+	}
 	decrypt, err := sm2.Decrypt(pri, data)
 	if err != nil {
 		return nil, errors.New("解密数据失败")
 	}
 	return decrypt, nil
 }
+
+// Sm2EncryptWithMode Sm2加密并输出指定格式的密文
+func Sm2EncryptWithMode(pubKey *sm2.PublicKey, data []byte, mode Sm2CipherMode) ([]byte, error) {
+	encrypt, err := Sm2Encrypt(pubKey, data)
+	if err != nil {
+		return nil, err
+	}
+	return Sm2CipherConvert(encrypt, Sm2CipherC1C3C2, mode)
+}
+
+// Sm2DecryptWithMode Sm2解密指定格式的密文
+func Sm2DecryptWithMode(pri *sm2.PrivateKey, data []byte, mode Sm2CipherMode) ([]byte, error) {
+	c1c3c2, err := Sm2CipherConvert(data, mode, Sm2CipherC1C3C2)
+	if err != nil {
+		return nil, err
+	}
+	return Sm2Decrypt(pri, c1c3c2)
+}
+
+// Sm2DecryptAuto 自动识别密文格式并解密
+// 拼接格式无法从结构上区分C3的位置, 将依次按C1C3C2、C1C2C3尝试并通过C3校验确认
+func Sm2DecryptAuto(pri *sm2.PrivateKey, data []byte) ([]byte, error) {
+	mode, err := Sm2CipherDetect(data)
+	if err != nil {
+		return nil, err
+	}
+	if mode == Sm2CipherAsn1 {
+		return Sm2DecryptWithMode(pri, data, Sm2CipherAsn1)
+	}
+	if decrypt, err := Sm2DecryptWithMode(pri, data, Sm2CipherC1C3C2); err == nil {
+		return decrypt, nil
+	}
+	return Sm2DecryptWithMode(pri, data, Sm2CipherC1C2C3)
+}
+
+// Sm2CipherDetect 识别密文格式
+// 能完整解析为SM2Cipher结构时返回Sm2CipherAsn1, 否则为拼接格式, 返回Sm2CipherC1C3C2
+func Sm2CipherDetect(data []byte) (Sm2CipherMode, error) {
+	if _, err := parseSm2CipherAsn1(data); err == nil {
+		return Sm2CipherAsn1, nil
+	}
+	if len(data) >= sm2CipherC1Len+sm2CipherC3Len && data[0] == 0x04 {
+		return Sm2CipherC1C3C2, nil
+	}
+	return 0, errors.New("无法识别的sm2密文格式")
+}
+
+// Sm2CipherConvert sm2密文格式转换
+func Sm2CipherConvert(data []byte, from, to Sm2CipherMode) ([]byte, error) {
+	var (
+		c1, c2, c3 []byte
+		err        error
+	)
+
+	switch from {
+	case Sm2CipherC1C3C2, Sm2CipherC1C2C3:
+		if len(data) < sm2CipherC1Len+sm2CipherC3Len || data[0] != 0x04 {
+			return nil, errors.New("sm2密文长度或格式错误")
+		}
+		c1 = data[:sm2CipherC1Len]
+		if from == Sm2CipherC1C3C2 {
+			c3 = data[sm2CipherC1Len : sm2CipherC1Len+sm2CipherC3Len]
+			c2 = data[sm2CipherC1Len+sm2CipherC3Len:]
+		} else {
+			c2 = data[sm2CipherC1Len : len(data)-sm2CipherC3Len]
+			c3 = data[len(data)-sm2CipherC3Len:]
+		}
+	case Sm2CipherAsn1:
+		cipher, err := parseSm2CipherAsn1(data)
+		if err != nil {
+			return nil, err
+		}
+		c1 = make([]byte, 0, sm2CipherC1Len)
+		c1 = append(c1, 0x04)
+		c1 = append(c1, sm2PadInt(cipher.XCoordinate)...)
+		c1 = append(c1, sm2PadInt(cipher.YCoordinate)...)
+		c2 = cipher.CipherText
+		c3 = cipher.Hash
+	default:
+		return nil, errors.New("不支持的sm2密文格式")
+	}
+
+	switch to {
+	case Sm2CipherC1C3C2:
+		return joinBytes(c1, c3, c2), nil
+	case Sm2CipherC1C2C3:
+		return joinBytes(c1, c2, c3), nil
+	case Sm2CipherAsn1:
+		data, err = asn1.Marshal(sm2Cipher{
+			XCoordinate: new(big.Int).SetBytes(c1[1:33]),
+			YCoordinate: new(big.Int).SetBytes(c1[33:]),
+			Hash:        c3,
+			CipherText:  c2,
+		})
+		if err != nil {
+			return nil, errors.New("转换sm2密文到ASN.1格式失败")
+		}
+		return data, nil
+	default:
+		return nil, errors.New("不支持的sm2密文格式")
+	}
+}
+
+func parseSm2CipherAsn1(data []byte) (*sm2Cipher, error) {
+	cipher := &sm2Cipher{}
+	rest, err := asn1.Unmarshal(data, cipher)
+	if err != nil || len(rest) != 0 {
+		return nil, errors.New("解析ASN.1格式sm2密文失败")
+	}
+	if cipher.XCoordinate == nil || cipher.YCoordinate == nil ||
+		cipher.XCoordinate.Sign() < 0 || cipher.YCoordinate.Sign() < 0 ||
+		cipher.XCoordinate.BitLen() > 256 || cipher.YCoordinate.BitLen() > 256 ||
+		len(cipher.Hash) != sm2CipherC3Len {
+		return nil, errors.New("ASN.1格式sm2密文内容错误")
+	}
+	return cipher, nil
+}
+
+func joinBytes(s ...[]byte) []byte {
+	size := 0
+	for _, v := range s {
+		size += len(v)
+	}
+	result := make([]byte, 0, size)
+	for _, v := range s {
+		result = append(result, v...)
+	}
+	return result
+}
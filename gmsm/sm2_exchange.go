@@ -0,0 +1,246 @@
+package gmsm
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"github.com/tjfoc/gmsm/sm2"
+	"github.com/tjfoc/gmsm/sm3"
+	"math/big"
+)
+
+// Sm2DefaultUid sm2默认用户标识
+var Sm2DefaultUid = []byte("1234567812345678")
+
+// Sm2KeyExchange sm2密钥协商(GM/T 0003.3)状态
+//
+// 发起方(A)与响应方(B)的交互流程:
+//
+//	A: ra := a.Init()                   -> 发送ra
+//	B: rb, sb := b.Respond(ra)          -> 发送rb, sb
+//	A: sa := a.Confirm(rb, sb)          -> 发送sa
+//	B: b.Finish(sa)
+//
+// 之后双方通过Key获取相同的会话密钥
+type Sm2KeyExchange struct {
+	initiator bool
+	keyLen    int
+
+	pri     *sm2.PrivateKey
+	peerPub *sm2.PublicKey
+	za      []byte
+	zb      []byte
+
+	ephemeral     *sm2.PrivateKey
+	peerEphemeral *sm2.PublicKey
+
+	key []byte
+	// s2 响应方等待校验的发起方确认值
+	s2       []byte
+	finished bool
+}
+
+// NewSm2KeyExchangeInitiator 创建密钥协商发起方, selfId/peerId为空时使用默认标识, keyLen为协商出的密钥字节长度
+func NewSm2KeyExchangeInitiator(pri *sm2.PrivateKey, peerPub *sm2.PublicKey, selfId, peerId []byte, keyLen int) (*Sm2KeyExchange, error) {
+	return newSm2KeyExchange(true, pri, peerPub, selfId, peerId, keyLen)
+}
+
+// NewSm2KeyExchangeResponder 创建密钥协商响应方, selfId/peerId为空时使用默认标识, keyLen为协商出的密钥字节长度
+func NewSm2KeyExchangeResponder(pri *sm2.PrivateKey, peerPub *sm2.PublicKey, selfId, peerId []byte, keyLen int) (*Sm2KeyExchange, error) {
+	return newSm2KeyExchange(false, pri, peerPub, selfId, peerId, keyLen)
+}
+
+func newSm2KeyExchange(initiator bool, pri *sm2.PrivateKey, peerPub *sm2.PublicKey, selfId, peerId []byte, keyLen int) (*Sm2KeyExchange, error) {
+	if pri == nil || peerPub == nil {
+		return nil, errors.New("协商密钥对不能为空")
+	}
+	if keyLen <= 0 {
+		return nil, errors.New("协商密钥长度必须大于0")
+	}
+	if len(selfId) == 0 {
+		selfId = Sm2DefaultUid
+	}
+	if len(peerId) == 0 {
+		peerId = Sm2DefaultUid
+	}
+
+	selfZ, err := sm2.ZA(&pri.PublicKey, selfId)
+	if err != nil {
+		return nil, errors.New("计算本方标识摘要失败")
+	}
+	peerZ, err := sm2.ZA(peerPub, peerId)
+	if err != nil {
+		return nil, errors.New("计算对方标识摘要失败")
+	}
+
+	e := &Sm2KeyExchange{
+		initiator: initiator,
+		keyLen:    keyLen,
+		pri:       pri,
+		peerPub:   peerPub,
+	}
+	if initiator {
+		e.za, e.zb = selfZ, peerZ
+	} else {
+		e.za, e.zb = peerZ, selfZ
+	}
+	return e, nil
+}
+
+// Init 发起方生成临时公钥RA
+func (e *Sm2KeyExchange) Init() (*sm2.PublicKey, error) {
+	if !e.initiator {
+		return nil, errors.New("只有发起方可以初始化密钥协商")
+	}
+	if e.ephemeral != nil {
+		return nil, errors.New("密钥协商已经初始化")
+	}
+	ephemeral, err := sm2.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, errors.New("生成临时密钥失败")
+	}
+	e.ephemeral = ephemeral
+	return &ephemeral.PublicKey, nil
+}
+
+// Respond 响应方接收发起方临时公钥RA, 返回本方临时公钥RB与确认值SB
+func (e *Sm2KeyExchange) Respond(ra *sm2.PublicKey) (*sm2.PublicKey, []byte, error) {
+	if e.initiator {
+		return nil, nil, errors.New("只有响应方可以响应密钥协商")
+	}
+	if e.ephemeral != nil {
+		return nil, nil, errors.New("密钥协商已经响应")
+	}
+	ephemeral, err := sm2.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, errors.New("生成临时密钥失败")
+	}
+	e.ephemeral = ephemeral
+
+	x, y, err := e.sharedPoint(ra)
+	if err != nil {
+		return nil, nil, err
+	}
+	e.peerEphemeral = ra
+
+	e.key = Sm3Kdf(e.keyLen, x, y, e.za, e.zb)
+	inner := e.confirmDigest(x, ra, &ephemeral.PublicKey)
+	e.s2 = sm2ConfirmHash(0x03, y, inner)
+	return &ephemeral.PublicKey, sm2ConfirmHash(0x02, y, inner), nil
+}
+
+// Confirm 发起方接收响应方临时公钥RB与确认值SB, 校验后返回本方确认值SA
+// sb必须提供, 为空时返回错误, 不会跳过对响应方的校验
+func (e *Sm2KeyExchange) Confirm(rb *sm2.PublicKey, sb []byte) ([]byte, error) {
+	if !e.initiator {
+		return nil, errors.New("只有发起方可以确认密钥协商")
+	}
+	if len(sb) == 0 {
+		return nil, errors.New("响应方确认值不能为空")
+	}
+	if e.ephemeral == nil {
+		return nil, errors.New("密钥协商尚未初始化")
+	}
+	if e.finished {
+		return nil, errors.New("密钥协商已经完成")
+	}
+
+	x, y, err := e.sharedPoint(rb)
+	if err != nil {
+		return nil, err
+	}
+	e.peerEphemeral = rb
+
+	inner := e.confirmDigest(x, &e.ephemeral.PublicKey, rb)
+	s1 := sm2ConfirmHash(0x02, y, inner)
+	if subtle.ConstantTimeCompare(s1, sb) != 1 {
+		return nil, errors.New("响应方确认值校验失败")
+	}
+
+	e.key = Sm3Kdf(e.keyLen, x, y, e.za, e.zb)
+	e.finished = true
+	return sm2ConfirmHash(0x03, y, inner), nil
+}
+
+// Finish 响应方校验发起方确认值SA
+func (e *Sm2KeyExchange) Finish(sa []byte) error {
+	if e.initiator {
+		return errors.New("只有响应方可以结束密钥协商")
+	}
+	if e.s2 == nil {
+		return errors.New("密钥协商尚未响应")
+	}
+	if subtle.ConstantTimeCompare(e.s2, sa) != 1 {
+		return errors.New("发起方确认值校验失败")
+	}
+	e.finished = true
+	return nil
+}
+
+// Key 获取协商出的密钥, 发起方在Confirm后、响应方在Respond后可用
+func (e *Sm2KeyExchange) Key() ([]byte, error) {
+	if e.key == nil {
+		return nil, errors.New("密钥协商尚未完成")
+	}
+	return e.key, nil
+}
+
+// sharedPoint 计算共享点U/V
+func (e *Sm2KeyExchange) sharedPoint(peerEphemeral *sm2.PublicKey) ([]byte, []byte, error) {
+	curve := sm2.P256Sm2()
+	if peerEphemeral == nil || peerEphemeral.X == nil || peerEphemeral.Y == nil ||
+		!curve.IsOnCurve(peerEphemeral.X, peerEphemeral.Y) {
+		return nil, nil, errors.New("对方临时公钥不在曲线上")
+	}
+	n := curve.Params().N
+
+	// t = (d + x̄ * r) mod n
+	t := new(big.Int).Mul(sm2XHat(e.ephemeral.PublicKey.X), e.ephemeral.D)
+	t.Add(t, e.pri.D)
+	t.Mod(t, n)
+
+	// U = [t](P + [x̄]R), 余因子h为1
+	px, py := curve.ScalarMult(peerEphemeral.X, peerEphemeral.Y, sm2XHat(peerEphemeral.X).Bytes())
+	px, py = curve.Add(e.peerPub.X, e.peerPub.Y, px, py)
+	ux, uy := curve.ScalarMult(px, py, t.Bytes())
+	if ux.Sign() == 0 && uy.Sign() == 0 {
+		return nil, nil, errors.New("协商共享点为无穷远点")
+	}
+	return sm2PadInt(ux), sm2PadInt(uy), nil
+}
+
+// confirmDigest 计算 Hash(x || ZA || ZB || x1 || y1 || x2 || y2)
+func (e *Sm2KeyExchange) confirmDigest(x []byte, ra, rb *sm2.PublicKey) []byte {
+	h := sm3.New()
+	h.Write(x)
+	h.Write(e.za)
+	h.Write(e.zb)
+	h.Write(sm2PadInt(ra.X))
+	h.Write(sm2PadInt(ra.Y))
+	h.Write(sm2PadInt(rb.X))
+	h.Write(sm2PadInt(rb.Y))
+	return h.Sum(nil)
+}
+
+func sm2ConfirmHash(prefix byte, y, inner []byte) []byte {
+	h := sm3.New()
+	h.Write([]byte{prefix})
+	h.Write(y)
+	h.Write(inner)
+	return h.Sum(nil)
+}
+
+// sm2XHat 计算 x̄ = 2^w + (x & (2^w - 1)), w = 127
+func sm2XHat(x *big.Int) *big.Int {
+	w := new(big.Int).Lsh(big.NewInt(1), 127)
+	mask := new(big.Int).Sub(w, big.NewInt(1))
+	r := new(big.Int).And(x, mask)
+	return r.Add(r, w)
+}
+
+// sm2PadInt 转换为32字节定长大端序
+func sm2PadInt(i *big.Int) []byte {
+	b := make([]byte, 32)
+	i.FillBytes(b)
+	return b
+}
@@ -0,0 +1,101 @@
+package gmsm
+
+import (
+	"bytes"
+	"github.com/tjfoc/gmsm/sm2"
+	"testing"
+)
+
+func TestSm2KeyExchange(t *testing.T) {
+	priA, err := sm2.GenerateKey(nil)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	priB, err := sm2.GenerateKey(nil)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	for _, keyLen := range []int{16, 32, 48} {
+		a, err := NewSm2KeyExchangeInitiator(priA, &priB.PublicKey, []byte("runner"), []byte("server"), keyLen)
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		b, err := NewSm2KeyExchangeResponder(priB, &priA.PublicKey, []byte("server"), []byte("runner"), keyLen)
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+
+		ra, err := a.Init()
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		rb, sb, err := b.Respond(ra)
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		sa, err := a.Confirm(rb, sb)
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		if err = b.Finish(sa); err != nil {
+			t.Error(err.Error())
+			return
+		}
+
+		keyA, _ := a.Key()
+		keyB, _ := b.Key()
+		if len(keyA) != keyLen || !bytes.Equal(keyA, keyB) {
+			t.Errorf("协商密钥不一致: %x %x", keyA, keyB)
+		}
+
+		sa[0] ^= 0xff
+		if err = b.Finish(sa); err == nil {
+			t.Error("篡改的确认值未被发现")
+		}
+	}
+}
+
+func TestSm2KeyExchangeWrongId(t *testing.T) {
+	priA, _ := sm2.GenerateKey(nil)
+	priB, _ := sm2.GenerateKey(nil)
+
+	a, _ := NewSm2KeyExchangeInitiator(priA, &priB.PublicKey, []byte("a"), []byte("b"), 16)
+	b, _ := NewSm2KeyExchangeResponder(priB, &priA.PublicKey, []byte("b"), []byte("c"), 16)
+	ra, _ := a.Init()
+	rb, sb, err := b.Respond(ra)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if _, err = a.Confirm(rb, sb); err == nil {
+		t.Error("标识不一致时应协商失败")
+	}
+}
+
+func TestSm2KeyExchangeEmptyConfirm(t *testing.T) {
+	priA, _ := sm2.GenerateKey(nil)
+	priB, _ := sm2.GenerateKey(nil)
+
+	a, _ := NewSm2KeyExchangeInitiator(priA, &priB.PublicKey, nil, nil, 16)
+	b, _ := NewSm2KeyExchangeResponder(priB, &priA.PublicKey, nil, nil, 16)
+	ra, _ := a.Init()
+	rb, _, err := b.Respond(ra)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if _, err = a.Confirm(rb, nil); err == nil {
+		t.Error("响应方确认值为空时应当返回错误")
+	}
+	if _, err = a.Key(); err == nil {
+		t.Error("校验失败后不应当得到密钥")
+	}
+}
@@ -0,0 +1,63 @@
+package gmsm
+
+import (
+	"bytes"
+	"github.com/tjfoc/gmsm/sm2"
+	"testing"
+)
+
+func TestSm2CipherMode(t *testing.T) {
+	pri, err := sm2.GenerateKey(nil)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	data := []byte("sm2密文格式转换测试")
+
+	for _, mode := range []Sm2CipherMode{Sm2CipherC1C3C2, Sm2CipherC1C2C3, Sm2CipherAsn1} {
+		encrypt, err := Sm2EncryptWithMode(&pri.PublicKey, data, mode)
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+
+		decrypt, err := Sm2DecryptWithMode(pri, encrypt, mode)
+		if err != nil {
+			t.Error(mode.String() + " => " + err.Error())
+			return
+		}
+		if !bytes.Equal(decrypt, data) {
+			t.Errorf("%s 解密结果不一致", mode)
+		}
+
+		decrypt, err = Sm2DecryptAuto(pri, encrypt)
+		if err != nil {
+			t.Error(mode.String() + " => " + err.Error())
+			return
+		}
+		if !bytes.Equal(decrypt, data) {
+			t.Errorf("%s 自动识别解密结果不一致", mode)
+		}
+
+		for _, to := range []Sm2CipherMode{Sm2CipherC1C3C2, Sm2CipherC1C2C3, Sm2CipherAsn1} {
+			converted, err := Sm2CipherConvert(encrypt, mode, to)
+			if err != nil {
+				t.Error(err.Error())
+				return
+			}
+			back, err := Sm2CipherConvert(converted, to, mode)
+			if err != nil {
+				t.Error(err.Error())
+				return
+			}
+			if !bytes.Equal(back, encrypt) {
+				t.Errorf("%s => %s => %s 转换结果不一致", mode, to, mode)
+			}
+		}
+	}
+
+	detect, err := Sm2CipherDetect([]byte{0x30, 0x01})
+	if err == nil {
+		t.Errorf("错误的密文被识别为 %s", detect)
+	}
+}
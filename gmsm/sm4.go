@@ -1,8 +1,9 @@
 package gmsm
 
 import (
+	"crypto/cipher"
+	"crypto/rand"
 	"errors"
-	"github.com/byzk-org/common-utils/random"
 	"github.com/tjfoc/gmsm/sm4"
 	"io"
 	"os"
@@ -52,7 +53,66 @@ func Sm4Encrypt2File(key []byte, srcFile, destFile *os.File) error {
 
 }
 
-// Sm4RandomKey Sm4随机ke
+// Sm4GenerateKey 使用密码学安全的随机数生成sm4密钥
+func Sm4GenerateKey() ([]byte, error) {
+	key := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, errors.New("生成sm4随机密钥失败 => " + err.Error())
+	}
+	return key, nil
+}
+
+// Sm4RandomKey Sm4随机key, 随机数生成失败时panic, 需要处理错误时使用Sm4GenerateKey
 func Sm4RandomKey() []byte {
-	return []byte(random.GetRandomString(16))[:16]
+	key, err := Sm4GenerateKey()
+	if err != nil {
+		panic(err.Error())
+	}
+	return key
+}
+
+// Sm4CbcEncrypt sm4 CBC模式加密, 使用PKCS#7填充
+func Sm4CbcEncrypt(key, iv, plainText []byte) ([]byte, error) {
+	block, err := sm4.NewCipher(key)
+	if err != nil {
+		return nil, errors.New("创建sm4加密器失败 => " + err.Error())
+	}
+	if len(iv) != block.BlockSize() {
+		return nil, errors.New("sm4初始向量长度错误")
+	}
+	padding := block.BlockSize() - len(plainText)%block.BlockSize()
+	data := make([]byte, len(plainText)+padding)
+	copy(data, plainText)
+	for i := len(plainText); i < len(data); i++ {
+		data[i] = byte(padding)
+	}
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+	return data, nil
+}
+
+// Sm4CbcDecrypt sm4 CBC模式解密, 去除PKCS#7填充
+func Sm4CbcDecrypt(key, iv, cipherText []byte) ([]byte, error) {
+	block, err := sm4.NewCipher(key)
+	if err != nil {
+		return nil, errors.New("创建sm4解密器失败 => " + err.Error())
+	}
+	if len(iv) != block.BlockSize() {
+		return nil, errors.New("sm4初始向量长度错误")
+	}
+	if len(cipherText) == 0 || len(cipherText)%block.BlockSize() != 0 {
+		return nil, errors.New("sm4密文长度错误")
+	}
+	data := make([]byte, len(cipherText))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(data, cipherText)
+
+	padding := int(data[len(data)-1])
+	if padding == 0 || padding > block.BlockSize() {
+		return nil, errors.New("sm4密文填充错误")
+	}
+	for _, v := range data[len(data)-padding:] {
+		if int(v) != padding {
+			return nil, errors.New("sm4密文填充错误")
+		}
+	}
+	return data[:len(data)-padding], nil
 }
@@ -0,0 +1,245 @@
+package gmsm
+
+import (
+	"crypto"
+	"crypto/rand"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"github.com/emmansun/gmsm/sm9"
+	"io"
+)
+
+const (
+	// Sm9HidSign 签名私钥生成函数识别符
+	Sm9HidSign byte = 0x01
+	// Sm9HidEncrypt 加密私钥生成函数识别符
+	Sm9HidEncrypt byte = 0x03
+)
+
+const (
+	sm9SignMasterPublicKeyPemType    = "SM9 SIGN MASTER PUBLIC KEY"
+	sm9EncryptMasterPublicKeyPemType = "SM9 ENC MASTER PUBLIC KEY"
+	sm9SignPrivateKeyPemType         = "SM9 SIGN PRIVATE KEY"
+	sm9EncryptPrivateKeyPemType      = "SM9 ENC PRIVATE KEY"
+)
+
+// Sm9GenerateSignMasterKey 生成sm9签名主密钥
+func Sm9GenerateSignMasterKey() (*sm9.SignMasterPrivateKey, error) {
+	master, err := sm9.GenerateSignMasterKey(rand.Reader)
+	if err != nil {
+		return nil, errors.New("生成sm9签名主密钥失败")
+	}
+	return master, nil
+}
+
+// Sm9GenerateSignUserKey 为用户标识生成sm9签名私钥
+func Sm9GenerateSignUserKey(master *sm9.SignMasterPrivateKey, uid []byte) (*sm9.SignPrivateKey, error) {
+	if master == nil || len(uid) == 0 {
+		return nil, errors.New("sm9主密钥与用户标识不能为空")
+	}
+	pri, err := master.GenerateUserKey(uid, Sm9HidSign)
+	if err != nil {
+		return nil, errors.New("生成sm9签名私钥失败 => " + err.Error())
+	}
+	return pri, nil
+}
+
+// Sm9Sign sm9签名, 签名为ASN.1格式
+func Sm9Sign(pri *sm9.SignPrivateKey, data []byte) ([]byte, error) {
+	if pri == nil {
+		return nil, errors.New("sm9签名私钥不能为空")
+	}
+	sign, err := sm9.SignASN1(rand.Reader, pri, data)
+	if err != nil {
+		return nil, errors.New("sm9签名失败")
+	}
+	return sign, nil
+}
+
+// Sm9Verify 使用签名主公钥与签名者标识验证sm9签名
+func Sm9Verify(pub *sm9.SignMasterPublicKey, uid, data, sign []byte) bool {
+	if pub == nil || len(uid) == 0 {
+		return false
+	}
+	return sm9.VerifyASN1(pub, uid, Sm9HidSign, data, sign)
+}
+
+// Sm9GenerateEncryptMasterKey 生成sm9加密主密钥
+func Sm9GenerateEncryptMasterKey() (*sm9.EncryptMasterPrivateKey, error) {
+	master, err := sm9.GenerateEncryptMasterKey(rand.Reader)
+	if err != nil {
+		return nil, errors.New("生成sm9加密主密钥失败")
+	}
+	return master, nil
+}
+
+// Sm9GenerateEncryptUserKey 为用户标识生成sm9加密私钥
+func Sm9GenerateEncryptUserKey(master *sm9.EncryptMasterPrivateKey, uid []byte) (*sm9.EncryptPrivateKey, error) {
+	if master == nil || len(uid) == 0 {
+		return nil, errors.New("sm9主密钥与用户标识不能为空")
+	}
+	pri, err := master.GenerateUserKey(uid, Sm9HidEncrypt)
+	if err != nil {
+		return nil, errors.New("生成sm9加密私钥失败 => " + err.Error())
+	}
+	return pri, nil
+}
+
+// Sm9Encrypt 使用加密主公钥向用户标识加密, 密文为ASN.1格式
+func Sm9Encrypt(pub *sm9.EncryptMasterPublicKey, uid, data []byte) ([]byte, error) {
+	if pub == nil || len(uid) == 0 {
+		return nil, errors.New("sm9加密主公钥与用户标识不能为空")
+	}
+	encrypt, err := sm9.EncryptASN1(rand.Reader, pub, uid, Sm9HidEncrypt, data)
+	if err != nil {
+		return nil, errors.New("sm9加密数据失败")
+	}
+	return encrypt, nil
+}
+
+// Sm9Decrypt sm9解密ASN.1格式密文, uid为私钥对应的用户标识
+func Sm9Decrypt(pri *sm9.EncryptPrivateKey, uid, data []byte) ([]byte, error) {
+	if pri == nil {
+		return nil, errors.New("sm9加密私钥不能为空")
+	}
+	decrypt, err := sm9.DecryptASN1(pri, uid, data)
+	if err != nil {
+		return nil, errors.New("sm9解密数据失败")
+	}
+	return decrypt, nil
+}
+
+type sm9Encrypter struct {
+	pub *sm9.EncryptMasterPublicKey
+	uid []byte
+}
+
+// NewSm9Encrypter 创建向用户标识加密的sm9加密句柄, 可以代替证书公钥用于数据包加密
+func NewSm9Encrypter(pub *sm9.EncryptMasterPublicKey, uid []byte) Encrypter {
+	return &sm9Encrypter{pub: pub, uid: append([]byte(nil), uid...)}
+}
+
+func (e *sm9Encrypter) Public() crypto.PublicKey {
+	return e.pub
+}
+
+func (e *sm9Encrypter) Encrypt(data []byte) ([]byte, error) {
+	return Sm9Encrypt(e.pub, e.uid, data)
+}
+
+type sm9Decrypter struct {
+	pri *sm9.EncryptPrivateKey
+	uid []byte
+}
+
+// NewSm9Decrypter 创建sm9解密句柄
+func NewSm9Decrypter(pri *sm9.EncryptPrivateKey, uid []byte) Decrypter {
+	return &sm9Decrypter{pri: pri, uid: append([]byte(nil), uid...)}
+}
+
+func (d *sm9Decrypter) Public() crypto.PublicKey {
+	return d.pri.MasterPublic()
+}
+
+func (d *sm9Decrypter) Decrypt(_ io.Reader, msg []byte, _ crypto.DecrypterOpts) ([]byte, error) {
+	return Sm9Decrypt(d.pri, d.uid, msg)
+}
+
+// sm9UserKey 用户私钥与对应的主公钥
+type sm9UserKey struct {
+	PrivateKey      asn1.BitString
+	MasterPublicKey asn1.BitString
+}
+
+func sm9Pem(pemType string, der []byte) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: pemType, Bytes: der}))
+}
+
+func sm9UserKeyPem(pemType string, pri, masterPub []byte) (string, error) {
+	der, err := asn1.Marshal(sm9UserKey{
+		PrivateKey:      asn1.BitString{Bytes: pri, BitLength: len(pri) * 8},
+		MasterPublicKey: asn1.BitString{Bytes: masterPub, BitLength: len(masterPub) * 8},
+	})
+	if err != nil {
+		return "", errors.New("转换sm9私钥失败")
+	}
+	return sm9Pem(pemType, der), nil
+}
+
+func sm9ParsePem(pemType, data string, unmarshal func([]byte) error) error {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil || block.Type != pemType {
+		return errors.New("解析sm9密钥PEM失败")
+	}
+	if err := unmarshal(block.Bytes); err != nil {
+		return errors.New("转换sm9密钥失败 => " + err.Error())
+	}
+	return nil
+}
+
+// Sm9SignMasterPublicKeyPem 转换签名主公钥为PEM
+func Sm9SignMasterPublicKeyPem(pub *sm9.SignMasterPublicKey) (string, error) {
+	der, err := pub.MarshalASN1()
+	if err != nil {
+		return "", errors.New("转换sm9签名主公钥失败")
+	}
+	return sm9Pem(sm9SignMasterPublicKeyPemType, der), nil
+}
+
+// ParseSm9SignMasterPublicKeyPem 解析PEM格式的签名主公钥
+func ParseSm9SignMasterPublicKeyPem(data string) (*sm9.SignMasterPublicKey, error) {
+	pub := &sm9.SignMasterPublicKey{}
+	if err := sm9ParsePem(sm9SignMasterPublicKeyPemType, data, pub.UnmarshalASN1); err != nil {
+		return nil, err
+	}
+	return pub, nil
+}
+
+// Sm9EncryptMasterPublicKeyPem 转换加密主公钥为PEM
+func Sm9EncryptMasterPublicKeyPem(pub *sm9.EncryptMasterPublicKey) (string, error) {
+	der, err := pub.MarshalASN1()
+	if err != nil {
+		return "", errors.New("转换sm9加密主公钥失败")
+	}
+	return sm9Pem(sm9EncryptMasterPublicKeyPemType, der), nil
+}
+
+// ParseSm9EncryptMasterPublicKeyPem 解析PEM格式的加密主公钥
+func ParseSm9EncryptMasterPublicKeyPem(data string) (*sm9.EncryptMasterPublicKey, error) {
+	pub := &sm9.EncryptMasterPublicKey{}
+	if err := sm9ParsePem(sm9EncryptMasterPublicKeyPemType, data, pub.UnmarshalASN1); err != nil {
+		return nil, err
+	}
+	return pub, nil
+}
+
+// Sm9SignPrivateKeyPem 转换用户签名私钥为PEM, 同时包含对应的签名主公钥
+func Sm9SignPrivateKeyPem(pri *sm9.SignPrivateKey) (string, error) {
+	return sm9UserKeyPem(sm9SignPrivateKeyPemType, pri.PrivateKey.MarshalUncompressed(),
+		pri.MasterPublic().MasterPublicKey.MarshalUncompressed())
+}
+
+// ParseSm9SignPrivateKeyPem 解析PEM格式的用户签名私钥
+func ParseSm9SignPrivateKeyPem(data string) (*sm9.SignPrivateKey, error) {
+	pri := &sm9.SignPrivateKey{}
+	if err := sm9ParsePem(sm9SignPrivateKeyPemType, data, pri.UnmarshalASN1); err != nil {
+		return nil, err
+	}
+	return pri, nil
+}
+
+// Sm9EncryptPrivateKeyPem 转换用户加密私钥为PEM, 同时包含对应的加密主公钥
+func Sm9EncryptPrivateKeyPem(pri *sm9.EncryptPrivateKey) (string, error) {
+	return sm9UserKeyPem(sm9EncryptPrivateKeyPemType, pri.PrivateKey.MarshalUncompressed(),
+		pri.MasterPublic().MasterPublicKey.MarshalUncompressed())
+}
+
+// ParseSm9EncryptPrivateKeyPem 解析PEM格式的用户加密私钥
+func ParseSm9EncryptPrivateKeyPem(data string) (*sm9.EncryptPrivateKey, error) {
+	pri := &sm9.EncryptPrivateKey{}
+	if err := sm9ParsePem(sm9EncryptPrivateKeyPemType, data, pri.UnmarshalASN1); err != nil {
+		return nil, err
+	}
+	return pri, nil
+}
@@ -0,0 +1,110 @@
+package gmsm
+
+import (
+	"testing"
+)
+
+func TestSm9Sign(t *testing.T) {
+	master, err := Sm9GenerateSignMasterKey()
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	uid := []byte("alice@byzk.org")
+	pri, err := Sm9GenerateSignUserKey(master, uid)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	priPem, err := Sm9SignPrivateKeyPem(pri)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if pri, err = ParseSm9SignPrivateKeyPem(priPem); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	pubPem, err := Sm9SignMasterPublicKeyPem(master.Public())
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	pub, err := ParseSm9SignMasterPublicKeyPem(pubPem)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	data := []byte("sm9 sign data")
+	sign, err := Sm9Sign(pri, data)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if !Sm9Verify(pub, uid, data, sign) {
+		t.Error("sm9验签失败")
+	}
+	if Sm9Verify(pub, []byte("bob@byzk.org"), data, sign) {
+		t.Error("错误的用户标识不应当验签通过")
+	}
+	if Sm9Verify(pub, uid, []byte("other data"), sign) {
+		t.Error("被修改的数据不应当验签通过")
+	}
+}
+
+func TestSm9Encrypt(t *testing.T) {
+	master, err := Sm9GenerateEncryptMasterKey()
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	uid := []byte("alice@byzk.org")
+	pri, err := Sm9GenerateEncryptUserKey(master, uid)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	priPem, err := Sm9EncryptPrivateKeyPem(pri)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if pri, err = ParseSm9EncryptPrivateKeyPem(priPem); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	pubPem, err := Sm9EncryptMasterPublicKeyPem(master.Public())
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	pub, err := ParseSm9EncryptMasterPublicKeyPem(pubPem)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	var encrypter Encrypter = NewSm9Encrypter(pub, uid)
+	encrypt, err := encrypter.Encrypt([]byte("sm9 encrypt data"))
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	decrypt, err := NewSm9Decrypter(pri, uid).Decrypt(nil, encrypt, nil)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if string(decrypt) != "sm9 encrypt data" {
+		t.Error("sm9解密结果不一致")
+	}
+	if _, err = Sm9Decrypt(pri, []byte("bob@byzk.org"), encrypt); err == nil {
+		t.Error("错误的用户标识不应当解密成功")
+	}
+	if _, err = ParseSm9EncryptPrivateKeyPem(pubPem); err == nil {
+		t.Error("错误的PEM类型应当解析失败")
+	}
+}
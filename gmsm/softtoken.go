@@ -0,0 +1,307 @@
+package gmsm
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"github.com/byzk-org/common-utils/commonutils"
+	"github.com/tjfoc/gmsm/sm2"
+	"github.com/tjfoc/gmsm/x509"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	softTokenInfoFile = ".token"
+	softTokenSm2Ext   = ".sm2"
+	softTokenSm4Ext   = ".sm4"
+	softTokenPinIter  = 10000
+	// softTokenVersion 令牌格式版本, 口令密钥使用PBKDF2-SM3派生
+	softTokenVersion = "1"
+)
+
+// SoftToken 基于目录的软件令牌, 模拟密码卡的按标签存取密钥
+// sm2私钥以口令加密的PKCS#8 PEM保存, sm4密钥以口令派生密钥加密保存, 每个密钥一个文件
+type SoftToken struct {
+	dir string
+	pin *commonutils.Secret
+}
+
+// OpenSoftToken 打开软件令牌目录, 目录不存在时创建并以pin初始化, 已存在时校验pin
+func OpenSoftToken(dir, pin string) (*SoftToken, error) {
+	if pin == "" {
+		return nil, errors.New("软件令牌口令不能为空")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.New("创建软件令牌目录失败")
+	}
+
+	t := &SoftToken{dir: dir, pin: commonutils.NewSecretFromString(pin)}
+	infoPath := filepath.Join(dir, softTokenInfoFile)
+	data, err := ioutil.ReadFile(infoPath)
+	if os.IsNotExist(err) {
+		salt := make([]byte, 16)
+		if _, err = io.ReadFull(rand.Reader, salt); err != nil {
+			return nil, errors.New("生成软件令牌盐值失败")
+		}
+		check, err := t.pinCheck(salt)
+		if err != nil {
+			return nil, err
+		}
+		block := &pem.Block{
+			Type:    "SOFT TOKEN",
+			Headers: map[string]string{"Salt": hex.EncodeToString(salt), "Version": softTokenVersion},
+			Bytes:   check,
+		}
+		if err = ioutil.WriteFile(infoPath, pem.EncodeToMemory(block), 0600); err != nil {
+			return nil, errors.New("写出软件令牌信息失败")
+		}
+		return t, nil
+	}
+	if err != nil {
+		return nil, errors.New("读取软件令牌信息失败")
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "SOFT TOKEN" {
+		return nil, errors.New("软件令牌信息格式错误")
+	}
+	salt, err := hex.DecodeString(block.Headers["Salt"])
+	if err != nil {
+		return nil, errors.New("软件令牌信息格式错误")
+	}
+	if block.Headers["Version"] != softTokenVersion {
+		return nil, errors.New("不支持的软件令牌版本")
+	}
+	check, err := t.pinCheck(salt)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare(check, block.Bytes) != 1 {
+		return nil, errors.New("软件令牌口令错误")
+	}
+	return t, nil
+}
+
+func (t *SoftToken) pinCheck(salt []byte) ([]byte, error) {
+	return t.pinKey(salt, 32)
+}
+
+// pinKey 使用PBKDF2-SM3从口令派生密钥
+func (t *SoftToken) pinKey(salt []byte, size int) ([]byte, error) {
+	key, err := Pbkdf2(KdfHashSm3, t.pin.Bytes(), salt, softTokenPinIter, size)
+	if err != nil {
+		return nil, errors.New("派生口令密钥失败 => " + err.Error())
+	}
+	return key, nil
+}
+
+func (t *SoftToken) Name() string {
+	return "softtoken:" + t.dir
+}
+
+// Close 关闭软件令牌并清零内存中的口令
+func (t *SoftToken) Close() error {
+	return t.pin.Close()
+}
+
+func (t *SoftToken) keyPath(label, ext string) (string, error) {
+	if t.pin.Closed() {
+		return "", errors.New("软件令牌已关闭")
+	}
+	if label == "" || strings.HasPrefix(label, ".") || strings.ContainsAny(label, `/\:`) {
+		return "", errors.New("密钥标签格式错误 => " + label)
+	}
+	return filepath.Join(t.dir, label+ext), nil
+}
+
+// ImportSm2Key 导入sm2私钥
+func (t *SoftToken) ImportSm2Key(label string, pri *sm2.PrivateKey) error {
+	if pri == nil {
+		return errors.New("私钥不能为空")
+	}
+	path, err := t.keyPath(label, softTokenSm2Ext)
+	if err != nil {
+		return err
+	}
+	data, err := x509.WritePrivateKeyToPem(pri, t.pin.Bytes())
+	if err != nil {
+		return errors.New("转换sm2私钥失败")
+	}
+	if err = ioutil.WriteFile(path, data, 0600); err != nil {
+		return errors.New("写出sm2私钥失败")
+	}
+	return nil
+}
+
+// GenerateSm2Key 生成sm2私钥并保存
+func (t *SoftToken) GenerateSm2Key(label string) (*sm2.PublicKey, error) {
+	pri, err := sm2.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, errors.New("生成sm2私钥失败")
+	}
+	if err = t.ImportSm2Key(label, pri); err != nil {
+		return nil, err
+	}
+	return &pri.PublicKey, nil
+}
+
+// ImportSm4Key 导入sm4密钥
+func (t *SoftToken) ImportSm4Key(label string, key []byte) error {
+	if len(key) != 16 {
+		return errors.New("sm4密钥长度必须为16字节")
+	}
+	path, err := t.keyPath(label, softTokenSm4Ext)
+	if err != nil {
+		return err
+	}
+
+	salt := make([]byte, 16)
+	if _, err = io.ReadFull(rand.Reader, salt); err != nil {
+		return errors.New("生成盐值失败")
+	}
+	pinKey, err := t.pinKey(salt, 16)
+	if err != nil {
+		return err
+	}
+	encrypt, err := (&softSymmetricKey{key: pinKey}).Encrypt(key)
+	if err != nil {
+		return err
+	}
+	block := &pem.Block{
+		Type:    "ENCRYPTED SM4 KEY",
+		Headers: map[string]string{"Salt": hex.EncodeToString(salt)},
+		Bytes:   encrypt,
+	}
+	if err = ioutil.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		return errors.New("写出sm4密钥失败")
+	}
+	return nil
+}
+
+// GenerateSm4Key 生成sm4密钥并保存
+func (t *SoftToken) GenerateSm4Key(label string) error {
+	key := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return errors.New("生成sm4密钥失败")
+	}
+	return t.ImportSm4Key(label, key)
+}
+
+// Remove 删除密钥
+func (t *SoftToken) Remove(label string) error {
+	for _, ext := range []string{softTokenSm2Ext, softTokenSm4Ext} {
+		path, err := t.keyPath(label, ext)
+		if err != nil {
+			return err
+		}
+		if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return errors.New("删除密钥失败 => " + label)
+		}
+	}
+	return nil
+}
+
+func (t *SoftToken) Labels() ([]string, error) {
+	infos, err := ioutil.ReadDir(t.dir)
+	if err != nil {
+		return nil, errors.New("读取软件令牌目录失败")
+	}
+	exists := make(map[string]bool)
+	labels := make([]string, 0, len(infos))
+	for _, info := range infos {
+		name := info.Name()
+		ext := filepath.Ext(name)
+		if info.IsDir() || (ext != softTokenSm2Ext && ext != softTokenSm4Ext) {
+			continue
+		}
+		label := strings.TrimSuffix(name, ext)
+		if !exists[label] {
+			exists[label] = true
+			labels = append(labels, label)
+		}
+	}
+	sort.Strings(labels)
+	return labels, nil
+}
+
+func (t *SoftToken) sm2Key(label string) (*sm2.PrivateKey, error) {
+	path, err := t.keyPath(label, softTokenSm2Ext)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, errors.New("读取sm2私钥失败")
+	}
+	pri, err := x509.ReadPrivateKeyFromPem(data, t.pin.Bytes())
+	if err != nil {
+		return nil, errors.New("解析sm2私钥失败")
+	}
+	return pri, nil
+}
+
+func (t *SoftToken) Signer(label string) (Signer, error) {
+	pri, err := t.sm2Key(label)
+	if err != nil {
+		return nil, err
+	}
+	return pri, nil
+}
+
+func (t *SoftToken) Decrypter(label string) (Decrypter, error) {
+	pri, err := t.sm2Key(label)
+	if err != nil {
+		return nil, err
+	}
+	return pri, nil
+}
+
+func (t *SoftToken) Encrypter(label string) (Encrypter, error) {
+	pri, err := t.sm2Key(label)
+	if err != nil {
+		return nil, err
+	}
+	return NewSm2Encrypter(&pri.PublicKey), nil
+}
+
+func (t *SoftToken) SymmetricKey(label string) (SymmetricKey, error) {
+	path, err := t.keyPath(label, softTokenSm4Ext)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, errors.New("读取sm4密钥失败")
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "ENCRYPTED SM4 KEY" {
+		return nil, errors.New("sm4密钥文件格式错误")
+	}
+	salt, err := hex.DecodeString(block.Headers["Salt"])
+	if err != nil {
+		return nil, errors.New("sm4密钥文件格式错误")
+	}
+	pinKey, err := t.pinKey(salt, 16)
+	if err != nil {
+		return nil, err
+	}
+	key, err := (&softSymmetricKey{key: pinKey}).Decrypt(block.Bytes)
+	if err != nil {
+		return nil, errors.New("解密sm4密钥失败")
+	}
+	return &softSymmetricKey{label: label, key: key}, nil
+}
@@ -0,0 +1,398 @@
+package gmsm
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+)
+
+const (
+	zucEncDataLen = 1024 * 1024
+)
+
+var zucS0 = [256]byte{
+	0x3e, 0x72, 0x5b, 0x47, 0xca, 0xe0, 0x00, 0x33, 0x04, 0xd1, 0x54, 0x98, 0x09, 0xb9, 0x6d, 0xcb,
+	0x7b, 0x1b, 0xf9, 0x32, 0xaf, 0x9d, 0x6a, 0xa5, 0xb8, 0x2d, 0xfc, 0x1d, 0x08, 0x53, 0x03, 0x90,
+	0x4d, 0x4e, 0x84, 0x99, 0xe4, 0xce, 0xd9, 0x91, 0xdd, 0xb6, 0x85, 0x48, 0x8b, 0x29, 0x6e, 0xac,
+	0xcd, 0xc1, 0xf8, 0x1e, 0x73, 0x43, 0x69, 0xc6, 0xb5, 0xbd, 0xfd, 0x39, 0x63, 0x20, 0xd4, 0x38,
+	0x76, 0x7d, 0xb2, 0xa7, 0xcf, 0xed, 0x57, 0xc5, 0xf3, 0x2c, 0xbb, 0x14, 0x21, 0x06, 0x55, 0x9b,
+	0xe3, 0xef, 0x5e, 0x31, 0x4f, 0x7f, 0x5a, 0xa4, 0x0d, 0x82, 0x51, 0x49, 0x5f, 0xba, 0x58, 0x1c,
+	0x4a, 0x16, 0xd5, 0x17, 0xa8, 0x92, 0x24, 0x1f, 0x8c, 0xff, 0xd8, 0xae, 0x2e, 0x01, 0xd3, 0xad,
+	0x3b, 0x4b, 0xda, 0x46, 0xeb, 0xc9, 0xde, 0x9a, 0x8f, 0x87, 0xd7, 0x3a, 0x80, 0x6f, 0x2f, 0xc8,
+	0xb1, 0xb4, 0x37, 0xf7, 0x0a, 0x22, 0x13, 0x28, 0x7c, 0xcc, 0x3c, 0x89, 0xc7, 0xc3, 0x96, 0x56,
+	0x07, 0xbf, 0x7e, 0xf0, 0x0b, 0x2b, 0x97, 0x52, 0x35, 0x41, 0x79, 0x61, 0xa6, 0x4c, 0x10, 0xfe,
+	0xbc, 0x26, 0x95, 0x88, 0x8a, 0xb0, 0xa3, 0xfb, 0xc0, 0x18, 0x94, 0xf2, 0xe1, 0xe5, 0xe9, 0x5d,
+	0xd0, 0xdc, 0x11, 0x66, 0x64, 0x5c, 0xec, 0x59, 0x42, 0x75, 0x12, 0xf5, 0x74, 0x9c, 0xaa, 0x23,
+	0x0e, 0x86, 0xab, 0xbe, 0x2a, 0x02, 0xe7, 0x67, 0xe6, 0x44, 0xa2, 0x6c, 0xc2, 0x93, 0x9f, 0xf1,
+	0xf6, 0xfa, 0x36, 0xd2, 0x50, 0x68, 0x9e, 0x62, 0x71, 0x15, 0x3d, 0xd6, 0x40, 0xc4, 0xe2, 0x0f,
+	0x8e, 0x83, 0x77, 0x6b, 0x25, 0x05, 0x3f, 0x0c, 0x30, 0xea, 0x70, 0xb7, 0xa1, 0xe8, 0xa9, 0x65,
+	0x8d, 0x27, 0x1a, 0xdb, 0x81, 0xb3, 0xa0, 0xf4, 0x45, 0x7a, 0x19, 0xdf, 0xee, 0x78, 0x34, 0x60,
+}
+
+var zucS1 = [256]byte{
+	0x55, 0xc2, 0x63, 0x71, 0x3b, 0xc8, 0x47, 0x86, 0x9f, 0x3c, 0xda, 0x5b, 0x29, 0xaa, 0xfd, 0x77,
+	0x8c, 0xc5, 0x94, 0x0c, 0xa6, 0x1a, 0x13, 0x00, 0xe3, 0xa8, 0x16, 0x72, 0x40, 0xf9, 0xf8, 0x42,
+	0x44, 0x26, 0x68, 0x96, 0x81, 0xd9, 0x45, 0x3e, 0x10, 0x76, 0xc6, 0xa7, 0x8b, 0x39, 0x43, 0xe1,
+	0x3a, 0xb5, 0x56, 0x2a, 0xc0, 0x6d, 0xb3, 0x05, 0x22, 0x66, 0xbf, 0xdc, 0x0b, 0xfa, 0x62, 0x48,
+	0xdd, 0x20, 0x11, 0x06, 0x36, 0xc9, 0xc1, 0xcf, 0xf6, 0x27, 0x52, 0xbb, 0x69, 0xf5, 0xd4, 0x87,
+	0x7f, 0x84, 0x4c, 0xd2, 0x9c, 0x57, 0xa4, 0xbc, 0x4f, 0x9a, 0xdf, 0xfe, 0xd6, 0x8d, 0x7a, 0xeb,
+	0x2b, 0x53, 0xd8, 0x5c, 0xa1, 0x14, 0x17, 0xfb, 0x23, 0xd5, 0x7d, 0x30, 0x67, 0x73, 0x08, 0x09,
+	0xee, 0xb7, 0x70, 0x3f, 0x61, 0xb2, 0x19, 0x8e, 0x4e, 0xe5, 0x4b, 0x93, 0x8f, 0x5d, 0xdb, 0xa9,
+	0xad, 0xf1, 0xae, 0x2e, 0xcb, 0x0d, 0xfc, 0xf4, 0x2d, 0x46, 0x6e, 0x1d, 0x97, 0xe8, 0xd1, 0xe9,
+	0x4d, 0x37, 0xa5, 0x75, 0x5e, 0x83, 0x9e, 0xab, 0x82, 0x9d, 0xb9, 0x1c, 0xe0, 0xcd, 0x49, 0x89,
+	0x01, 0xb6, 0xbd, 0x58, 0x24, 0xa2, 0x5f, 0x38, 0x78, 0x99, 0x15, 0x90, 0x50, 0xb8, 0x95, 0xe4,
+	0xd0, 0x91, 0xc7, 0xce, 0xed, 0x0f, 0xb4, 0x6f, 0xa0, 0xcc, 0xf0, 0x02, 0x4a, 0x79, 0xc3, 0xde,
+	0xa3, 0xef, 0xea, 0x51, 0xe6, 0x6b, 0x18, 0xec, 0x1b, 0x2c, 0x80, 0xf7, 0x74, 0xe7, 0xff, 0x21,
+	0x5a, 0x6a, 0x54, 0x1e, 0x41, 0x31, 0x92, 0x35, 0xc4, 0x33, 0x07, 0x0a, 0xba, 0x7e, 0x0e, 0x34,
+	0x88, 0xb1, 0x98, 0x7c, 0xf3, 0x3d, 0x60, 0x6c, 0x7b, 0xca, 0xd3, 0x1f, 0x32, 0x65, 0x04, 0x28,
+	0x64, 0xbe, 0x85, 0x9b, 0x2f, 0x59, 0x8a, 0xd7, 0xb0, 0x25, 0xac, 0xaf, 0x12, 0x03, 0xe2, 0xf2,
+}
+
+// zucD128 ZUC-128 密钥装入常量
+var zucD128 = [16]uint32{
+	0x44d7, 0x26bc, 0x626b, 0x135e, 0x5789, 0x35e2, 0x7135, 0x09af,
+	0x4d78, 0x2f13, 0x6bc4, 0x1af1, 0x5e26, 0x3c4d, 0x789a, 0x47ac,
+}
+
+// zucD256 ZUC-256 密钥流生成使用的装入常量
+var zucD256 = [16]uint32{
+	0x22, 0x2f, 0x24, 0x2a, 0x6d, 0x40, 0x40, 0x40,
+	0x40, 0x40, 0x40, 0x40, 0x40, 0x52, 0x10, 0x30,
+}
+
+type zucState struct {
+	lfsr           [16]uint32
+	r1, r2         uint32
+	x0, x1, x2, x3 uint32
+}
+
+// newZucState 初始化ZUC状态
+// 16字节密钥为ZUC-128, iv为16字节;
+// 32字节密钥为ZUC-256, iv为25字节(后8字节各取低6位)或将后8个6位值紧凑排列的23字节
+func newZucState(key, iv []byte) (*zucState, error) {
+	s := &zucState{}
+	switch len(key) {
+	case 16:
+		if len(iv) != 16 {
+			return nil, errors.New("ZUC-128初始向量长度必须为16字节")
+		}
+		for i := 0; i < 16; i++ {
+			s.lfsr[i] = uint32(key[i])<<23 | zucD128[i]<<8 | uint32(iv[i])
+		}
+	case 32:
+		var iv6 [8]uint32
+		switch len(iv) {
+		case 25:
+			for i := 0; i < 8; i++ {
+				iv6[i] = uint32(iv[17+i] & 0x3f)
+			}
+		case 23:
+			iv6[0] = uint32(iv[17] >> 2)
+			iv6[1] = uint32((iv[17]&0x03)<<4 | iv[18]>>4)
+			iv6[2] = uint32((iv[18]&0x0f)<<2 | iv[19]>>6)
+			iv6[3] = uint32(iv[19] & 0x3f)
+			iv6[4] = uint32(iv[20] >> 2)
+			iv6[5] = uint32((iv[20]&0x03)<<4 | iv[21]>>4)
+			iv6[6] = uint32((iv[21]&0x0f)<<2 | iv[22]>>6)
+			iv6[7] = uint32(iv[22] & 0x3f)
+		default:
+			return nil, errors.New("ZUC-256初始向量长度必须为25或23字节")
+		}
+		s.loadKey256(key, iv, iv6)
+	default:
+		return nil, errors.New("ZUC密钥长度必须为16或32字节")
+	}
+
+	for i := 0; i < 32; i++ {
+		s.bitReorganization()
+		w := s.f()
+		s.lfsrInit(w >> 1)
+	}
+	s.bitReorganization()
+	s.f()
+	s.lfsrWork()
+	return s, nil
+}
+
+func (s *zucState) loadKey256(k, iv []byte, iv6 [8]uint32) {
+	d := zucD256
+	cell := func(a, b, c, e uint32) uint32 {
+		return a<<23 | b<<16 | c<<8 | e
+	}
+	u := func(b byte) uint32 {
+		return uint32(b)
+	}
+	s.lfsr[0] = cell(u(k[0]), d[0], u(k[21]), u(k[16]))
+	s.lfsr[1] = cell(u(k[1]), d[1], u(k[22]), u(k[17]))
+	s.lfsr[2] = cell(u(k[2]), d[2], u(k[23]), u(k[18]))
+	s.lfsr[3] = cell(u(k[3]), d[3], u(k[24]), u(k[19]))
+	s.lfsr[4] = cell(u(k[4]), d[4], u(k[25]), u(k[20]))
+	s.lfsr[5] = cell(u(iv[0]), d[5]|iv6[0], u(k[5]), u(k[26]))
+	s.lfsr[6] = cell(u(iv[1]), d[6]|iv6[1], u(k[6]), u(k[27]))
+	s.lfsr[7] = cell(u(iv[10]), d[7]|iv6[2], u(k[7]), u(iv[2]))
+	s.lfsr[8] = cell(u(k[8]), d[8]|iv6[3], u(iv[3]), u(iv[11]))
+	s.lfsr[9] = cell(u(k[9]), d[9]|iv6[4], u(iv[12]), u(iv[4]))
+	s.lfsr[10] = cell(u(iv[5]), d[10]|iv6[5], u(k[10]), u(k[28]))
+	s.lfsr[11] = cell(u(k[11]), d[11]|iv6[6], u(iv[6]), u(iv[13]))
+	s.lfsr[12] = cell(u(k[12]), d[12]|iv6[7], u(iv[7]), u(iv[14]))
+	s.lfsr[13] = cell(u(k[13]), d[13], u(iv[15]), u(iv[8]))
+	s.lfsr[14] = cell(u(k[14]), d[14]|u(k[31]>>4), u(iv[16]), u(iv[9]))
+	s.lfsr[15] = cell(u(k[15]), d[15]|u(k[31]&0x0f), u(k[30]), u(k[29]))
+}
+
+func (s *zucState) bitReorganization() {
+	s.x0 = (s.lfsr[15]&0x7fff8000)<<1 | s.lfsr[14]&0xffff
+	s.x1 = (s.lfsr[11]&0xffff)<<16 | s.lfsr[9]>>15
+	s.x2 = (s.lfsr[7]&0xffff)<<16 | s.lfsr[5]>>15
+	s.x3 = (s.lfsr[2]&0xffff)<<16 | s.lfsr[0]>>15
+}
+
+func zucRotl32(x uint32, k uint) uint32 {
+	return x<<k | x>>(32-k)
+}
+
+func zucL1(x uint32) uint32 {
+	return x ^ zucRotl32(x, 2) ^ zucRotl32(x, 10) ^ zucRotl32(x, 18) ^ zucRotl32(x, 24)
+}
+
+func zucL2(x uint32) uint32 {
+	return x ^ zucRotl32(x, 8) ^ zucRotl32(x, 14) ^ zucRotl32(x, 22) ^ zucRotl32(x, 30)
+}
+
+func zucSbox(x uint32) uint32 {
+	return uint32(zucS0[x>>24])<<24 | uint32(zucS1[x>>16&0xff])<<16 |
+		uint32(zucS0[x>>8&0xff])<<8 | uint32(zucS1[x&0xff])
+}
+
+func (s *zucState) f() uint32 {
+	w := (s.x0 ^ s.r1) + s.r2
+	w1 := s.r1 + s.x1
+	w2 := s.r2 ^ s.x2
+	s.r1 = zucSbox(zucL1(w1<<16 | w2>>16))
+	s.r2 = zucSbox(zucL2(w2<<16 | w1>>16))
+	return w
+}
+
+// zucAdd31 模 2^31-1 加法
+func zucAdd31(a, b uint32) uint32 {
+	c := a + b
+	return (c & 0x7fffffff) + (c >> 31)
+}
+
+// zucRotl31 模 2^31-1 下乘以 2^k
+func zucRotl31(x uint32, k uint) uint32 {
+	return (x<<k | x>>(31-k)) & 0x7fffffff
+}
+
+func (s *zucState) lfsrFeedback() uint32 {
+	v := s.lfsr[0]
+	v = zucAdd31(v, zucRotl31(s.lfsr[0], 8))
+	v = zucAdd31(v, zucRotl31(s.lfsr[4], 20))
+	v = zucAdd31(v, zucRotl31(s.lfsr[10], 21))
+	v = zucAdd31(v, zucRotl31(s.lfsr[13], 17))
+	v = zucAdd31(v, zucRotl31(s.lfsr[15], 15))
+	return v
+}
+
+func (s *zucState) lfsrShift(v uint32) {
+	if v == 0 {
+		v = 0x7fffffff
+	}
+	copy(s.lfsr[:15], s.lfsr[1:])
+	s.lfsr[15] = v
+}
+
+func (s *zucState) lfsrInit(u uint32) {
+	s.lfsrShift(zucAdd31(s.lfsrFeedback(), u))
+}
+
+func (s *zucState) lfsrWork() {
+	s.lfsrShift(s.lfsrFeedback())
+}
+
+// next 输出一个32位密钥字
+func (s *zucState) next() uint32 {
+	s.bitReorganization()
+	z := s.f() ^ s.x3
+	s.lfsrWork()
+	return z
+}
+
+func (s *zucState) words(n int) []uint32 {
+	result := make([]uint32, n)
+	for i := range result {
+		result[i] = s.next()
+	}
+	return result
+}
+
+// zucStream ZUC序列密码, 实现cipher.Stream
+type zucStream struct {
+	state  *zucState
+	buf    [4]byte
+	bufLen int
+}
+
+// NewZucCipher 创建ZUC序列密码, 16字节密钥为ZUC-128, 32字节密钥为ZUC-256
+func NewZucCipher(key, iv []byte) (cipher.Stream, error) {
+	state, err := newZucState(key, iv)
+	if err != nil {
+		return nil, err
+	}
+	return &zucStream{state: state}, nil
+}
+
+func (z *zucStream) XORKeyStream(dst, src []byte) {
+	if len(dst) < len(src) {
+		panic("gmsm: zuc output smaller than input")
+	}
+	for i := 0; i < len(src); i++ {
+		if z.bufLen == 0 {
+			binary.BigEndian.PutUint32(z.buf[:], z.state.next())
+			z.bufLen = 4
+		}
+		dst[i] = src[i] ^ z.buf[4-z.bufLen]
+		z.bufLen--
+	}
+}
+
+// ZucKeyStream 生成指定字节长度的ZUC密钥流
+func ZucKeyStream(key, iv []byte, size int) ([]byte, error) {
+	stream, err := NewZucCipher(key, iv)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]byte, size)
+	stream.XORKeyStream(result, result)
+	return result, nil
+}
+
+// ZucEncrypt ZUC加密
+func ZucEncrypt(key, iv, plainText []byte) ([]byte, error) {
+	stream, err := NewZucCipher(key, iv)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]byte, len(plainText))
+	stream.XORKeyStream(result, plainText)
+	return result, nil
+}
+
+// ZucDecrypt ZUC解密
+func ZucDecrypt(key, iv, cipherText []byte) ([]byte, error) {
+	return ZucEncrypt(key, iv, cipherText)
+}
+
+// ZucEncrypt2File 加密ZUC到文件
+func ZucEncrypt2File(key, iv []byte, srcFile, destFile *os.File) error {
+	stream, err := NewZucCipher(key, iv)
+	if err != nil {
+		return err
+	}
+	return zucCopy(stream, srcFile, destFile)
+}
+
+// ZucDecrypt2File 解密ZUC到文件
+func ZucDecrypt2File(key, iv []byte, srcFile, destFile *os.File) error {
+	return ZucEncrypt2File(key, iv, srcFile, destFile)
+}
+
+// ZucEncryptStream 以流的方式加/解密, 将src的内容加密后写入dst
+func ZucEncryptStream(key, iv []byte, dst io.Writer, src io.Reader) error {
+	stream, err := NewZucCipher(key, iv)
+	if err != nil {
+		return err
+	}
+	return zucCopy(stream, src, dst)
+}
+
+func zucCopy(stream cipher.Stream, src io.Reader, dst io.Writer) error {
+	tmpBuffer := make([]byte, zucEncDataLen)
+	for {
+		s, err := src.Read(tmpBuffer)
+		if s > 0 {
+			stream.XORKeyStream(tmpBuffer[:s], tmpBuffer[:s])
+			if _, werr := dst.Write(tmpBuffer[:s]); werr != nil {
+				return errors.New("写出文件失败")
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.New("读取文件内容失败")
+		}
+	}
+}
+
+// zucEea3Iv 构造128-EEA3初始向量
+func zucEea3Iv(count, bearer, direction uint32) []byte {
+	iv := make([]byte, 16)
+	binary.BigEndian.PutUint32(iv, count)
+	iv[4] = byte(bearer<<3 | (direction&1)<<2)
+	copy(iv[8:], iv[:8])
+	return iv
+}
+
+// ZucEea3 128-EEA3 机密性算法, bitLen为数据的比特长度, 结果中超出bitLen的比特置0
+func ZucEea3(key []byte, count, bearer, direction uint32, data []byte, bitLen int) ([]byte, error) {
+	if len(key) != 16 {
+		return nil, errors.New("EEA3密钥长度必须为16字节")
+	}
+	if bitLen < 0 || (bitLen+7)/8 > len(data) {
+		return nil, errors.New("EEA3数据长度错误")
+	}
+	result, err := ZucEncrypt(key, zucEea3Iv(count, bearer, direction), data[:(bitLen+7)/8])
+	if err != nil {
+		return nil, err
+	}
+	if bitLen%8 != 0 {
+		result[len(result)-1] &= 0xff << (8 - uint(bitLen%8))
+	}
+	return result, nil
+}
+
+// ZucEia3 128-EIA3 完整性算法, 返回4字节消息认证码
+func ZucEia3(key []byte, count, bearer, direction uint32, data []byte, bitLen int) ([]byte, error) {
+	if len(key) != 16 {
+		return nil, errors.New("EIA3密钥长度必须为16字节")
+	}
+	if bitLen < 0 || (bitLen+7)/8 > len(data) {
+		return nil, errors.New("EIA3数据长度错误")
+	}
+
+	iv := make([]byte, 16)
+	binary.BigEndian.PutUint32(iv, count)
+	iv[4] = byte(bearer << 3)
+	copy(iv[8:], iv[:8])
+	iv[8] ^= byte((direction & 1) << 7)
+	iv[14] ^= byte((direction & 1) << 7)
+
+	state, err := newZucState(key, iv)
+	if err != nil {
+		return nil, err
+	}
+	z := state.words((bitLen+31)/32 + 2)
+	word := func(i int) uint32 {
+		j, k := i/32, uint(i%32)
+		if k == 0 {
+			return z[j]
+		}
+		return z[j]<<k | z[j+1]>>(32-k)
+	}
+
+	var t uint32
+	for i := 0; i < bitLen; i++ {
+		if data[i/8]&(0x80>>uint(i%8)) != 0 {
+			t ^= word(i)
+		}
+	}
+	t ^= word(bitLen)
+	t ^= z[len(z)-1]
+
+	mac := make([]byte, 4)
+	binary.BigEndian.PutUint32(mac, t)
+	return mac, nil
+}
@@ -0,0 +1,104 @@
+package gmsm
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestZucKeyStream(t *testing.T) {
+	ff := bytes.Repeat([]byte{0xff}, 16)
+	tests := []struct {
+		key, iv []byte
+		expect  string
+	}{
+		{make([]byte, 16), make([]byte, 16), "27bede74018082da"},
+		{ff, ff, "0657cfa07096398b"},
+		{make([]byte, 32), make([]byte, 25), "58d03ad62e032ce2"},
+	}
+	for _, test := range tests {
+		z, err := ZucKeyStream(test.key, test.iv, 8)
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		if hex.EncodeToString(z) != test.expect {
+			t.Errorf("密钥流错误: %x", z)
+		}
+	}
+}
+
+func TestZucEea3Eia3(t *testing.T) {
+	key, _ := hex.DecodeString("173d14ba5003731d7a60049470f00a29")
+	plain, _ := hex.DecodeString("6cf65340735552ab0c9752fa6f9025fe0bd675d9005875b200")
+	encrypt, err := ZucEea3(key, 0x66035492, 0xf, 0, plain, 193)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if hex.EncodeToString(encrypt) != "a6c85fc66afb8533aafc2518dfe784940ee1e4b030238cc800" {
+		t.Errorf("EEA3加密结果错误: %x", encrypt)
+	}
+
+	mac, err := ZucEia3(make([]byte, 16), 0, 0, 0, []byte{0}, 1)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if hex.EncodeToString(mac) != "c8a9595e" {
+		t.Errorf("EIA3结果错误: %x", mac)
+	}
+}
+
+func TestZucEncrypt2File(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zuc")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	key := bytes.Repeat([]byte{0x01}, 32)
+	iv := bytes.Repeat([]byte{0x02}, 23)
+	data := bytes.Repeat([]byte("zuc文件加密"), 100000)
+
+	srcPath, encPath, decPath := dir+"/src", dir+"/enc", dir+"/dec"
+	if err = ioutil.WriteFile(srcPath, data, 0644); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	convert := func(src, dest string, f func(key, iv []byte, srcFile, destFile *os.File) error) error {
+		srcFile, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer srcFile.Close()
+		destFile, err := os.Create(dest)
+		if err != nil {
+			return err
+		}
+		defer destFile.Close()
+		return f(key, iv, srcFile, destFile)
+	}
+	if err = convert(srcPath, encPath, ZucEncrypt2File); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if err = convert(encPath, decPath, ZucDecrypt2File); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	encrypt, _ := ioutil.ReadFile(encPath)
+	expect, _ := ZucEncrypt(key, iv, data)
+	if !bytes.Equal(encrypt, expect) {
+		t.Error("文件加密结果与内存加密结果不一致")
+	}
+	decrypt, _ := ioutil.ReadFile(decPath)
+	if !bytes.Equal(decrypt, data) {
+		t.Error("文件解密结果不一致")
+	}
+}
@@ -2,4 +2,11 @@ module github.com/byzk-org/common-utils
 
 go 1.16
 
-require github.com/tjfoc/gmsm v1.4.0
+require (
+	github.com/emmansun/gmsm v0.15.5
+	github.com/klauspost/compress v1.15.9
+	github.com/pierrec/lz4/v4 v4.1.17
+	github.com/tjfoc/gmsm v1.4.0
+	github.com/ulikunitz/xz v0.5.11
+	golang.org/x/crypto v0.4.0
+)
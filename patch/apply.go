@@ -0,0 +1,157 @@
+package patch
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// applyBufferSize 应用补丁时每次处理的数据大小
+const applyBufferSize = 64 * 1024
+
+// Apply 将补丁应用到旧文件并将新文件写入w
+// 旧文件通过old随机读取, 补丁与新文件均为流式处理, 内存占用与文件大小无关
+// 应用前会校验旧文件的大小与摘要, 结束时校验新文件的摘要, 校验失败时w中已写入的数据不可使用
+func Apply(old io.ReaderAt, oldSize int64, patch io.Reader, w io.Writer) error {
+	pr, err := openPatch(patch)
+	if err != nil {
+		return err
+	}
+	defer pr.Close()
+	r := bufio.NewReaderSize(pr, applyBufferSize)
+	header, err := readHeader(r)
+	if err != nil {
+		return err
+	}
+	if header.OldSize != oldSize {
+		return ErrOldMismatch
+	}
+	oldHash := sha256.New()
+	if _, err = io.Copy(oldHash, io.NewSectionReader(old, 0, oldSize)); err != nil {
+		return errors.New("读取旧文件失败 => " + err.Error())
+	}
+	if !bytes.Equal(oldHash.Sum(nil), header.OldSum[:]) {
+		return ErrOldMismatch
+	}
+
+	newHash := sha256.New()
+	out := io.MultiWriter(w, newHash)
+	var (
+		ctrl           [ctrlSize]byte
+		diffBuf        = make([]byte, applyBufferSize)
+		oldBuf         = make([]byte, applyBufferSize)
+		oldPos, newPos int64
+	)
+	for newPos < header.NewSize {
+		if _, err = io.ReadFull(r, ctrl[:]); err != nil {
+			return ErrCorrupt
+		}
+		diffLen := binary.BigEndian.Uint64(ctrl[0:])
+		extraLen := binary.BigEndian.Uint64(ctrl[8:])
+		seek := int64(binary.BigEndian.Uint64(ctrl[16:]))
+		if diffLen > uint64(header.NewSize-newPos) || extraLen > uint64(header.NewSize-newPos)-diffLen {
+			return ErrCorrupt
+		}
+
+		for remain := int64(diffLen); remain > 0; {
+			n := int64(len(diffBuf))
+			if remain < n {
+				n = remain
+			}
+			if _, err = io.ReadFull(r, diffBuf[:n]); err != nil {
+				return ErrCorrupt
+			}
+			// 旧文件中超出范围的部分按0处理
+			start, end := oldPos, oldPos+n
+			if start < 0 {
+				start = 0
+			}
+			if end > oldSize {
+				end = oldSize
+			}
+			if start < end {
+				chunk := oldBuf[:end-start]
+				if _, err = old.ReadAt(chunk, start); err != nil && err != io.EOF {
+					return errors.New("读取旧文件失败 => " + err.Error())
+				}
+				offset := start - oldPos
+				for i, c := range chunk {
+					diffBuf[offset+int64(i)] += c
+				}
+			}
+			if _, err = out.Write(diffBuf[:n]); err != nil {
+				return errors.New("写入新文件失败 => " + err.Error())
+			}
+			remain -= n
+			oldPos += n
+			newPos += n
+		}
+
+		if _, err = io.CopyN(out, r, int64(extraLen)); err != nil {
+			if err == io.EOF {
+				return ErrCorrupt
+			}
+			return errors.New("写入新文件失败 => " + err.Error())
+		}
+		newPos += int64(extraLen)
+		oldPos += seek
+	}
+	if !bytes.Equal(newHash.Sum(nil), header.NewSum[:]) {
+		return ErrChecksum
+	}
+	return nil
+}
+
+// ApplyFile 将补丁应用到oldFile并生成newFile, newFile可以与oldFile相同
+// 新文件先写入同目录下的临时文件, 校验通过后再替换, 权限与旧文件一致
+func ApplyFile(oldFile, patchFile, newFile string) error {
+	oldReader, err := os.Open(oldFile)
+	if err != nil {
+		return errors.New("打开旧文件失败 => " + err.Error())
+	}
+	defer oldReader.Close()
+	stat, err := oldReader.Stat()
+	if err != nil {
+		return errors.New("读取旧文件信息失败 => " + err.Error())
+	}
+	patchReader, err := os.Open(patchFile)
+	if err != nil {
+		return errors.New("打开补丁文件失败 => " + err.Error())
+	}
+	defer patchReader.Close()
+
+	tmp, err := ioutil.TempFile(filepath.Dir(newFile), "."+filepath.Base(newFile)+".patch")
+	if err != nil {
+		return errors.New("创建临时文件失败 => " + err.Error())
+	}
+	bw := bufio.NewWriterSize(tmp, applyBufferSize)
+	if err = Apply(oldReader, stat.Size(), patchReader, bw); err == nil {
+		if err = bw.Flush(); err != nil {
+			err = errors.New("写入新文件失败 => " + err.Error())
+		}
+	}
+	if err == nil {
+		if err = tmp.Chmod(stat.Mode().Perm()); err != nil {
+			err = errors.New("设置文件权限失败 => " + err.Error())
+		}
+	}
+	if closeErr := tmp.Close(); err == nil && closeErr != nil {
+		err = errors.New("关闭新文件失败 => " + closeErr.Error())
+	}
+	if err == nil {
+		if err = os.Rename(tmp.Name(), newFile); err != nil {
+			err = errors.New("替换新文件失败 => " + err.Error())
+		}
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,348 @@
+package patch
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"github.com/byzk-org/common-utils/compress"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+)
+
+// MaxOldSize 旧文件的大小上限, 后缀数组使用int32保存
+const MaxOldSize = math.MaxInt32 - 1
+
+// split qsufsort中对I[start:start+length]按第h个字符之后的排名进行三路划分
+func split(I, V []int32, start, length, h int32) {
+	if length < 16 {
+		var j int32
+		for k := start; k < start+length; k += j {
+			j = 1
+			x := V[I[k]+h]
+			for i := int32(1); k+i < start+length; i++ {
+				if V[I[k+i]+h] < x {
+					x = V[I[k+i]+h]
+					j = 0
+				}
+				if V[I[k+i]+h] == x {
+					I[k+j], I[k+i] = I[k+i], I[k+j]
+					j++
+				}
+			}
+			for i := int32(0); i < j; i++ {
+				V[I[k+i]] = k + j - 1
+			}
+			if j == 1 {
+				I[k] = -1
+			}
+		}
+		return
+	}
+
+	x := V[I[start+length/2]+h]
+	var jj, kk int32
+	for i := start; i < start+length; i++ {
+		if V[I[i]+h] < x {
+			jj++
+		}
+		if V[I[i]+h] == x {
+			kk++
+		}
+	}
+	jj += start
+	kk += jj
+
+	i, j, k := start, int32(0), int32(0)
+	for i < jj {
+		switch {
+		case V[I[i]+h] < x:
+			i++
+		case V[I[i]+h] == x:
+			I[i], I[jj+j] = I[jj+j], I[i]
+			j++
+		default:
+			I[i], I[kk+k] = I[kk+k], I[i]
+			k++
+		}
+	}
+	for jj+j < kk {
+		if V[I[jj+j]+h] == x {
+			j++
+		} else {
+			I[jj+j], I[kk+k] = I[kk+k], I[jj+j]
+			k++
+		}
+	}
+
+	if jj > start {
+		split(I, V, start, jj-start, h)
+	}
+	for i := int32(0); i < kk-jj; i++ {
+		V[I[jj+i]] = kk - 1
+	}
+	if jj == kk-1 {
+		I[jj] = -1
+	}
+	if start+length > kk {
+		split(I, V, kk, start+length-kk, h)
+	}
+}
+
+// qsufsort 使用Larsson-Sadakane算法计算old的后缀数组, 返回的数组长度为len(old)+1
+func qsufsort(old []byte) []int32 {
+	size := int32(len(old))
+	I := make([]int32, size+1)
+	V := make([]int32, size+1)
+
+	var buckets [256]int32
+	for _, c := range old {
+		buckets[c]++
+	}
+	for i := 1; i < 256; i++ {
+		buckets[i] += buckets[i-1]
+	}
+	for i := 255; i > 0; i-- {
+		buckets[i] = buckets[i-1]
+	}
+	buckets[0] = 0
+
+	for i, c := range old {
+		buckets[c]++
+		I[buckets[c]] = int32(i)
+	}
+	I[0] = size
+	for i, c := range old {
+		V[i] = buckets[c]
+	}
+	V[size] = 0
+	for i := 1; i < 256; i++ {
+		if buckets[i] == buckets[i-1]+1 {
+			I[buckets[i]] = -1
+		}
+	}
+	I[0] = -1
+
+	for h := int32(1); I[0] != -(size + 1); h += h {
+		var length int32
+		i := int32(0)
+		for i < size+1 {
+			if I[i] < 0 {
+				length -= I[i]
+				i -= I[i]
+			} else {
+				if length != 0 {
+					I[i-length] = -length
+				}
+				length = V[I[i]] + 1 - i
+				split(I, V, i, length, h)
+				i += length
+				length = 0
+			}
+		}
+		if length != 0 {
+			I[i-length] = -length
+		}
+	}
+
+	for i := int32(0); i < size+1; i++ {
+		I[V[i]] = i
+	}
+	return I
+}
+
+func matchLen(a, b []byte) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// search 在后缀数组I[st:en]中查找与target前缀匹配最长的位置
+func search(I []int32, old, target []byte, st, en int) (pos, length int) {
+	for en-st >= 2 {
+		x := st + (en-st)/2
+		end := len(old) - int(I[x])
+		if end > len(target) {
+			end = len(target)
+		}
+		if bytes.Compare(old[I[x]:int(I[x])+end], target[:end]) < 0 {
+			st = x
+		} else {
+			en = x
+		}
+	}
+	x := matchLen(old[I[st]:], target)
+	y := matchLen(old[I[en]:], target)
+	if x > y {
+		return int(I[st]), x
+	}
+	return int(I[en]), y
+}
+
+// diffWriter 依次写入控制块与数据
+type diffWriter struct {
+	w   *bufio.Writer
+	buf [ctrlSize]byte
+}
+
+func (d *diffWriter) block(old, new []byte, lastScan, lastPos, lenf, extraLen, seek int) error {
+	binary.BigEndian.PutUint64(d.buf[0:], uint64(lenf))
+	binary.BigEndian.PutUint64(d.buf[8:], uint64(extraLen))
+	binary.BigEndian.PutUint64(d.buf[16:], uint64(int64(seek)))
+	if _, err := d.w.Write(d.buf[:]); err != nil {
+		return err
+	}
+	for i := 0; i < lenf; i++ {
+		if err := d.w.WriteByte(new[lastScan+i] - old[lastPos+i]); err != nil {
+			return err
+		}
+	}
+	_, err := d.w.Write(new[lastScan+lenf : lastScan+lenf+extraLen])
+	return err
+}
+
+// writeBlocks 使用bsdiff的算法计算控制块
+func writeBlocks(d *diffWriter, old, new []byte) error {
+	I := qsufsort(old)
+	oldSize, newSize := len(old), len(new)
+	var scan, pos, length, lastScan, lastPos, lastOffset int
+	for scan < newSize {
+		oldScore := 0
+		scan += length
+		for scsc := scan; scan < newSize; scan++ {
+			pos, length = search(I, old, new[scan:], 0, oldSize)
+			for ; scsc < scan+length; scsc++ {
+				if scsc+lastOffset < oldSize && old[scsc+lastOffset] == new[scsc] {
+					oldScore++
+				}
+			}
+			if (length == oldScore && length != 0) || length > oldScore+8 {
+				break
+			}
+			if scan+lastOffset < oldSize && old[scan+lastOffset] == new[scan] {
+				oldScore--
+			}
+		}
+		if length == oldScore && scan != newSize {
+			continue
+		}
+
+		// 向前扩展
+		s, sf, lenf := 0, 0, 0
+		for i := 0; lastScan+i < scan && lastPos+i < oldSize; {
+			if old[lastPos+i] == new[lastScan+i] {
+				s++
+			}
+			i++
+			if s*2-i > sf*2-lenf {
+				sf, lenf = s, i
+			}
+		}
+
+		// 向后扩展
+		lenb := 0
+		if scan < newSize {
+			s, sb := 0, 0
+			for i := 1; scan >= lastScan+i && pos >= i; i++ {
+				if old[pos-i] == new[scan-i] {
+					s++
+				}
+				if s*2-i > sb*2-lenb {
+					sb, lenb = s, i
+				}
+			}
+		}
+
+		// 处理重叠
+		if lastScan+lenf > scan-lenb {
+			overlap := (lastScan + lenf) - (scan - lenb)
+			s, ss, lens := 0, 0, 0
+			for i := 0; i < overlap; i++ {
+				if new[lastScan+lenf-overlap+i] == old[lastPos+lenf-overlap+i] {
+					s++
+				}
+				if new[scan-lenb+i] == old[pos-lenb+i] {
+					s--
+				}
+				if s > ss {
+					ss, lens = s, i+1
+				}
+			}
+			lenf += lens - overlap
+			lenb -= lens
+		}
+
+		extraLen := (scan - lenb) - (lastScan + lenf)
+		seek := (pos - lenb) - (lastPos + lenf)
+		if err := d.block(old, new, lastScan, lastPos, lenf, extraLen, seek); err != nil {
+			return err
+		}
+		lastScan, lastPos, lastOffset = scan-lenb, pos-lenb, pos-scan
+	}
+	return nil
+}
+
+// Diff 生成从oldData到newData的二进制补丁并写入w
+// 生成时需要将两个文件全部放入内存, 另需要约8倍旧文件大小的内存保存后缀数组
+func Diff(oldData, newData []byte, w io.Writer, opts *Options) error {
+	if len(oldData) > MaxOldSize {
+		return errors.New("旧文件过大, 无法生成补丁")
+	}
+	cw, err := compress.NewWriter(opts.format(), w)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriterSize(cw, 64*1024)
+	header := &Header{
+		OldSize: int64(len(oldData)),
+		NewSize: int64(len(newData)),
+		OldSum:  sha256.Sum256(oldData),
+		NewSum:  sha256.Sum256(newData),
+	}
+	if _, err = bw.Write(header.marshal()); err != nil {
+		cw.Close()
+		return errors.New("写入补丁失败 => " + err.Error())
+	}
+	if err = writeBlocks(&diffWriter{w: bw}, oldData, newData); err != nil {
+		cw.Close()
+		return errors.New("写入补丁失败 => " + err.Error())
+	}
+	if err = bw.Flush(); err != nil {
+		cw.Close()
+		return errors.New("写入补丁失败 => " + err.Error())
+	}
+	if err = cw.Close(); err != nil {
+		return errors.New("关闭压缩流失败 => " + err.Error())
+	}
+	return nil
+}
+
+// DiffFile 生成从oldFile到newFile的补丁文件
+func DiffFile(oldFile, newFile, patchFile string, opts *Options) error {
+	oldData, err := ioutil.ReadFile(oldFile)
+	if err != nil {
+		return errors.New("读取旧文件失败 => " + err.Error())
+	}
+	newData, err := ioutil.ReadFile(newFile)
+	if err != nil {
+		return errors.New("读取新文件失败 => " + err.Error())
+	}
+	file, err := os.Create(patchFile)
+	if err != nil {
+		return errors.New("创建补丁文件失败 => " + err.Error())
+	}
+	if err = Diff(oldData, newData, file, opts); err != nil {
+		file.Close()
+		_ = os.Remove(patchFile)
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return errors.New("关闭补丁文件失败 => " + err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package patch
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"github.com/byzk-org/common-utils/compress"
+	"io"
+)
+
+// 补丁格式:
+// 补丁整体经过compress压缩, 解压后依次为
+//   magic "BZDIFF" | 版本 1 | 保留 0 | 旧文件大小 uint64 | 新文件大小 uint64 | 旧文件sha256 | 新文件sha256
+// 之后为若干控制块, 每块为
+//   diffLen uint64 | extraLen uint64 | seek int64 | diffLen字节的差值 | extraLen字节的新增数据
+// 差值与旧文件中对应位置的数据相加得到新文件内容, 之后追加新增数据, 再将旧文件的读取位置移动seek
+// 控制块写满新文件大小即结束, 与bsdiff的算法一致, 但控制块与数据交错存放以便流式应用
+
+var patchMagic = []byte("BZDIFF\x01\x00")
+
+const (
+	headerSize = 8 + 8 + 8 + sha256.Size*2
+	ctrlSize   = 24
+)
+
+var (
+	// ErrOldMismatch 旧文件与补丁生成时使用的文件不一致
+	ErrOldMismatch = errors.New("旧文件与补丁不匹配")
+	// ErrCorrupt 补丁数据损坏
+	ErrCorrupt = errors.New("补丁数据损坏")
+	// ErrChecksum 应用补丁后的结果校验失败
+	ErrChecksum = errors.New("补丁应用结果校验失败")
+)
+
+// Options 生成补丁的参数
+type Options struct {
+	// Format 补丁的压缩格式, 默认为compress.FormatZstd, compress.FormatTar表示不压缩
+	Format compress.Format
+}
+
+func (o *Options) format() compress.Format {
+	if o == nil || o.Format == compress.FormatUnknown {
+		return compress.FormatZstd
+	}
+	return o.Format
+}
+
+// Header 补丁头信息
+type Header struct {
+	// OldSize 旧文件大小
+	OldSize int64
+	// NewSize 新文件大小
+	NewSize int64
+	// OldSum 旧文件的sha256
+	OldSum [sha256.Size]byte
+	// NewSum 新文件的sha256
+	NewSum [sha256.Size]byte
+}
+
+func (h *Header) marshal() []byte {
+	buf := make([]byte, headerSize)
+	copy(buf, patchMagic)
+	binary.BigEndian.PutUint64(buf[8:], uint64(h.OldSize))
+	binary.BigEndian.PutUint64(buf[16:], uint64(h.NewSize))
+	copy(buf[24:], h.OldSum[:])
+	copy(buf[24+sha256.Size:], h.NewSum[:])
+	return buf
+}
+
+func readHeader(r io.Reader) (*Header, error) {
+	buf := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, ErrCorrupt
+	}
+	if !bytes.Equal(buf[:len(patchMagic)], patchMagic) {
+		return nil, errors.New("不是有效的补丁文件")
+	}
+	h := &Header{
+		OldSize: int64(binary.BigEndian.Uint64(buf[8:])),
+		NewSize: int64(binary.BigEndian.Uint64(buf[16:])),
+	}
+	if h.OldSize < 0 || h.NewSize < 0 {
+		return nil, ErrCorrupt
+	}
+	copy(h.OldSum[:], buf[24:])
+	copy(h.NewSum[:], buf[24+sha256.Size:])
+	return h, nil
+}
+
+// openPatch 识别补丁的压缩格式并返回解压后的流
+func openPatch(patch io.Reader) (io.ReadCloser, error) {
+	format, r, err := compress.Detect(patch)
+	if err != nil {
+		return nil, err
+	}
+	if format == compress.FormatUnknown {
+		// 未压缩的补丁
+		format = compress.FormatTar
+	}
+	return compress.NewReader(format, r)
+}
+
+// ReadHeader 读取补丁头信息, 可用于在应用前检查旧文件与新文件的大小及摘要
+func ReadHeader(patch io.Reader) (*Header, error) {
+	r, err := openPatch(patch)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return readHeader(r)
+}
@@ -0,0 +1,144 @@
+package patch
+
+import (
+	"bytes"
+	"github.com/byzk-org/common-utils/compress"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// mutate 在data的基础上修改、插入、删除少量数据
+func mutate(rnd *rand.Rand, data []byte) []byte {
+	result := append([]byte(nil), data...)
+	for i := 0; i < 20; i++ {
+		pos := rnd.Intn(len(result))
+		switch i % 3 {
+		case 0:
+			result[pos] ^= 0xff
+		case 1:
+			insert := make([]byte, rnd.Intn(100))
+			rnd.Read(insert)
+			result = append(result[:pos], append(insert, result[pos:]...)...)
+		default:
+			end := pos + rnd.Intn(100)
+			if end > len(result) {
+				end = len(result)
+			}
+			result = append(result[:pos], result[end:]...)
+		}
+	}
+	return result
+}
+
+func TestDiffApply(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	oldData := make([]byte, 512*1024)
+	rnd.Read(oldData)
+	newData := mutate(rnd, oldData)
+
+	cases := []struct {
+		name    string
+		oldData []byte
+		newData []byte
+		format  compress.Format
+	}{
+		{"mutate", oldData, newData, compress.FormatUnknown},
+		{"gzip", oldData, newData, compress.FormatGzip},
+		{"raw", oldData, newData, compress.FormatTar},
+		{"empty-old", nil, []byte("new file content"), compress.FormatUnknown},
+		{"empty-new", []byte("old file content"), nil, compress.FormatUnknown},
+		{"text", []byte("hello world, hello patch"), []byte("hello patch, hello world!"), compress.FormatUnknown},
+	}
+	for _, c := range cases {
+		var patch bytes.Buffer
+		if err := Diff(c.oldData, c.newData, &patch, &Options{Format: c.format}); err != nil {
+			t.Error(err.Error())
+			return
+		}
+		if c.name == "mutate" && patch.Len() > len(newData)/10 {
+			t.Errorf("补丁过大: %d", patch.Len())
+		}
+		header, err := ReadHeader(bytes.NewReader(patch.Bytes()))
+		if err != nil || header.OldSize != int64(len(c.oldData)) || header.NewSize != int64(len(c.newData)) {
+			t.Errorf("%s: 补丁头信息错误 %v", c.name, err)
+		}
+
+		var result bytes.Buffer
+		if err = Apply(bytes.NewReader(c.oldData), int64(len(c.oldData)), bytes.NewReader(patch.Bytes()), &result); err != nil {
+			t.Error(err.Error())
+			return
+		}
+		if !bytes.Equal(result.Bytes(), c.newData) {
+			t.Errorf("%s: 应用补丁的结果不一致", c.name)
+		}
+	}
+
+	var patch bytes.Buffer
+	if err := Diff(oldData, newData, &patch, nil); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	wrongOld := append([]byte(nil), oldData...)
+	wrongOld[100] ^= 1
+	if err := Apply(bytes.NewReader(wrongOld), int64(len(wrongOld)), bytes.NewReader(patch.Bytes()), ioutil.Discard); err != ErrOldMismatch {
+		t.Errorf("旧文件不匹配时应当返回ErrOldMismatch: %v", err)
+	}
+	truncated := patch.Bytes()[:patch.Len()/2]
+	if err := Apply(bytes.NewReader(oldData), int64(len(oldData)), bytes.NewReader(truncated), ioutil.Discard); err == nil {
+		t.Error("补丁不完整时应当返回错误")
+	}
+}
+
+func TestApplyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "patch-test")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	rnd := rand.New(rand.NewSource(2))
+	oldData := make([]byte, 128*1024)
+	rnd.Read(oldData)
+	newData := mutate(rnd, oldData)
+	oldFile := filepath.Join(dir, "appRunner")
+	newFile := filepath.Join(dir, "appRunner.new")
+	if err = ioutil.WriteFile(oldFile, oldData, 0755); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if err = ioutil.WriteFile(newFile, newData, 0644); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	patchFile := filepath.Join(dir, "appRunner.patch")
+	if err = DiffFile(oldFile, newFile, patchFile, nil); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	// 原地更新
+	if err = ApplyFile(oldFile, patchFile, oldFile); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	data, err := ioutil.ReadFile(oldFile)
+	if err != nil || !bytes.Equal(data, newData) {
+		t.Error("应用补丁的结果不一致")
+	}
+	if stat, err := os.Stat(oldFile); err != nil || stat.Mode().Perm() != 0755 {
+		t.Error("应用补丁后文件权限错误")
+	}
+
+	// 再次应用时旧文件已经变化
+	if err = ApplyFile(oldFile, patchFile, oldFile); err != ErrOldMismatch {
+		t.Errorf("旧文件不匹配时应当返回ErrOldMismatch: %v", err)
+	}
+	entries, _ := ioutil.ReadDir(dir)
+	if len(entries) != 3 {
+		t.Error("失败时应当清理临时文件")
+	}
+}
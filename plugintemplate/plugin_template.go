@@ -5,14 +5,15 @@ import (
 	"crypto/rand"
 	"encoding/json"
 	"errors"
+	"github.com/byzk-org/common-utils/gmsm"
 	"github.com/byzk-org/common-utils/hash"
 	"github.com/byzk-org/common-utils/plugintemplate/telnet"
 	"github.com/byzk-org/common-utils/plugintemplate/timelistener"
-	"github.com/tjfoc/gmsm/sm2"
 	"time"
 )
 
-func NewPluginTemplate(priKey *sm2.PrivateKey, goos, goarch, saveDir string) *pluginTemplate {
+// NewPluginTemplate 创建插件模板, priKey可以是*sm2.PrivateKey或密钥提供者返回的签名句柄
+func NewPluginTemplate(priKey gmsm.Signer, goos, goarch, saveDir string) *pluginTemplate {
 	return &pluginTemplate{
 		priKey:  priKey,
 		result:  make([]*PluginResult, 0),
@@ -59,7 +60,7 @@ type PluginResult struct {
 
 type pluginTemplate struct {
 	result  []*PluginResult
-	priKey  *sm2.PrivateKey
+	priKey  gmsm.Signer
 	goos    string
 	goarch  string
 	saveDir string
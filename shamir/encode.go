@@ -0,0 +1,123 @@
+package shamir
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"github.com/tjfoc/gmsm/sm2"
+	"hash/crc32"
+	"math/big"
+	"strings"
+)
+
+const (
+	sharePrefix  = "bzss1-"
+	shareVersion = 1
+	// shareHeaderLen 版本(1) || 标识(8) || 序号(1) || 门限(1) || 总数(1) || 长度(2)
+	shareHeaderLen = 1 + shareIdLen + 3 + 2
+	// maxShareValueLen 长度字段为2字节, 份额内容不能超过该长度
+	maxShareValueLen = 1<<16 - 1
+)
+
+// Encode 编码份额为文本, 格式为 bzss1-<base64url>, 内容末尾带有crc32校验值
+func (s *Share) Encode() (string, error) {
+	if len(s.Id) != shareIdLen {
+		return "", errors.New("份额标识长度错误")
+	}
+	if len(s.Value) == 0 || len(s.Value) > maxShareValueLen {
+		return "", errors.New("份额内容长度超出范围, 无法编码")
+	}
+	data := make([]byte, shareHeaderLen, shareHeaderLen+len(s.Value)+4)
+	data[0] = shareVersion
+	copy(data[1:], s.Id)
+	data[1+shareIdLen] = s.Index
+	data[2+shareIdLen] = s.Threshold
+	data[3+shareIdLen] = s.Total
+	binary.BigEndian.PutUint16(data[4+shareIdLen:], uint16(len(s.Value)))
+	data = append(data, s.Value...)
+	data = append(data, make([]byte, 4)...)
+	binary.BigEndian.PutUint32(data[len(data)-4:], crc32.ChecksumIEEE(data[:len(data)-4]))
+	return sharePrefix + base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// String 份额的文本编码, 无法编码时返回空字符串
+func (s *Share) String() string {
+	str, _ := s.Encode()
+	return str
+}
+
+// DecodeShare 解析Encode编码的份额, 并校验crc32
+func DecodeShare(str string) (*Share, error) {
+	str = strings.TrimSpace(str)
+	if !strings.HasPrefix(str, sharePrefix) {
+		return nil, errors.New("份额格式错误")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(str[len(sharePrefix):])
+	if err != nil {
+		return nil, errors.New("份额编码错误 => " + err.Error())
+	}
+	if len(data) < shareHeaderLen+4 {
+		return nil, errors.New("份额长度错误")
+	}
+	if crc32.ChecksumIEEE(data[:len(data)-4]) != binary.BigEndian.Uint32(data[len(data)-4:]) {
+		return nil, errors.New("份额校验失败, 内容可能已损坏")
+	}
+	if data[0] != shareVersion {
+		return nil, errors.New("不支持的份额版本")
+	}
+	size := int(binary.BigEndian.Uint16(data[4+shareIdLen:]))
+	if size != len(data)-shareHeaderLen-4 {
+		return nil, errors.New("份额长度错误")
+	}
+	share := &Share{
+		Id:        append([]byte(nil), data[1:1+shareIdLen]...),
+		Index:     data[1+shareIdLen],
+		Threshold: data[2+shareIdLen],
+		Total:     data[3+shareIdLen],
+		Value:     append([]byte(nil), data[shareHeaderLen:len(data)-4]...),
+	}
+	if share.Index == 0 || share.Threshold < 2 || share.Total < share.Threshold || share.Index > share.Total {
+		return nil, errors.New("份额参数错误")
+	}
+	return share, nil
+}
+
+// CombineEncoded 使用文本编码的份额恢复秘密
+func CombineEncoded(shares []string) ([]byte, error) {
+	decoded := make([]*Share, 0, len(shares))
+	for _, s := range shares {
+		share, err := DecodeShare(s)
+		if err != nil {
+			return nil, err
+		}
+		decoded = append(decoded, share)
+	}
+	return Combine(decoded)
+}
+
+// SplitSm2PrivateKey 将sm2私钥拆分为n个份额, 任意k个份额可以恢复
+func SplitSm2PrivateKey(pri *sm2.PrivateKey, n, k int) ([]*Share, error) {
+	if pri == nil || pri.D == nil {
+		return nil, errors.New("私钥不能为空")
+	}
+	d := make([]byte, 32)
+	pri.D.FillBytes(d)
+	return Split(d, n, k)
+}
+
+// CombineSm2PrivateKey 使用份额恢复sm2私钥
+func CombineSm2PrivateKey(shares []*Share) (*sm2.PrivateKey, error) {
+	d, err := Combine(shares)
+	if err != nil {
+		return nil, err
+	}
+	curve := sm2.P256Sm2()
+	k := new(big.Int).SetBytes(d)
+	if len(d) != 32 || k.Sign() == 0 || k.Cmp(curve.Params().N) >= 0 {
+		return nil, errors.New("恢复的内容不是sm2私钥")
+	}
+	pri := &sm2.PrivateKey{D: k}
+	pri.PublicKey.Curve = curve
+	pri.PublicKey.X, pri.PublicKey.Y = curve.ScalarBaseMult(d)
+	return pri, nil
+}
@@ -0,0 +1,195 @@
+package shamir
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"github.com/tjfoc/gmsm/sm3"
+	"io"
+	"strconv"
+)
+
+const (
+	// secretCheckLen 拆分前追加到秘密之后的sm3摘要长度, 用于恢复时校验结果
+	secretCheckLen = 8
+	shareIdLen     = 8
+	// MaxSecretLen 可拆分的秘密最大长度, 保证份额可以通过Encode编码
+	MaxSecretLen = maxShareValueLen - secretCheckLen
+)
+
+var (
+	gfExp [510]byte
+	gfLog [256]byte
+)
+
+func init() {
+	// GF(2^8), 不可约多项式 x^8 + x^4 + x^3 + x + 1, 生成元为3
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		gfExp[i] = x
+		gfExp[i+255] = x
+		gfLog[x] = byte(i)
+		x ^= gfMulSlow(x, 2)
+	}
+}
+
+func gfMulSlow(a, b byte) byte {
+	var p byte
+	for b > 0 {
+		if b&1 != 0 {
+			p ^= a
+		}
+		carry := a & 0x80
+		a <<= 1
+		if carry != 0 {
+			a ^= 0x1b
+		}
+		b >>= 1
+	}
+	return p
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+255-int(gfLog[b])]
+}
+
+// Share 秘密份额
+type Share struct {
+	// Id 同一次拆分产生的份额具有相同的标识
+	Id []byte
+	// Index 份额序号(多项式的x坐标), 1~255
+	Index byte
+	// Threshold 恢复秘密需要的最少份额数
+	Threshold byte
+	// Total 拆分的份额总数
+	Total byte
+	Value []byte
+}
+
+// Split 将秘密拆分为n个份额, 任意k个份额可以恢复秘密
+func Split(secret []byte, n, k int) ([]*Share, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("秘密不能为空")
+	}
+	if len(secret) > MaxSecretLen {
+		return nil, errors.New("秘密长度不能超过" + strconv.Itoa(MaxSecretLen) + "字节")
+	}
+	if k < 2 || n < k || n > 255 {
+		return nil, errors.New("份额参数错误, 需要满足 2 <= k <= n <= 255")
+	}
+
+	id := make([]byte, shareIdLen)
+	if _, err := io.ReadFull(rand.Reader, id); err != nil {
+		return nil, errors.New("生成份额标识失败")
+	}
+
+	data := append(append([]byte(nil), secret...), secretCheck(id, secret)...)
+	shares := make([]*Share, n)
+	for i := range shares {
+		shares[i] = &Share{
+			Id:        id,
+			Index:     byte(i + 1),
+			Threshold: byte(k),
+			Total:     byte(n),
+			Value:     make([]byte, len(data)),
+		}
+	}
+
+	coefficients := make([]byte, k)
+	for pos, b := range data {
+		coefficients[0] = b
+		if _, err := io.ReadFull(rand.Reader, coefficients[1:]); err != nil {
+			return nil, errors.New("生成随机多项式失败")
+		}
+		for _, share := range shares {
+			// 秦九韶算法计算多项式在x处的值
+			var y byte
+			for j := k - 1; j >= 0; j-- {
+				y = gfMul(y, share.Index) ^ coefficients[j]
+			}
+			share.Value[pos] = y
+		}
+	}
+	for i := range coefficients {
+		coefficients[i] = 0
+	}
+	return shares, nil
+}
+
+// Combine 使用不少于门限数量的份额恢复秘密, 并校验恢复结果
+func Combine(shares []*Share) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, errors.New("份额不能为空")
+	}
+	first := shares[0]
+	if first == nil || int(first.Threshold) < 2 || len(first.Value) <= secretCheckLen {
+		return nil, errors.New("份额内容错误")
+	}
+
+	used := make([]*Share, 0, first.Threshold)
+	seen := make(map[byte]bool)
+	for _, share := range shares {
+		if share == nil {
+			return nil, errors.New("份额不能为空")
+		}
+		if subtle.ConstantTimeCompare(share.Id, first.Id) != 1 {
+			return nil, errors.New("份额不属于同一次拆分")
+		}
+		if share.Threshold != first.Threshold || share.Total != first.Total || len(share.Value) != len(first.Value) {
+			return nil, errors.New("份额参数不一致 => " + strconv.Itoa(int(share.Index)))
+		}
+		if share.Index == 0 {
+			return nil, errors.New("份额序号错误")
+		}
+		if seen[share.Index] {
+			continue
+		}
+		seen[share.Index] = true
+		if len(used) < int(first.Threshold) {
+			used = append(used, share)
+		}
+	}
+	if len(used) < int(first.Threshold) {
+		return nil, errors.New("份额数量不足, 至少需要" + strconv.Itoa(int(first.Threshold)) + "个")
+	}
+
+	// 拉格朗日插值计算x=0处的值
+	data := make([]byte, len(first.Value))
+	for i, si := range used {
+		var num, den byte = 1, 1
+		for j, sj := range used {
+			if i == j {
+				continue
+			}
+			num = gfMul(num, sj.Index)
+			den = gfMul(den, si.Index^sj.Index)
+		}
+		basis := gfDiv(num, den)
+		for pos, v := range si.Value {
+			data[pos] ^= gfMul(basis, v)
+		}
+	}
+
+	secret := data[:len(data)-secretCheckLen]
+	if subtle.ConstantTimeCompare(secretCheck(first.Id, secret), data[len(secret):]) != 1 {
+		return nil, errors.New("恢复的秘密校验失败, 份额可能已损坏")
+	}
+	return secret, nil
+}
+
+func secretCheck(id, secret []byte) []byte {
+	h := sm3.New()
+	h.Write(id)
+	h.Write(secret)
+	return h.Sum(nil)[:secretCheckLen]
+}
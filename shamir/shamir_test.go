@@ -0,0 +1,129 @@
+package shamir
+
+import (
+	"bytes"
+	"github.com/tjfoc/gmsm/sm2"
+	"testing"
+)
+
+func TestSplitCombine(t *testing.T) {
+	secret := []byte("package root master key")
+	shares, err := Split(secret, 5, 3)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	for _, group := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}} {
+		selected := make([]*Share, 0, len(group))
+		for _, i := range group {
+			selected = append(selected, shares[i])
+		}
+		result, err := Combine(selected)
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		if !bytes.Equal(result, secret) {
+			t.Errorf("恢复的秘密不一致: %v", group)
+		}
+	}
+
+	if _, err = Combine(shares[:2]); err == nil {
+		t.Error("份额数量不足时应当返回错误")
+	}
+
+	other, _ := Split(secret, 5, 3)
+	if _, err = Combine([]*Share{shares[0], shares[1], other[2]}); err == nil {
+		t.Error("混用不同拆分的份额应当返回错误")
+	}
+
+	broken := *shares[1]
+	broken.Value = append([]byte(nil), broken.Value...)
+	broken.Value[0] ^= 1
+	if _, err = Combine([]*Share{shares[0], &broken, shares[2]}); err == nil {
+		t.Error("损坏的份额应当校验失败")
+	}
+}
+
+func TestShareEncode(t *testing.T) {
+	shares, err := Split([]byte("secret"), 3, 2)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	encoded := make([]string, 0, 2)
+	for _, share := range []*Share{shares[2], shares[0]} {
+		str, err := share.Encode()
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		encoded = append(encoded, str)
+	}
+	result, err := CombineEncoded(encoded)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if string(result) != "secret" {
+		t.Error("恢复的秘密不一致")
+	}
+
+	s := []byte(encoded[0])
+	if s[10] == 'A' {
+		s[10] = 'B'
+	} else {
+		s[10] = 'A'
+	}
+	if _, err = DecodeShare(string(s)); err == nil {
+		t.Error("被修改的份额应当校验失败")
+	}
+
+	// 长度字段为2字节, 超长的份额不能静默截断
+	long := *shares[0]
+	long.Value = make([]byte, maxShareValueLen+1)
+	if _, err = long.Encode(); err == nil {
+		t.Error("超长的份额应当返回错误")
+	}
+	if long.String() != "" {
+		t.Error("无法编码的份额应当返回空字符串")
+	}
+	if _, err = Split(make([]byte, MaxSecretLen+1), 3, 2); err == nil {
+		t.Error("超长的秘密应当返回错误")
+	}
+	shares, err = Split(bytes.Repeat([]byte{1}, MaxSecretLen), 3, 2)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	str, err := shares[0].Encode()
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if decoded, err := DecodeShare(str); err != nil || !bytes.Equal(decoded.Value, shares[0].Value) {
+		t.Error("最大长度的份额编码后不一致")
+	}
+}
+
+func TestSm2PrivateKey(t *testing.T) {
+	pri, err := sm2.GenerateKey(nil)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	shares, err := SplitSm2PrivateKey(pri, 4, 2)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	result, err := CombineSm2PrivateKey(shares[2:])
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if result.D.Cmp(pri.D) != 0 || result.X.Cmp(pri.X) != 0 || result.Y.Cmp(pri.Y) != 0 {
+		t.Error("恢复的sm2私钥不一致")
+	}
+}